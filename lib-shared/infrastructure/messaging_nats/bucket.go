@@ -0,0 +1,207 @@
+package messaging_nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lib-shared/utils"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// BucketSpec es un bucket KV declarado, cada uso (locks, progreso) tiene su propio TTL e historial.
+type BucketSpec struct {
+	Name        string
+	Description string
+	// TTL es lo que dura una clave sin actualizarse, un lock de una réplica que murió se libera solo al vencer.
+	TTL time.Duration
+	// History es la cantidad de valores que se guardan por clave, por defecto solo el último.
+	History  uint8
+	Replicas int
+	// Storage por defecto es FileStorage, los valores sobreviven a un reinicio del servidor.
+	Storage jetstream.StorageType
+}
+
+func (spec BucketSpec) config() jetstream.KeyValueConfig {
+	return jetstream.KeyValueConfig{
+		Bucket:      spec.Name,
+		Description: spec.Description,
+		TTL:         spec.TTL,
+		History:     max(spec.History, 1),
+		Replicas:    max(spec.Replicas, 1),
+		Storage:     spec.Storage,
+		Compression: true,
+	}
+}
+
+// streamName es el stream KV_<bucket> donde JetStream guarda el bucket.
+func (spec BucketSpec) streamName() string {
+	return "KV_" + spec.Name
+}
+
+// buckets guarda los handles ya abiertos, el NatsStarter se copia por valor y todas las copias comparten el cache.
+type buckets struct {
+	mu      sync.Mutex
+	handles map[string]jetstream.KeyValue
+}
+
+// Bucket devuelve el bucket declarado en spec, la primera vez lo crea o actualiza con su configuración y
+// después devuelve el mismo handle.
+func (st NatsStarter) Bucket(spec BucketSpec) (jetstream.KeyValue, error) {
+	st.buckets.mu.Lock()
+	defer st.buckets.mu.Unlock()
+	if bucket, exists := st.buckets.handles[spec.Name]; exists {
+		return bucket, nil
+	}
+	bucket, err := st.ManagerDataNats.GetJetStream().CreateOrUpdateKeyValue(context.Background(), spec.config())
+	if err != nil {
+		return nil, fmt.Errorf("error al crear o actualizar el bucket %s: %w", spec.Name, err)
+	}
+	utils.Info.Printf("bucket %s listo en nats\n", spec.Name)
+	st.buckets.handles[spec.Name] = bucket
+	return bucket, nil
+}
+
+// Lock es un lock distribuido sobre un bucket: la clave existe mientras alguien tiene el lock.
+type Lock struct {
+	starter *NatsStarter
+	spec    BucketSpec
+}
+
+func NewLock(starter *NatsStarter, spec BucketSpec) Lock {
+	return Lock{starter: starter, spec: spec}
+}
+
+// Acquire toma el lock de key a nombre de owner, devuelve false sin error si otro ya lo tiene.
+func (lock Lock) Acquire(key string, owner string) (bool, error) {
+	bucket, err := lock.starter.Bucket(lock.spec)
+	if err != nil {
+		return false, err
+	}
+	_, err = bucket.Create(context.Background(), key, []byte(owner))
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error al tomar el lock %s en %s: %w", key, lock.spec.Name, err)
+	}
+	utils.Info.Printf("lock tomado %s/%s por %s\n", lock.spec.Name, key, owner)
+	return true, nil
+}
+
+// Owner devuelve quién tiene el lock de key, found es false si nadie lo tiene.
+func (lock Lock) Owner(key string) (owner string, found bool, err error) {
+	bucket, err := lock.starter.Bucket(lock.spec)
+	if err != nil {
+		return "", false, err
+	}
+	entry, err := bucket.Get(context.Background(), key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("error al leer el lock %s en %s: %w", key, lock.spec.Name, err)
+	}
+	return string(entry.Value()), true, nil
+}
+
+// Release libera el lock de key.
+func (lock Lock) Release(key string) error {
+	bucket, err := lock.starter.Bucket(lock.spec)
+	if err != nil {
+		return err
+	}
+	if err := bucket.Delete(context.Background(), key); err != nil {
+		return fmt.Errorf("error al liberar el lock %s en %s: %w", key, lock.spec.Name, err)
+	}
+	return nil
+}
+
+// KeyValue guarda valores de tipo T como JSON en un bucket.
+type KeyValue[T any] struct {
+	starter *NatsStarter
+	spec    BucketSpec
+}
+
+func NewKeyValue[T any](starter *NatsStarter, spec BucketSpec) KeyValue[T] {
+	return KeyValue[T]{starter: starter, spec: spec}
+}
+
+func (kv KeyValue[T]) Put(key string, value T) error {
+	bucket, err := kv.starter.Bucket(kv.spec)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("no se puede serializar el valor de %s en %s: %w", key, kv.spec.Name, err)
+	}
+	if _, err := bucket.Put(context.Background(), key, data); err != nil {
+		return fmt.Errorf("error al guardar %s en %s: %w", key, kv.spec.Name, err)
+	}
+	return nil
+}
+
+// Get devuelve el valor de key, found es false sin error si la clave no existe o venció.
+func (kv KeyValue[T]) Get(key string) (value T, found bool, err error) {
+	bucket, err := kv.starter.Bucket(kv.spec)
+	if err != nil {
+		return value, false, err
+	}
+	entry, err := bucket.Get(context.Background(), key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return value, false, nil
+	}
+	if err != nil {
+		return value, false, fmt.Errorf("error al leer %s en %s: %w", key, kv.spec.Name, err)
+	}
+	if err := json.Unmarshal(entry.Value(), &value); err != nil {
+		return value, false, fmt.Errorf("el valor de %s en %s no es válido: %w", key, kv.spec.Name, err)
+	}
+	return value, true, nil
+}
+
+// Watch envía el valor actual de key y cada actualización hasta que se cancele ctx, ahí cierra el canal. Los
+// borrados y los valores que no se pueden decodificar no se envían.
+func (kv KeyValue[T]) Watch(ctx context.Context, key string) (<-chan T, error) {
+	bucket, err := kv.starter.Bucket(kv.spec)
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := bucket.Watch(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("error al observar %s en %s: %w", key, kv.spec.Name, err)
+	}
+	values := make(chan T)
+	go func() {
+		defer close(values)
+		defer watcher.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case entry, open := <-watcher.Updates():
+				if !open {
+					return
+				}
+				// nil marca el fin de los valores iniciales
+				if entry == nil || entry.Operation() != jetstream.KeyValuePut {
+					continue
+				}
+				var value T
+				if err := json.Unmarshal(entry.Value(), &value); err != nil {
+					continue
+				}
+				select {
+				case values <- value:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return values, nil
+}
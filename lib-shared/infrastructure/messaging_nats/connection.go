@@ -0,0 +1,154 @@
+package messaging_nats
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// intentos de conexión al arrancar antes de devolver el error, una URL o credencial mala no debe dejar el pod
+	// reintentando para siempre
+	defaultConnectAttempts = 10
+	defaultConnectWait     = 3 * time.Second
+)
+
+// Connection son los datos para conectarse a NATS, los servicios los leen con ConnectionFromEnv. Los métodos de
+// autenticación son excluyentes: usuario y contraseña, token, semilla nkey o archivo .creds.
+type Connection struct {
+	URL string
+	// Name es el nombre de la conexión que muestra el monitoreo de NATS, por defecto el Producer de OptsNats.
+	Name     string
+	User     string
+	Password string
+	Token    string
+	// NKeySeed es la ruta del archivo con la semilla nkey del usuario.
+	NKeySeed string
+	// CredsFile es la ruta del archivo .creds con el JWT y la semilla del usuario.
+	CredsFile string
+	// TLSCA es la ruta del certificado de la CA que firmó el del servidor, vacío usa las CA del sistema.
+	TLSCA string
+	// TLSCert y TLSKey son el certificado y la llave del cliente cuando el servidor pide TLS mutuo.
+	TLSCert string
+	TLSKey  string
+	// ConnectAttempts y ConnectWait acotan los reintentos al arrancar, ya conectado el cliente reconecta sin límite.
+	ConnectAttempts int
+	ConnectWait     time.Duration
+}
+
+// ConnectionFromEnv lee la conexión de las variables de entorno, el servicio debe cargar su .env antes:
+//
+//	NATS_URI                    URL del servidor
+//	NATS_USER, NATS_PASSWORD    autenticación, solo una de las cuatro formas:
+//	NATS_TOKEN                    usuario y contraseña, token, semilla nkey (archivo) o .creds (archivo)
+//	NATS_NKEY_SEED
+//	NATS_CREDS
+//	NATS_TLS_CA                 CA del servidor, vacío usa las del sistema
+//	NATS_TLS_CERT, NATS_TLS_KEY certificado y llave del cliente si el servidor pide TLS mutuo
+//	NATS_NAME                   nombre en el monitoreo de nats, vacío usa el nombre del ejecutable
+//	NATS_CONNECT_ATTEMPTS       intentos de conexión al arrancar antes de terminar con error (10)
+func ConnectionFromEnv() Connection {
+	attempts, err := strconv.Atoi(os.Getenv("NATS_CONNECT_ATTEMPTS"))
+	if err != nil {
+		attempts = defaultConnectAttempts
+	}
+	uri, found := os.LookupEnv("NATS_URI")
+	if !found {
+		uri = "no_configurado"
+	}
+	return Connection{
+		URL:             uri,
+		Name:            os.Getenv("NATS_NAME"),
+		User:            os.Getenv("NATS_USER"),
+		Password:        os.Getenv("NATS_PASSWORD"),
+		Token:           os.Getenv("NATS_TOKEN"),
+		NKeySeed:        os.Getenv("NATS_NKEY_SEED"),
+		CredsFile:       os.Getenv("NATS_CREDS"),
+		TLSCA:           os.Getenv("NATS_TLS_CA"),
+		TLSCert:         os.Getenv("NATS_TLS_CERT"),
+		TLSKey:          os.Getenv("NATS_TLS_KEY"),
+		ConnectAttempts: attempts,
+	}
+}
+
+func (connection Connection) options(name string) ([]nats.Option, error) {
+	options := []nats.Option{
+		nats.DontRandomize(),
+		nats.ReconnectWait(time.Second * 3),
+		nats.MaxReconnects(-1),
+		nats.MaxPingsOutstanding(5),
+		nats.PingInterval(10 * time.Second),
+	}
+	if connection.Name != "" {
+		name = connection.Name
+	}
+	if name != "" {
+		options = append(options, nats.Name(name))
+	}
+	methods := 0
+	if connection.User != "" || connection.Password != "" {
+		if connection.User == "" || connection.Password == "" {
+			return nil, errors.New("el usuario de nats necesita usuario y contraseña")
+		}
+		options = append(options, nats.UserInfo(connection.User, connection.Password))
+		methods++
+	}
+	if connection.Token != "" {
+		options = append(options, nats.Token(connection.Token))
+		methods++
+	}
+	if connection.NKeySeed != "" {
+		option, err := nats.NkeyOptionFromSeed(connection.NKeySeed)
+		if err != nil {
+			return nil, fmt.Errorf("error al leer la semilla nkey %s: %w", connection.NKeySeed, err)
+		}
+		options = append(options, option)
+		methods++
+	}
+	if connection.CredsFile != "" {
+		options = append(options, nats.UserCredentials(connection.CredsFile))
+		methods++
+	}
+	if methods > 1 {
+		return nil, errors.New("solo se puede configurar un método de autenticación de nats: usuario, token, nkey o creds")
+	}
+	if connection.TLSCA != "" {
+		options = append(options, nats.RootCAs(connection.TLSCA))
+	}
+	if connection.TLSCert != "" || connection.TLSKey != "" {
+		if connection.TLSCert == "" || connection.TLSKey == "" {
+			return nil, errors.New("el TLS mutuo de nats necesita el certificado y la llave del cliente")
+		}
+		options = append(options, nats.ClientCert(connection.TLSCert, connection.TLSKey))
+	}
+	return options, nil
+}
+
+func (connection Connection) attempts() int {
+	if connection.ConnectAttempts <= 0 {
+		return defaultConnectAttempts
+	}
+	return connection.ConnectAttempts
+}
+
+func (connection Connection) wait() time.Duration {
+	if connection.ConnectWait <= 0 {
+		return defaultConnectWait
+	}
+	return connection.ConnectWait
+}
+
+// redactedURL es la URL sin el usuario, la contraseña o el token, para los logs.
+func (connection Connection) redactedURL() string {
+	parsed, err := url.Parse(connection.URL)
+	if err != nil || parsed.User == nil {
+		return connection.URL
+	}
+	parsed.User = nil
+	return parsed.String()
+}
@@ -0,0 +1,177 @@
+package messaging_nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeadLetterStream guarda los mensajes que agotaron sus entregas o no se podían procesar, con retención por
+// límites para poder listarlos y reenviarlos. Cada stream publica en su propio subject dlq.<stream>.
+const (
+	DeadLetterStream = "conciliador-dead-letters"
+	deadLetterMaxAge = 14 * 24 * time.Hour
+)
+
+// Headers que describen el fallo, se agregan a los headers originales del mensaje.
+const (
+	HeaderDlqStream     = "Dlq-Stream"
+	HeaderDlqConsumer   = "Dlq-Consumer"
+	HeaderDlqSubject    = "Dlq-Subject"
+	HeaderDlqSequence   = "Dlq-Stream-Sequence"
+	HeaderDlqError      = "Dlq-Error"
+	HeaderDlqDeliveries = "Dlq-Deliveries"
+	HeaderDlqPoison     = "Dlq-Poison"
+	HeaderDlqFailedAt   = "Dlq-Failed-At"
+)
+
+// DeadLetter es un mensaje del dead-letter con el detalle del fallo.
+type DeadLetter struct {
+	Sequence   uint64    `json:"sequence"`
+	Stream     string    `json:"stream"`
+	Consumer   string    `json:"consumer"`
+	Subject    string    `json:"subject"`
+	Error      string    `json:"error"`
+	Deliveries int       `json:"deliveries"`
+	Poison     bool      `json:"poison"`
+	FailedAt   time.Time `json:"failedAt"`
+	Data       string    `json:"data"`
+}
+
+func DeadLetterSubject(stream string) string {
+	return "dlq." + strings.ToLower(stream)
+}
+
+// DeadLetterStreamSpec es el stream del dead-letter, se declara en la topología y lo asegura cada listener.
+var DeadLetterStreamSpec = StreamSpec{
+	Name:      DeadLetterStream,
+	Subjects:  []string{"dlq.>"},
+	Retention: jetstream.LimitsPolicy,
+	MaxAge:    deadLetterMaxAge,
+}
+
+func ensureDeadLetterStream(js jetstream.JetStream) error {
+	_, err := js.CreateOrUpdateStream(context.Background(), DeadLetterStreamSpec.config())
+	if err != nil {
+		return fmt.Errorf("error al crear el stream %s: %w", DeadLetterStream, err)
+	}
+	return nil
+}
+
+func publishDeadLetter(js jetstream.JetStream, streamName string, durable string, msg jetstream.Msg, cause error, delivered int) error {
+	deadLetter := nats.NewMsg(DeadLetterSubject(streamName))
+	deadLetter.Data = msg.Data()
+	for key, values := range msg.Headers() {
+		// Nats-Msg-Id haría que el dead-letter descarte el mensaje como duplicado
+		if strings.EqualFold(key, nats.MsgIdHdr) {
+			continue
+		}
+		for _, value := range values {
+			deadLetter.Header.Add(key, value)
+		}
+	}
+	deadLetter.Header.Set(HeaderDlqStream, streamName)
+	deadLetter.Header.Set(HeaderDlqConsumer, durable)
+	deadLetter.Header.Set(HeaderDlqSubject, msg.Subject())
+	deadLetter.Header.Set(HeaderDlqError, cause.Error())
+	deadLetter.Header.Set(HeaderDlqDeliveries, strconv.Itoa(delivered))
+	deadLetter.Header.Set(HeaderDlqPoison, strconv.FormatBool(IsPoison(cause)))
+	deadLetter.Header.Set(HeaderDlqFailedAt, time.Now().UTC().Format(time.RFC3339))
+	if metadata, err := msg.Metadata(); err == nil {
+		deadLetter.Header.Set(HeaderDlqSequence, strconv.FormatUint(metadata.Sequence.Stream, 10))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := js.PublishMsg(ctx, deadLetter)
+	return err
+}
+
+// ListDeadLetters devuelve hasta limit mensajes del dead-letter desde la secuencia fromSeq, solo los del stream
+// indicado o de todos si stream está vacío.
+func (st NatsStarter) ListDeadLetters(stream string, fromSeq uint64, limit int) ([]DeadLetter, error) {
+	js := st.ManagerDataNats.GetJetStream()
+	if err := ensureDeadLetterStream(js); err != nil {
+		return nil, err
+	}
+	dlq, err := js.Stream(context.Background(), DeadLetterStream)
+	if err != nil {
+		return nil, err
+	}
+	subject := "dlq.>"
+	if stream != "" {
+		subject = DeadLetterSubject(stream)
+	}
+	if fromSeq == 0 {
+		fromSeq = 1
+	}
+	deadLetters := make([]DeadLetter, 0)
+	for seq := fromSeq; len(deadLetters) < limit; {
+		raw, err := dlq.GetMsg(context.Background(), seq, jetstream.WithGetMsgSubject(subject))
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error al leer el dead-letter desde la secuencia %d: %w", seq, err)
+		}
+		deadLetters = append(deadLetters, toDeadLetter(raw))
+		seq = raw.Sequence + 1
+	}
+	return deadLetters, nil
+}
+
+// ReplayDeadLetter vuelve a publicar el mensaje en su subject original con sus headers originales y lo borra
+// del dead-letter.
+func (st NatsStarter) ReplayDeadLetter(seq uint64) (*DeadLetter, error) {
+	js := st.ManagerDataNats.GetJetStream()
+	dlq, err := js.Stream(context.Background(), DeadLetterStream)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := dlq.GetMsg(context.Background(), seq)
+	if err != nil {
+		return nil, fmt.Errorf("no se encontró el mensaje %d en el dead-letter: %w", seq, err)
+	}
+	deadLetter := toDeadLetter(raw)
+	if deadLetter.Subject == "" {
+		return nil, fmt.Errorf("el mensaje %d del dead-letter no tiene el subject original", seq)
+	}
+	replay := nats.NewMsg(deadLetter.Subject)
+	replay.Data = raw.Data
+	for key, values := range raw.Header {
+		if strings.HasPrefix(key, "Dlq-") {
+			continue
+		}
+		for _, value := range values {
+			replay.Header.Add(key, value)
+		}
+	}
+	if _, err := js.PublishMsg(context.Background(), replay); err != nil {
+		return nil, fmt.Errorf("error al reenviar el mensaje %d a %s: %w", seq, deadLetter.Subject, err)
+	}
+	if err := dlq.DeleteMsg(context.Background(), seq); err != nil {
+		return &deadLetter, fmt.Errorf("el mensaje %d se reenvió pero no se pudo borrar del dead-letter: %w", seq, err)
+	}
+	return &deadLetter, nil
+}
+
+func toDeadLetter(raw *jetstream.RawStreamMsg) DeadLetter {
+	deliveries, _ := strconv.Atoi(raw.Header.Get(HeaderDlqDeliveries))
+	poison, _ := strconv.ParseBool(raw.Header.Get(HeaderDlqPoison))
+	failedAt, _ := time.Parse(time.RFC3339, raw.Header.Get(HeaderDlqFailedAt))
+	return DeadLetter{
+		Sequence:   raw.Sequence,
+		Stream:     raw.Header.Get(HeaderDlqStream),
+		Consumer:   raw.Header.Get(HeaderDlqConsumer),
+		Subject:    raw.Header.Get(HeaderDlqSubject),
+		Error:      raw.Header.Get(HeaderDlqError),
+		Deliveries: deliveries,
+		Poison:     poison,
+		FailedAt:   failedAt,
+		Data:       string(raw.Data),
+	}
+}
@@ -0,0 +1,159 @@
+package messaging_nats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"strconv"
+	"time"
+)
+
+// Headers del sobre de un evento, el cuerpo sigue siendo el JSON del payload así los consumidores sin sobre
+// pueden leerlo igual.
+const (
+	HeaderEventType      = "Event-Type"
+	HeaderEventVersion   = "Event-Version"
+	HeaderConciliatorId  = "Conciliator-Id"
+	HeaderEventProducer  = "Event-Producer"
+	HeaderEventTimestamp = "Event-Timestamp"
+)
+
+// legacyVersion es la versión que se asume para los mensajes publicados antes del sobre, sin Event-Version.
+const legacyVersion = 1
+
+// Envelope es un evento recibido con su payload ya decodificado en T.
+type Envelope[T any] struct {
+	Type          string
+	Version       int
+	ConciliatorId string
+	Producer      string
+	Timestamp     time.Time
+	Subject       string
+	Data          T
+	// Msg es el mensaje original, para la metadata de JetStream o RetryPolicy.Exhausted.
+	Msg jetstream.Msg
+}
+
+// EventType describe un evento: el subject donde se publica, la versión del esquema que publica este código y
+// desde qué versión lo puede leer.
+type EventType[T any] struct {
+	Subject string
+	Version int
+	// MinVersion es la versión más antigua que se acepta, las anteriores van al dead-letter como poison.
+	MinVersion int
+	// Upgrade convierte el cuerpo de una versión anterior a Version, si es nil se decodifica directo en T.
+	Upgrade func(version int, data []byte) (T, error)
+}
+
+// Publish publica data con el sobre del evento, esperando el ack del stream (ver SenderEventPort).
+func (event EventType[T]) Publish(sender SenderEventPort, conciliatorId string, data T) error {
+	return event.PublishWithId(sender, "", conciliatorId, data)
+}
+
+// PublishWithId publica con un Nats-Msg-Id propio para que el stream descarte los duplicados.
+func (event EventType[T]) PublishWithId(sender SenderEventPort, msgId string, conciliatorId string, data T) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("no se puede serializar el evento %s: %w", event.Subject, err)
+	}
+	msg := nats.NewMsg(event.Subject)
+	msg.Data = body
+	msg.Header.Set(HeaderEventType, event.Subject)
+	msg.Header.Set(HeaderEventVersion, strconv.Itoa(event.version()))
+	msg.Header.Set(HeaderEventTimestamp, time.Now().UTC().Format(time.RFC3339Nano))
+	if conciliatorId != "" {
+		msg.Header.Set(HeaderConciliatorId, conciliatorId)
+	}
+	if msgId != "" {
+		msg.Header.Set(nats.MsgIdHdr, msgId)
+	}
+	_, err = sender.ExecuteMsg(msg)
+	return err
+}
+
+// Decode lee el sobre y el payload. Una versión menor a MinVersion o un cuerpo inválido son poison; una versión
+// mayor a la soportada se reintenta, puede ser un productor desplegado antes que este consumidor.
+func (event EventType[T]) Decode(msg jetstream.Msg) (Envelope[T], error) {
+	envelope, err := event.decode(msg.Headers(), msg.Subject(), msg.Data())
+	envelope.Msg = msg
+	return envelope, err
+}
+
+func (event EventType[T]) decode(headers nats.Header, subject string, data []byte) (Envelope[T], error) {
+	envelope := Envelope[T]{
+		Type:          headers.Get(HeaderEventType),
+		Version:       legacyVersion,
+		ConciliatorId: headers.Get(HeaderConciliatorId),
+		Producer:      headers.Get(HeaderEventProducer),
+		Subject:       subject,
+	}
+	if envelope.Type == "" {
+		envelope.Type = subject
+	}
+	if value := headers.Get(HeaderEventVersion); value != "" {
+		version, err := strconv.Atoi(value)
+		if err != nil {
+			return envelope, Poison(fmt.Errorf("versión '%s' inválida en el evento %s", value, envelope.Type))
+		}
+		envelope.Version = version
+	}
+	if timestamp, err := time.Parse(time.RFC3339Nano, headers.Get(HeaderEventTimestamp)); err == nil {
+		envelope.Timestamp = timestamp
+	}
+	if envelope.Version > event.version() {
+		return envelope, fmt.Errorf("el evento %s viene en la versión %d y este servicio soporta hasta la %d", envelope.Type, envelope.Version, event.version())
+	}
+	if envelope.Version < event.MinVersion {
+		return envelope, Poison(fmt.Errorf("el evento %s viene en la versión %d, la mínima soportada es la %d", envelope.Type, envelope.Version, event.MinVersion))
+	}
+	var err error
+	if envelope.Version < event.version() && event.Upgrade != nil {
+		envelope.Data, err = event.Upgrade(envelope.Version, data)
+	} else {
+		err = json.Unmarshal(data, &envelope.Data)
+	}
+	if err != nil {
+		return envelope, Poison(fmt.Errorf("error al deserializar el evento %s versión %d: %w", envelope.Type, envelope.Version, err))
+	}
+	return envelope, nil
+}
+
+// Consume procesa el evento con HandlePool en el consumer declarado, el handler recibe el payload ya
+// decodificado y validado.
+func (event EventType[T]) Consume(ctx context.Context, listener ListenerEventPort, spec ConsumerSpec, handler func(envelope Envelope[T]) error) error {
+	if spec.Subject != event.Subject {
+		return fmt.Errorf("el consumer %s está declarado para %s y no para %s", spec.Durable, spec.Subject, event.Subject)
+	}
+	return listener.HandlePool(ctx, spec, func(msg jetstream.Msg) error {
+		envelope, err := event.Decode(msg)
+		if err != nil {
+			return err
+		}
+		return handler(envelope)
+	})
+}
+
+// Subscribe recibe con una suscripción core los eventos que se publiquen desde ahora, sin consumer ni Ack, así
+// se puede observar el subject sin competir con el consumer que los procesa. Con conciliatorId solo llegan los
+// de esa conciliación; los mensajes que no se pueden decodificar se descartan.
+func (event EventType[T]) Subscribe(nc *nats.Conn, conciliatorId string, handler func(envelope Envelope[T])) (*nats.Subscription, error) {
+	return nc.Subscribe(event.Subject, func(msg *nats.Msg) {
+		if conciliatorId != "" && msg.Header.Get(HeaderConciliatorId) != conciliatorId {
+			return
+		}
+		envelope, err := event.decode(msg.Header, msg.Subject, msg.Data)
+		if err != nil {
+			return
+		}
+		handler(envelope)
+	})
+}
+
+func (event EventType[T]) version() int {
+	if event.Version <= 0 {
+		return legacyVersion
+	}
+	return event.Version
+}
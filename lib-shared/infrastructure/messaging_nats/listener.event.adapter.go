@@ -2,21 +2,35 @@ package messaging_nats
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/nats-io/nats.go/jetstream"
 	"lib-shared/utils"
-	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
+// fetchMaxWait es lo máximo que un Fetch espera mensajes, acota cuánto tarda el loop en ver la cancelación.
+const fetchMaxWait = 5 * time.Second
+
+// ErrHandlersRunning indica que Wait venció con handlers todavía en ejecución, las conexiones que usan no
+// deberían cerrarse.
+var ErrHandlersRunning = errors.New("handlers en ejecución")
+
 type ListenerEventAdapter struct {
 	NatsModuleManager *NatsModuleManager
+	loops             sync.WaitGroup
+	handlers          sync.WaitGroup
+	mu                sync.Mutex
+	// mensajes entregados que todavía no terminaron su handler, con la cantidad de handlers abiertos
+	inFlight map[jetstream.Msg]int
 }
 
 func NewListenerEventAdapter(manager *NatsModuleManager) ListenerEventPort {
 	return &ListenerEventAdapter{
 		NatsModuleManager: manager,
+		inFlight:          make(map[jetstream.Msg]int),
 	}
 }
 
@@ -25,75 +39,233 @@ func (listener *ListenerEventAdapter) getContext() context.Context {
 }
 
 func (listener *ListenerEventAdapter) Execute(
+	ctx context.Context,
 	streamName string,
-	exit <-chan os.Signal,
 	batch int,
 	eventName string,
 	durable string,
 	execute func(msg jetstream.Msg),
 ) error {
 	eventName = strings.ToLower(eventName)
-	stream, err := listener.NatsModuleManager.GetJetStream().Stream(context.Background(), streamName)
+	consume, err := listener.createConsumer(streamName, consumerConfig(eventName, durable))
+	if err != nil {
+		return err
+	}
+	listener.consume(ctx, consume, batch, eventName, execute)
+	return nil
+}
+
+func (listener *ListenerEventAdapter) Handle(
+	ctx context.Context,
+	streamName string,
+	batch int,
+	eventName string,
+	durable string,
+	policy RetryPolicy,
+	handler HandlerFunc,
+) error {
+	eventName = strings.ToLower(eventName)
+	if err := ensureDeadLetterStream(listener.NatsModuleManager.GetJetStream()); err != nil {
+		return err
+	}
+	config := consumerConfig(eventName, durable)
+	// una entrega más que la política: si no se pudo publicar en el dead-letter el mensaje vuelve una vez más
+	config.MaxDeliver = policy.maxDeliver() + 1
+	consume, err := listener.createConsumer(streamName, config)
 	if err != nil {
-		return fmt.Errorf("error al acceder al stream '%s': %w", streamName, err)
+		return err
 	}
-	consume, err := stream.CreateOrUpdateConsumer(
-		context.Background(),
-		jetstream.ConsumerConfig{
-			Durable:        durable,
-			Description:    "",
-			DeliverPolicy:  jetstream.DeliverAllPolicy,
-			AckPolicy:      jetstream.AckExplicitPolicy,
-			FilterSubjects: []string{eventName},
-			AckWait:        1 * time.Hour,
-		})
+	listener.consume(ctx, consume, batch, eventName, func(msg jetstream.Msg) {
+		listener.resolve(streamName, durable, policy, msg, handler(msg))
+	})
+	return nil
+}
 
+func (listener *ListenerEventAdapter) HandlePool(ctx context.Context, spec ConsumerSpec, handler HandlerFunc) error {
+	if err := ensureDeadLetterStream(listener.NatsModuleManager.GetJetStream()); err != nil {
+		return err
+	}
+	consume, err := listener.createConsumer(spec.Stream, spec.config())
 	if err != nil {
 		return err
 	}
-	utils.Info.Println(fmt.Sprintf("listening event [%s]", eventName))
+	interval := spec.Pool.ackWait() / 3
+	listener.consumePool(ctx, consume, spec.Pool.workers(), spec.Subject, func(msg jetstream.Msg) {
+		stop := heartbeat(msg, interval)
+		err := handler(msg)
+		stop()
+		listener.resolve(spec.Stream, spec.Durable, spec.Policy, msg, err)
+	})
+	return nil
+}
+
+// resolve hace Ack si el handler terminó bien, NAK con la espera de la política si el error es reintentable,
+// o publica el mensaje en el dead-letter y hace Term si es un poison o se agotaron las entregas.
+func (listener *ListenerEventAdapter) resolve(streamName string, durable string, policy RetryPolicy, msg jetstream.Msg, err error) {
+	if err == nil {
+		msg.Ack()
+		return
+	}
+	delivered := deliveries(msg)
+	if !IsPoison(err) && delivered < policy.maxDeliver() {
+		delay := policy.delay(delivered)
+		utils.Warning.Printf("[%s] entrega %d/%d falló, se reintenta en %s: %v\n", msg.Subject(), delivered, policy.maxDeliver(), delay, err)
+		msg.NakWithDelay(delay)
+		return
+	}
+	if dlqErr := publishDeadLetter(listener.NatsModuleManager.GetJetStream(), streamName, durable, msg, err, delivered); dlqErr != nil {
+		utils.Error.Printf("[%s] error al publicar en el dead-letter, se vuelve a entregar: %v\n", msg.Subject(), dlqErr)
+		msg.NakWithDelay(policy.delay(delivered))
+		return
+	}
+	utils.Error.Printf("[%s] mensaje enviado a %s después de %d entregas: %v\n", msg.Subject(), DeadLetterSubject(streamName), delivered, err)
+	msg.TermWithReason(err.Error())
+}
+
+// consumerConfig es el consumer de Execute y Handle, con una hora de AckWait para los handlers largos.
+func consumerConfig(eventName string, durable string) jetstream.ConsumerConfig {
+	return jetstream.ConsumerConfig{
+		Durable:        durable,
+		Description:    "",
+		DeliverPolicy:  jetstream.DeliverAllPolicy,
+		AckPolicy:      jetstream.AckExplicitPolicy,
+		FilterSubjects: []string{eventName},
+		AckWait:        1 * time.Hour,
+	}
+}
+
+func (listener *ListenerEventAdapter) createConsumer(streamName string, config jetstream.ConsumerConfig) (jetstream.Consumer, error) {
+	stream, err := listener.NatsModuleManager.GetJetStream().Stream(context.Background(), streamName)
+	if err != nil {
+		return nil, fmt.Errorf("error al acceder al stream '%s': %w", streamName, err)
+	}
+	consume, err := stream.CreateOrUpdateConsumer(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+	utils.Info.Println(fmt.Sprintf("listening event [%s]", strings.Join(config.FilterSubjects, ",")))
+	return consume, nil
+}
 
+func (listener *ListenerEventAdapter) consume(ctx context.Context, consume jetstream.Consumer, batch int, eventName string, execute func(msg jetstream.Msg)) {
+	listener.loops.Add(1)
 	go func() {
+		defer listener.loops.Done()
 		for {
-			select {
-			case <-exit:
-				utils.Info.Println("Se ha dejado de recibir datos")
-				break
-			default:
-				{
-					msg, err := consume.Fetch(batch)
-					if err != nil {
-						utils.Error.Println("Error en el consumidor de nats: ", err.Error())
-						continue
-					}
-					if msg.Error() != nil {
-						utils.Error.Println(msg.Error().Error())
-						continue
-					}
-
-					for msg := range msg.Messages() {
-						if err != nil {
-							utils.Error.Println("[pre-execute] error al obtener mensaje en el consumidor ", eventName, " err: ", err)
-						}
-						select {
-						case _ = <-exit:
-							utils.Info.Println("Se ha dejado de recibir datos")
-							break
-						default:
-							{
-								utils.Info.Println("[debug-nats] receiving new message (pre-execute)")
-								execute(msg)
-								if err != nil {
-									utils.Error.Println("[post-execute] error al obtener mensaje en el consumidor ", eventName, " err: ", err)
-								}
-							}
-						}
-					}
+			if ctx.Err() != nil {
+				utils.Info.Printf("[%s] se ha dejado de recibir datos\n", eventName)
+				return
+			}
+			messages, err := consume.Fetch(batch, jetstream.FetchMaxWait(fetchMaxWait))
+			if err != nil {
+				utils.Error.Println("Error en el consumidor de nats: ", err.Error())
+				time.Sleep(time.Second)
+				continue
+			}
+			for msg := range messages.Messages() {
+				if ctx.Err() != nil {
+					// el lote ya se entregó pero no se va a procesar, vuelve a la cola sin esperar el AckWait
+					msg.Nak()
+					continue
 				}
+				utils.Info.Println("[debug-nats] receiving new message (pre-execute)")
+				listener.track(msg)
+				execute(msg)
+				listener.release(msg)
+			}
+			if messages.Error() != nil {
+				utils.Error.Println("[post-execute] error al obtener mensajes en el consumidor ", eventName, " err: ", messages.Error())
 			}
+		}
+	}()
+}
 
+// consumePool pide a JetStream solo los mensajes que caben en los workers libres, así una réplica no retiene
+// mensajes que otra podría estar procesando.
+func (listener *ListenerEventAdapter) consumePool(ctx context.Context, consume jetstream.Consumer, workers int, eventName string, execute func(msg jetstream.Msg)) {
+	slots := make(chan struct{}, workers)
+	listener.loops.Add(1)
+	go func() {
+		defer listener.loops.Done()
+		for {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				utils.Info.Printf("[%s] se ha dejado de recibir datos\n", eventName)
+				return
+			}
+			// el loop es el único que ocupa workers, los libres solo pueden aumentar mientras se hace el Fetch
+			free := 1 + cap(slots) - len(slots)
+			messages, err := consume.Fetch(free, jetstream.FetchMaxWait(fetchMaxWait))
+			if err != nil {
+				<-slots
+				utils.Error.Println("Error en el consumidor de nats: ", err.Error())
+				time.Sleep(time.Second)
+				continue
+			}
+			reserved := true
+			for msg := range messages.Messages() {
+				if ctx.Err() != nil {
+					msg.Nak()
+					continue
+				}
+				if !reserved {
+					slots <- struct{}{}
+				}
+				reserved = false
+				listener.track(msg)
+				go func() {
+					defer func() { <-slots }()
+					defer listener.release(msg)
+					execute(msg)
+				}()
+			}
+			if reserved {
+				<-slots
+			}
+			if messages.Error() != nil {
+				utils.Error.Println("[post-execute] error al obtener mensajes en el consumidor ", eventName, " err: ", messages.Error())
+			}
 		}
 	}()
+}
+
+func (listener *ListenerEventAdapter) Wait(timeout time.Duration) error {
+	done := make(chan struct{})
+	go func() {
+		listener.loops.Wait()
+		listener.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+	}
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	for msg := range listener.inFlight {
+		// el handler sigue corriendo, su Ack posterior se ignora y otra réplica vuelve a recibir el mensaje
+		if err := msg.Nak(); err != nil {
+			utils.Error.Printf("[shutdown] error al devolver el mensaje %s: %v\n", msg.Subject(), err)
+		}
+	}
+	return fmt.Errorf("%w: %d mensajes seguían en proceso después de %s, se devolvieron con NAK", ErrHandlersRunning, len(listener.inFlight), timeout)
+}
+
+func (listener *ListenerEventAdapter) track(msg jetstream.Msg) {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	listener.inFlight[msg]++
+	listener.handlers.Add(1)
+}
 
-	return err
+func (listener *ListenerEventAdapter) release(msg jetstream.Msg) {
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	listener.inFlight[msg]--
+	if listener.inFlight[msg] <= 0 {
+		delete(listener.inFlight, msg)
+	}
+	listener.handlers.Done()
 }
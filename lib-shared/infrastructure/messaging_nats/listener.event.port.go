@@ -1,17 +1,36 @@
 package messaging_nats
 
 import (
+	"context"
 	"github.com/nats-io/nats.go/jetstream"
-	"os"
+	"time"
 )
 
 type ListenerEventPort interface {
+	// Execute crea o actualiza el consumer durable y consume en segundo plano hasta que se cancele ctx,
+	// los mensajes de un lote que no alcanzaron a procesarse se devuelven con NAK.
 	Execute(
+		ctx context.Context,
 		stream string,
-		exit <-chan os.Signal,
 		batch int,
 		eventName string,
 		durable string,
 		execute func(msg jetstream.Msg),
 	) error
+	// Handle consume como Execute pero el handler devuelve error: Ack si es nil, NAK con la espera de la política
+	// si es reintentable, y dead-letter más Term si es Poison o se agotaron las entregas.
+	Handle(
+		ctx context.Context,
+		stream string,
+		batch int,
+		eventName string,
+		durable string,
+		policy RetryPolicy,
+		handler HandlerFunc,
+	) error
+	// HandlePool resuelve los mensajes como Handle con el consumer declarado en spec, procesa hasta
+	// spec.Pool.Workers a la vez, cada uno en su goroutine y con heartbeats InProgress mientras el handler corre.
+	HandlePool(ctx context.Context, spec ConsumerSpec, handler HandlerFunc) error
+	// Wait espera que terminen los loops de consumo y los mensajes en proceso, al vencer timeout les hace NAK.
+	Wait(timeout time.Duration) error
 }
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"lib-shared/utils"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -15,121 +17,77 @@ type NatsStarter struct {
 	ManagerDataNats *NatsModuleManager
 	EventSender     SenderEventPort
 	EventListener   ListenerEventPort
+	buckets         *buckets
 }
 
+// drainWait es lo máximo que Shutdown espera a que la conexión termine de drenar
+const drainWait = 5 * time.Second
+
 type OptsNats struct {
-	NameStream string
-	Subjects   []string
-	MaxAge     time.Duration
+	// Topology se reconcilia al conectar, crea o actualiza los streams y consumers declarados.
+	Topology *Topology
+	// Producer es el nombre del servicio en los eventos que publica, por defecto el nombre del ejecutable.
+	Producer string
 }
 
-func NewStartNats(urlNats string, data *OptsNats) *NatsStarter {
+// NewStartNats se conecta a NATS, inicializa JetStream y reconcilia la topología de data. Reintenta
+// connection.ConnectAttempts veces y devuelve el último error, los servicios no pueden arrancar sin NATS.
+func NewStartNats(connection Connection, data *OptsNats) (*NatsStarter, error) {
 	ctx := context.Background()
-	for {
-		nc, err := nats.Connect(
-			urlNats,
-			nats.DontRandomize(),
-			nats.ReconnectWait(time.Second*3),
-			nats.MaxReconnects(-1),
-			nats.MaxPingsOutstanding(5),
-			nats.PingInterval(10*time.Second),
-		)
-		if err != nil {
-			utils.Error.Println("error al conectar a nats", err)
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		js, err := jetstream.New(nc)
-		if err != nil {
-			utils.Error.Println("error al inicializar jetstream en nats", err)
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		utils.Info.Println("connected to JetStream " + urlNats)
-		var stream jetstream.Stream
-		if data != nil {
-			utils.Info.Println("created or updated Stream to JetStream " + urlNats)
-			stream, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
-				Name:         data.NameStream,
-				Subjects:     data.Subjects,
-				MaxConsumers: -1,
-				Retention:    jetstream.WorkQueuePolicy,
-				MaxAge:       data.MaxAge, // 15 días
-			})
-			if err != nil {
-				utils.Error.Println("error al crear el STREAM "+data.NameStream+" en nats", err)
-				time.Sleep(1 * time.Second)
-				continue
-			}
+	producer := filepath.Base(os.Args[0])
+	if data != nil && data.Producer != "" {
+		producer = data.Producer
+	}
+	options, err := connection.options(producer)
+	if err != nil {
+		return nil, err
+	}
+	attempts := connection.attempts()
+	for attempt := 1; ; attempt++ {
+		var nc *nats.Conn
+		var js jetstream.JetStream
+		nc, js, err = connect(connection, options, data)
+		if err == nil {
+			utils.Info.Println("connected to JetStream " + connection.redactedURL())
+			DataNats := NewManager(nc, js, ctx, producer)
+			Sender := NewSenderEventAdapter(DataNats)
+			Listener := NewListenerEventAdapter(DataNats)
+			return &NatsStarter{
+				ManagerDataNats: DataNats,
+				EventSender:     Sender,
+				EventListener:   Listener,
+				buckets:         &buckets{handles: make(map[string]jetstream.KeyValue)},
+			}, nil
 		}
-
-		DataNats := NewManager(nc, js, stream, ctx)
-		Sender := NewSenderEventAdapter(DataNats)
-		Listener := NewListenerEventAdapter(DataNats)
-		return &NatsStarter{
-			ManagerDataNats: DataNats,
-			EventSender:     Sender,
-			EventListener:   Listener,
+		if attempt == attempts {
+			break
 		}
+		utils.Error.Printf("intento %d/%d de conexión a nats %s falló: %v\n", attempt, attempts, connection.redactedURL(), err)
+		time.Sleep(connection.wait())
 	}
+	return nil, fmt.Errorf("no se pudo conectar a nats %s después de %d intentos: %w", connection.redactedURL(), attempts, err)
 }
-func (st NatsStarter) GetMainStream() jetstream.Stream {
-	return st.ManagerDataNats.GetMainStream()
-}
-func (st NatsStarter) CreateIfNotExistBucket(bucketName string) jetstream.KeyValue {
-	js := st.ManagerDataNats.jetStream
-	bucket, err := js.KeyValue(context.Background(), bucketName)
-	if errors.Is(err, jetstream.ErrBucketNotFound) {
-		bucket, err = js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{
-			Bucket:      bucketName,
-			Description: "",
-			TTL:         2 * time.Hour,
-			Storage:     jetstream.FileStorage,
-			Compression: true,
-		})
-		if err != nil {
-			utils.Error.Println(fmt.Sprintf("error al crear el bucket %s", bucketName), err)
-			return nil
-		}
-		utils.Info.Println(fmt.Sprintf("bucket creado en nats con nombre %s", bucketName))
-		return bucket
-	}
+
+// connect abre la conexión y reconcilia la topología, si algo falla la conexión queda cerrada.
+func connect(connection Connection, options []nats.Option, data *OptsNats) (*nats.Conn, jetstream.JetStream, error) {
+	nc, err := nats.Connect(connection.URL, options...)
 	if err != nil {
-		utils.Error.Println(fmt.Sprintf("error al crear el bucket %s: ", bucketName), err)
-		return nil
-	}
-	utils.Info.Println(fmt.Sprintf("[retomando-bucket] el bucket ya existe devolviendo el Bucket %s", bucketName))
-	return bucket
-}
-func (st NatsStarter) AcquiredLock(bucketName, key string) (bool, error) {
-	bucket := st.CreateIfNotExistBucket(bucketName)
-	entry, err := bucket.Create(context.Background(), key, []byte(time.Now().String()))
-	if errors.Is(err, jetstream.ErrKeyExists) {
-		return false, nil // Lock already taken
+		return nil, nil, fmt.Errorf("error al conectar a nats: %w", err)
 	}
+	js, err := jetstream.New(nc)
 	if err != nil {
-		return false, fmt.Errorf("error trying to acquire lock for %s: %v", key, err)
+		nc.Close()
+		return nil, nil, fmt.Errorf("error al inicializar jetstream en nats: %w", err)
 	}
-	utils.Info.Printf("Lock acquired for %s: %v\n", key, entry)
-	return true, nil
-}
-func (st NatsStarter) AcquiredUnlock(bucketName, key string) error {
-	bucket := st.CreateIfNotExistBucket(bucketName)
-	err := bucket.Delete(context.Background(), key)
-	if err != nil {
-		return fmt.Errorf("error releasing lock for %s: %v", key, err)
+	if data != nil && data.Topology != nil {
+		if err := Reconcile(js, *data.Topology); err != nil {
+			nc.Close()
+			return nil, nil, err
+		}
 	}
-	return nil
+	return nc, js, nil
 }
-func (st NatsStarter) GetValueBucket(bucketName, key string) (string, error) {
-	bucket := st.CreateIfNotExistBucket(bucketName)
-	kve, err := bucket.Get(context.Background(), key)
-	if err != nil {
-		return "0", fmt.Errorf("error releasing lock for %s: %v", key, err)
-	}
 
-	return string(kve.Value()), nil
-}
 func (st NatsStarter) GetStream(streamName string) jetstream.Stream {
 	js := st.ManagerDataNats.jetStream
 	stream, err := js.Stream(context.Background(), streamName)
@@ -138,6 +96,31 @@ func (st NatsStarter) GetStream(streamName string) jetstream.Stream {
 	}
 	return stream
 }
+
+// Shutdown espera hasta timeout que los listeners terminen lo que tienen en proceso y después hace Drain de la
+// conexión, así los mensajes y acks pendientes se envían antes de cerrar. Los listeners se detienen cancelando
+// el contexto que recibió Execute.
+func (st NatsStarter) Shutdown(timeout time.Duration) error {
+	waitErr := st.EventListener.Wait(timeout)
+	client := st.ManagerDataNats.GetClient()
+	if client == nil {
+		return waitErr
+	}
+	if err := client.Drain(); err != nil {
+		client.Close()
+		return errors.Join(waitErr, fmt.Errorf("error al drenar la conexión a nats: %w", err))
+	}
+	deadline := time.Now().Add(drainWait)
+	for !client.IsClosed() {
+		if time.Now().After(deadline) {
+			client.Close()
+			return errors.Join(waitErr, fmt.Errorf("la conexión a nats no terminó de drenar en %s", drainWait))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	utils.Info.Println("conexión a nats drenada y cerrada")
+	return waitErr
+}
 func (st NatsStarter) Close() {
 	client := st.ManagerDataNats.GetClient()
 	if client != nil {
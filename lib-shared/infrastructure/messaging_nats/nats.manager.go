@@ -9,21 +9,21 @@ import (
 type NatsModuleManager struct {
 	natsClient *nats.Conn
 	jetStream  jetstream.JetStream
-	mainStream jetstream.Stream
 	ctx        context.Context
+	producer   string
 }
 
 func NewManager(
 	natsClient *nats.Conn,
 	jetStream jetstream.JetStream,
-	orderStream jetstream.Stream,
 	ctx context.Context,
+	producer string,
 ) *NatsModuleManager {
 	return &NatsModuleManager{
 		natsClient: natsClient,
 		jetStream:  jetStream,
-		mainStream: orderStream,
 		ctx:        ctx,
+		producer:   producer,
 	}
 }
 
@@ -35,10 +35,11 @@ func (manager NatsModuleManager) GetJetStream() jetstream.JetStream {
 	return manager.jetStream
 }
 
-func (manager NatsModuleManager) GetMainStream() jetstream.Stream {
-	return manager.mainStream
-}
-
 func (manager NatsModuleManager) GetContext() context.Context {
 	return manager.ctx
 }
+
+// GetProducer es el nombre del servicio que se publica en el header Event-Producer.
+func (manager NatsModuleManager) GetProducer() string {
+	return manager.producer
+}
@@ -0,0 +1,80 @@
+package messaging_nats
+
+import (
+	"errors"
+	"github.com/nats-io/nats.go/jetstream"
+	"time"
+)
+
+// HandlerFunc procesa un mensaje, el listener resuelve el Ack, NAK o Term según el error que devuelve.
+type HandlerFunc func(msg jetstream.Msg) error
+
+// RetryPolicy define cuántas veces se entrega un mensaje y cuánto se espera entre intentos.
+type RetryPolicy struct {
+	// MaxDeliver son las entregas antes de mandar el mensaje al dead-letter.
+	MaxDeliver int
+	// Backoff es la espera del NAK según el intento (el primer valor para la primera falla), el último se repite.
+	// No se configura como BackOff del consumer porque reemplazaría el AckWait de los handlers largos.
+	Backoff []time.Duration
+}
+
+// DefaultRetryPolicy reintenta cinco veces con esperas crecientes, en total unos 12 minutos.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxDeliver: 5,
+	Backoff:    []time.Duration{10 * time.Second, 30 * time.Second, 2 * time.Minute, 10 * time.Minute},
+}
+
+// Exhausted indica si el mensaje está en su última entrega, el handler lo usa para registrar el fallo definitivo.
+func (policy RetryPolicy) Exhausted(msg jetstream.Msg) bool {
+	return deliveries(msg) >= policy.maxDeliver()
+}
+
+func (policy RetryPolicy) maxDeliver() int {
+	if policy.MaxDeliver <= 0 {
+		return DefaultRetryPolicy.MaxDeliver
+	}
+	return policy.MaxDeliver
+}
+
+func (policy RetryPolicy) delay(delivered int) time.Duration {
+	backoff := policy.Backoff
+	if len(backoff) == 0 {
+		backoff = DefaultRetryPolicy.Backoff
+	}
+	if delivered < 1 {
+		delivered = 1
+	}
+	if delivered > len(backoff) {
+		return backoff[len(backoff)-1]
+	}
+	return backoff[delivered-1]
+}
+
+func deliveries(msg jetstream.Msg) int {
+	metadata, err := msg.Metadata()
+	if err != nil {
+		return 1
+	}
+	return int(metadata.NumDelivered)
+}
+
+type poisonError struct {
+	err error
+}
+
+func (e poisonError) Error() string { return e.err.Error() }
+func (e poisonError) Unwrap() error { return e.err }
+
+// Poison marca el error como no reintentable (p. ej. un mensaje que no se puede deserializar), el mensaje
+// va directo al dead-letter sin esperar las demás entregas.
+func Poison(err error) error {
+	if err == nil {
+		return nil
+	}
+	return poisonError{err: err}
+}
+
+func IsPoison(err error) bool {
+	var poison poisonError
+	return errors.As(err, &poison)
+}
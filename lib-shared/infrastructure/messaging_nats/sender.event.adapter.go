@@ -9,11 +9,19 @@ import (
 	"github.com/nats-io/nats.go/jetstream"
 	"google.golang.org/protobuf/proto"
 	utils3 "lib-shared/utils"
-	"log"
 	"strings"
 	"time"
 )
 
+const (
+	// tiempo máximo que se espera el ack del stream en cada intento
+	publishAckTimeout = 10 * time.Second
+	// intentos antes de devolver el error al llamador, con espera exponencial entre ellos
+	publishAttempts   = 5
+	publishBackoff    = 500 * time.Millisecond
+	publishMaxBackoff = 8 * time.Second
+)
+
 type SenderEventAdapter struct {
 	*NatsModuleManager
 }
@@ -26,69 +34,87 @@ func NewSenderEventAdapter(manager *NatsModuleManager) SenderEventPort {
 func (s SenderEventAdapter) Execute(event *Event) error {
 	dataByte, err := json.Marshal(event.Data)
 	if err != nil {
-		fmt.Println("Cannot serialize object", event.EventType, err.Error())
-		return nil
-	}
-	log.Println("sending " + event.EventType)
-	_, err = s.GetJetStream().PublishAsync(strings.ToLower(event.EventType), dataByte)
-	if err != nil {
-		return err
+		return fmt.Errorf("no se puede serializar el evento %s: %w", event.EventType, err)
 	}
-	return nil
+	utils3.Warning.Println("sending " + event.EventType)
+	return s.publish(nats.NewMsg(strings.ToLower(event.EventType)), dataByte, "")
 }
 
 func (s SenderEventAdapter) ExecuteMsg(msg *nats.Msg) (string, error) {
-	inbox, err := uuid.NewUUID()
-	if err != nil {
-		panic(err)
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
 	}
-	inboxAsString := inbox.String()
-	_, err = s.GetJetStream().PublishMsg(context.Background(), msg, jetstream.WithMsgID(inboxAsString))
-	if err != nil {
-		panic(err)
-		return "", err
+	if msg.Header.Get(HeaderEventProducer) == "" && s.GetProducer() != "" {
+		msg.Header.Set(HeaderEventProducer, s.GetProducer())
 	}
-	return inboxAsString, nil
-}
-func (s SenderEventAdapter) SendMsgBytes(event string, msg []byte) {
-	utils3.Warning.Println("[]bytes sending " + event)
-	retry := 0
-	for retry < 5 {
-		_, err := s.GetJetStream().Publish(context.Background(), strings.ToLower(event), msg)
+	msgId := msg.Header.Get(nats.MsgIdHdr)
+	if msgId == "" {
+		inbox, err := uuid.NewUUID()
 		if err != nil {
-			fmt.Println(err.Error())
-			retry++
-			time.Sleep(10 * time.Second)
-			continue
+			return "", err
 		}
-		break
+		msgId = inbox.String()
+	}
+	if err := s.publish(msg, msg.Data, msgId); err != nil {
+		return "", err
 	}
+	return msgId, nil
 }
-func (s SenderEventAdapter) SendMsgBytesJson(event string, msg interface{}) {
+func (s SenderEventAdapter) SendMsgBytes(event string, msg []byte) error {
+	utils3.Warning.Println("[]bytes sending " + event)
+	return s.publish(nats.NewMsg(strings.ToLower(event)), msg, "")
+}
+func (s SenderEventAdapter) SendMsgBytesWithId(event string, msgId string, msg []byte) error {
+	utils3.Warning.Println("[]bytes sending " + event + " id " + msgId)
+	return s.publish(nats.NewMsg(strings.ToLower(event)), msg, msgId)
+}
+func (s SenderEventAdapter) SendMsgBytesJson(event string, msg interface{}) error {
 	utils3.Warning.Println("[]interface sending " + event)
 	jsonBytes, err := json.Marshal(msg)
-	_, err = s.GetJetStream().PublishAsync(strings.ToLower(event), jsonBytes)
 	if err != nil {
-		fmt.Println(err.Error())
-		return
+		return fmt.Errorf("no se puede serializar el mensaje para %s: %w", event, err)
 	}
+	return s.publish(nats.NewMsg(strings.ToLower(event)), jsonBytes, "")
 }
-func (s SenderEventAdapter) SendMsgString(event string, msg string) {
-	dataByte := []byte(msg)
-	log.Println("[]string sending " + event)
-	_, err := s.GetJetStream().PublishAsync(strings.ToLower(event), dataByte)
+func (s SenderEventAdapter) SendMsgString(event string, msg string) error {
+	utils3.Warning.Println("[]string sending " + event)
+	return s.publish(nats.NewMsg(strings.ToLower(event)), []byte(msg), "")
+}
+func (s SenderEventAdapter) SendMsgPB(event string, message proto.Message) error {
+	dataByte, err := proto.Marshal(message)
 	if err != nil {
-		fmt.Println(err.Error())
-		return
+		return fmt.Errorf("no se puede serializar el mensaje para %s: %w", event, err)
 	}
+	utils3.Warning.Println("sending " + event)
+	return s.publish(nats.NewMsg(strings.ToLower(event)), dataByte, "")
 }
-func (s SenderEventAdapter) SendMsgPB(event string, message proto.Message) {
-	dataByte, _ := proto.Marshal(message)
 
-	_, err := s.GetJetStream().PublishAsync(strings.ToLower(event), dataByte)
-	if err != nil {
-		fmt.Println(err.Error())
-		return
+// publish espera el ack del stream y reintenta con espera exponencial. Todos los intentos llevan el mismo
+// Nats-Msg-Id, así un intento que el stream guardó pero cuyo ack se perdió no se duplica en el reintento.
+func (s SenderEventAdapter) publish(msg *nats.Msg, data []byte, msgId string) error {
+	if msgId == "" {
+		id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		msgId = id.String()
+	}
+	msg.Data = data
+	backoff := publishBackoff
+	var err error
+	for attempt := 1; attempt <= publishAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), publishAckTimeout)
+		_, err = s.GetJetStream().PublishMsg(ctx, msg, jetstream.WithMsgID(msgId))
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if attempt == publishAttempts {
+			break
+		}
+		utils3.Warning.Printf("[%s] intento %d/%d de publicación falló, se reintenta en %s: %v\n", msg.Subject, attempt, publishAttempts, backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, publishMaxBackoff)
 	}
-	log.Println("sending " + event)
+	return fmt.Errorf("no se pudo publicar en %s después de %d intentos: %w", msg.Subject, publishAttempts, err)
 }
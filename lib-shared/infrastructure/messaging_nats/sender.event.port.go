@@ -5,11 +5,17 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+// SenderEventPort publica en JetStream esperando el ack del stream, con reintentos. Un error significa que el
+// mensaje no quedó guardado y el llamador debe tratarlo como no enviado.
 type SenderEventPort interface {
 	Execute(event *Event) error
+	// ExecuteMsg usa el Nats-Msg-Id del mensaje o genera uno, y lo devuelve.
 	ExecuteMsg(msg *nats.Msg) (string, error)
-	SendMsgString(event string, msg string)
-	SendMsgBytes(event string, msg []byte)
-	SendMsgBytesJson(event string, msg interface{})
-	SendMsgPB(event string, message proto.Message)
+	SendMsgString(event string, msg string) error
+	SendMsgBytes(event string, msg []byte) error
+	// SendMsgBytesWithId publica con un Nats-Msg-Id propio, el stream descarta otro mensaje con el mismo id
+	// dentro de su ventana de duplicados.
+	SendMsgBytesWithId(event string, msgId string, msg []byte) error
+	SendMsgBytesJson(event string, msg interface{}) error
+	SendMsgPB(event string, message proto.Message) error
 }
@@ -0,0 +1,214 @@
+package messaging_nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go/jetstream"
+	"lib-shared/utils"
+	"strings"
+	"time"
+)
+
+// Topology declara los streams y consumers de JetStream que usan los servicios. Cada servicio la reconcilia al
+// conectarse, así no importa el orden de arranque y una diferencia de configuración se corrige o se reporta.
+type Topology struct {
+	Streams   []StreamSpec
+	Consumers []ConsumerSpec
+	Buckets   []BucketSpec
+}
+
+type StreamSpec struct {
+	Name      string
+	Subjects  []string
+	Retention jetstream.RetentionPolicy
+	MaxAge    time.Duration
+	Replicas  int
+}
+
+// ConsumerSpec es un consumer durable con su política de reintentos y el pool de workers que lo procesa.
+type ConsumerSpec struct {
+	Stream  string
+	Durable string
+	Subject string
+	Pool    WorkerPool
+	Policy  RetryPolicy
+}
+
+// Consumer devuelve el consumer declarado con ese durable.
+func (topology Topology) Consumer(durable string) (ConsumerSpec, error) {
+	for _, consumer := range topology.Consumers {
+		if consumer.Durable == durable {
+			return consumer, nil
+		}
+	}
+	return ConsumerSpec{}, fmt.Errorf("el consumer %s no está declarado en la topología", durable)
+}
+
+func (spec StreamSpec) config() jetstream.StreamConfig {
+	return jetstream.StreamConfig{
+		Name:         spec.Name,
+		Subjects:     spec.Subjects,
+		Retention:    spec.Retention,
+		Storage:      jetstream.FileStorage,
+		MaxConsumers: -1,
+		MaxAge:       spec.MaxAge,
+		Replicas:     max(spec.Replicas, 1),
+	}
+}
+
+func (spec ConsumerSpec) config() jetstream.ConsumerConfig {
+	return jetstream.ConsumerConfig{
+		Durable:        spec.Durable,
+		DeliverPolicy:  jetstream.DeliverAllPolicy,
+		AckPolicy:      jetstream.AckExplicitPolicy,
+		FilterSubjects: []string{spec.Subject},
+		AckWait:        spec.Pool.ackWait(),
+		// una entrega más que la política: si no se pudo publicar en el dead-letter el mensaje vuelve una vez más
+		MaxDeliver: spec.Policy.maxDeliver() + 1,
+	}
+}
+
+// Reconcile crea o actualiza los streams y consumers declarados. JetStream no permite cambiar algunos campos
+// (p. ej. la retención), en ese caso devuelve el error y el stream se debe migrar a mano.
+func Reconcile(js jetstream.JetStream, topology Topology) error {
+	ctx := context.Background()
+	for _, spec := range topology.Streams {
+		if _, err := js.CreateOrUpdateStream(ctx, spec.config()); err != nil {
+			return fmt.Errorf("error al reconciliar el stream %s: %w", spec.Name, err)
+		}
+	}
+	for _, spec := range topology.Consumers {
+		stream, err := js.Stream(ctx, spec.Stream)
+		if err != nil {
+			return fmt.Errorf("error al acceder al stream %s del consumer %s: %w", spec.Stream, spec.Durable, err)
+		}
+		if _, err := stream.CreateOrUpdateConsumer(ctx, spec.config()); err != nil {
+			return fmt.Errorf("error al reconciliar el consumer %s: %w", spec.Durable, err)
+		}
+	}
+	for _, spec := range topology.Buckets {
+		if _, err := js.CreateOrUpdateKeyValue(ctx, spec.config()); err != nil {
+			return fmt.Errorf("error al reconciliar el bucket %s: %w", spec.Name, err)
+		}
+	}
+	utils.Info.Printf("topología reconciliada: %d streams, %d consumers, %d buckets\n", len(topology.Streams), len(topology.Consumers), len(topology.Buckets))
+	return nil
+}
+
+// Diff compara la topología declarada con el estado de JetStream, cada línea es un cambio: "+" falta crearlo,
+// "~" tiene otra configuración y "?" existe pero no está declarado. Los buckets se comparan con su stream KV_.
+func Diff(js jetstream.JetStream, topology Topology) ([]string, error) {
+	ctx := context.Background()
+	changes := make([]string, 0)
+	declared := make(map[string]bool)
+	for _, spec := range topology.Streams {
+		declared[spec.Name] = true
+		stream, err := js.Stream(ctx, spec.Name)
+		if errors.Is(err, jetstream.ErrStreamNotFound) {
+			changes = append(changes, fmt.Sprintf("+ stream %s %v", spec.Name, spec.Subjects))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error al leer el stream %s: %w", spec.Name, err)
+		}
+		actual := stream.CachedInfo().Config
+		want := spec.config()
+		changes = appendChange(changes, "stream "+spec.Name, "subjects", actual.Subjects, want.Subjects)
+		changes = appendChange(changes, "stream "+spec.Name, "retention", actual.Retention, want.Retention)
+		changes = appendChange(changes, "stream "+spec.Name, "max_age", actual.MaxAge, want.MaxAge)
+		changes = appendChange(changes, "stream "+spec.Name, "replicas", actual.Replicas, want.Replicas)
+	}
+	for _, spec := range topology.Buckets {
+		declared[spec.streamName()] = true
+		stream, err := js.Stream(ctx, spec.streamName())
+		if errors.Is(err, jetstream.ErrStreamNotFound) {
+			changes = append(changes, fmt.Sprintf("+ bucket %s", spec.Name))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error al leer el bucket %s: %w", spec.Name, err)
+		}
+		actual := stream.CachedInfo().Config
+		want := spec.config()
+		changes = appendChange(changes, "bucket "+spec.Name, "ttl", actual.MaxAge, want.TTL)
+		changes = appendChange(changes, "bucket "+spec.Name, "history", actual.MaxMsgsPerSubject, int64(want.History))
+		changes = appendChange(changes, "bucket "+spec.Name, "replicas", actual.Replicas, want.Replicas)
+		changes = appendChange(changes, "bucket "+spec.Name, "storage", actual.Storage, want.Storage)
+	}
+	streams := js.StreamNames(ctx)
+	for name := range streams.Name() {
+		if declared[name] {
+			continue
+		}
+		if bucket, isBucket := strings.CutPrefix(name, "KV_"); isBucket {
+			changes = append(changes, fmt.Sprintf("? bucket %s no está declarado", bucket))
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("? stream %s no está declarado", name))
+	}
+	if err := streams.Err(); err != nil {
+		return nil, fmt.Errorf("error al listar los streams: %w", err)
+	}
+	declaredConsumers := make(map[string]map[string]bool)
+	for _, spec := range topology.Consumers {
+		if declaredConsumers[spec.Stream] == nil {
+			declaredConsumers[spec.Stream] = make(map[string]bool)
+		}
+		declaredConsumers[spec.Stream][spec.Durable] = true
+		stream, err := js.Stream(ctx, spec.Stream)
+		if errors.Is(err, jetstream.ErrStreamNotFound) {
+			changes = append(changes, fmt.Sprintf("+ consumer %s/%s %s", spec.Stream, spec.Durable, spec.Subject))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error al leer el stream %s: %w", spec.Stream, err)
+		}
+		consumer, err := stream.Consumer(ctx, spec.Durable)
+		if errors.Is(err, jetstream.ErrConsumerNotFound) {
+			changes = append(changes, fmt.Sprintf("+ consumer %s/%s %s", spec.Stream, spec.Durable, spec.Subject))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error al leer el consumer %s: %w", spec.Durable, err)
+		}
+		actual := consumer.CachedInfo().Config
+		want := spec.config()
+		name := "consumer " + spec.Stream + "/" + spec.Durable
+		actualSubjects := actual.FilterSubjects
+		if actual.FilterSubject != "" {
+			actualSubjects = append(actualSubjects, actual.FilterSubject)
+		}
+		changes = appendChange(changes, name, "filter_subjects", actualSubjects, want.FilterSubjects)
+		changes = appendChange(changes, name, "ack_wait", actual.AckWait, want.AckWait)
+		changes = appendChange(changes, name, "max_deliver", actual.MaxDeliver, want.MaxDeliver)
+	}
+	for _, spec := range topology.Streams {
+		streamName := spec.Name
+		durables, exists := declaredConsumers[streamName]
+		if !exists {
+			continue
+		}
+		stream, err := js.Stream(ctx, streamName)
+		if err != nil {
+			continue
+		}
+		names := stream.ConsumerNames(ctx)
+		for durable := range names.Name() {
+			if !durables[durable] {
+				changes = append(changes, fmt.Sprintf("? consumer %s/%s no está declarado", streamName, durable))
+			}
+		}
+		if err := names.Err(); err != nil {
+			return nil, fmt.Errorf("error al listar los consumers de %s: %w", streamName, err)
+		}
+	}
+	return changes, nil
+}
+
+func appendChange[T any](changes []string, name string, field string, actual T, want T) []string {
+	if fmt.Sprint(actual) == fmt.Sprint(want) {
+		return changes
+	}
+	return append(changes, fmt.Sprintf("~ %s %s: %v -> %v", name, field, actual, want))
+}
@@ -0,0 +1,61 @@
+package messaging_nats
+
+import (
+	"github.com/nats-io/nats.go/jetstream"
+	"lib-shared/utils"
+	"time"
+)
+
+// defaultPoolAckWait es el plazo sin heartbeat antes de que JetStream vuelva a entregar un mensaje, mucho menor
+// que la hora de Execute porque el handler avisa que sigue vivo con InProgress.
+const defaultPoolAckWait = 1 * time.Minute
+
+// WorkerPool define cuántos mensajes procesa a la vez una réplica y cada cuánto se renueva su AckWait.
+type WorkerPool struct {
+	// Workers es el máximo de mensajes en proceso por réplica, con 1 cada réplica toma un trabajo a la vez y
+	// los demás quedan disponibles para las otras réplicas.
+	Workers int
+	// AckWait se configura en el consumer, mientras el handler corre se envía InProgress cada AckWait/3. Si la
+	// réplica muere el mensaje vuelve a entregarse después de AckWait y no después de una hora.
+	AckWait time.Duration
+}
+
+func (pool WorkerPool) workers() int {
+	if pool.Workers <= 0 {
+		return 1
+	}
+	return pool.Workers
+}
+
+func (pool WorkerPool) ackWait() time.Duration {
+	if pool.AckWait <= 0 {
+		return defaultPoolAckWait
+	}
+	return pool.AckWait
+}
+
+// heartbeat envía InProgress cada interval hasta que se llame a la función devuelta, que vuelve cuando ya no
+// queda ningún InProgress en vuelo para no competir con el Ack.
+func heartbeat(msg jetstream.Msg, interval time.Duration) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := msg.InProgress(); err != nil {
+					utils.Warning.Printf("[%s] error al enviar InProgress: %v\n", msg.Subject(), err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
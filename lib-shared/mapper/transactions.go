@@ -2,9 +2,66 @@ package mapper
 
 import (
 	"lib-shared/sir_models"
+	"strings"
 	"time"
 )
 
+const (
+	ProviderKiosko         = "KIOSKO"
+	ProviderDatafast       = "DATAFAST"
+	ProviderDeunaPichincha = "DEUNA-PICHI"
+)
+
+// Estados de sincronización del pago contra ST_Transaccional.
+const (
+	SyncPending = "PENDING" // enviado a sir-writer, sin confirmar
+	SyncWritten = "WRITTEN" // confirmado por sir-writer
+	SyncFailed  = "FAILED"  // sir-writer descartó el wrapper
+	// sir-writer revirtió lo escrito por la conciliación, sirHash queda con lo que SIR tiene después del rollback
+	SyncRolledBack = "ROLLED_BACK"
+	// la fila no pasó la validación previa a SIR, syncError tiene el detalle
+	SyncQuarantined = "QUARANTINED"
+)
+
+// collectionsByProvider relaciona cada proveedor con su colección fetch-* en MongoDB.
+var collectionsByProvider = map[string]string{
+	ProviderKiosko:         "fetch-kioscos",
+	ProviderDatafast:       "fetch-datafast",
+	ProviderDeunaPichincha: "fetch-deunapichincha",
+}
+
+// CollectionName devuelve la colección fetch-* del proveedor o vacío si no se conoce.
+func CollectionName(provider string) string {
+	return collectionsByProvider[strings.ToUpper(strings.TrimSpace(provider))]
+}
+
+// providersByService relaciona el servicio de una solicitud de conciliación (Request.Service) con su proveedor.
+var providersByService = map[string]string{
+	"KIOSCO":   ProviderKiosko,
+	"DATAFAST": ProviderDatafast,
+}
+
+// ProviderForService devuelve el proveedor del servicio de una solicitud o vacío si no guarda pagos en MongoDB.
+func ProviderForService(service string) string {
+	return providersByService[strings.ToUpper(strings.TrimSpace(service))]
+}
+
+// ServiceForProvider devuelve el servicio con el que se solicita la conciliación del proveedor, vacío si no se
+// solicita desde api-central.
+func ServiceForProvider(provider string) string {
+	for service, current := range providersByService {
+		if current == strings.ToUpper(strings.TrimSpace(provider)) {
+			return service
+		}
+	}
+	return ""
+}
+
+// Providers devuelve los proveedores que guardan pagos en MongoDB.
+func Providers() []string {
+	return []string{ProviderKiosko, ProviderDatafast, ProviderDeunaPichincha}
+}
+
 type PaymentData struct {
 	Input  interface{}               `json:"input"  bson:"input"`
 	Output sir_models.StTransactions `json:"output" bson:"output"`
@@ -17,4 +74,59 @@ type Payment struct {
 	Provider      string      `json:"provider"  bson:"provider"`
 	CreatedAt     time.Time   `json:"createdAt"  bson:"createdAt"`
 	Data          PaymentData `json:"data"  bson:"data"`
+	// Los campos de sincronización se omiten vacíos para que SaveBulkModel no pise lo que confirmó sir-writer.
+	SyncStatus string     `json:"syncStatus,omitempty" bson:"syncStatus,omitempty"`
+	SirHash    string     `json:"sirHash,omitempty" bson:"sirHash,omitempty"`
+	SyncError  string     `json:"syncError,omitempty" bson:"syncError,omitempty"`
+	SyncedAt   *time.Time `json:"syncedAt,omitempty" bson:"syncedAt,omitempty"`
+	// Runs son los valores del pago en las últimas MaxPaymentRuns conciliaciones, el proveedor los agrega con
+	// $push porque el resto del documento se pisa en cada conciliación.
+	Runs []PaymentRun `json:"runs,omitempty" bson:"runs,omitempty"`
+}
+
+// MaxPaymentRuns es la cantidad de conciliaciones que se guardan por pago para comparar corridas de la misma fecha.
+const MaxPaymentRuns = 10
+
+// PaymentRun es el pago como lo obtuvo una conciliación.
+type PaymentRun struct {
+	ConciliatorId string                    `json:"conciliatorId" bson:"conciliatorId"`
+	Hash          string                    `json:"hash" bson:"hash"`
+	Output        sir_models.StTransactions `json:"output" bson:"output"`
+	CreatedAt     time.Time                 `json:"createdAt" bson:"createdAt"`
+}
+
+// Run es el valor del pago en la conciliación que lo está guardando.
+func (payment Payment) Run() PaymentRun {
+	return PaymentRun{
+		ConciliatorId: payment.ConciliatorId,
+		Hash:          payment.Hash,
+		Output:        payment.Data.Output,
+		CreatedAt:     payment.CreatedAt,
+	}
+}
+
+// ConfirmedHash devuelve el hash que SIR tiene confirmado para un pago guardado.
+// Los documentos previos al estado de sincronización no tienen syncStatus y se consideran escritos con su hash.
+func ConfirmedHash(hash, sirHash, syncStatus string) string {
+	if syncStatus == "" {
+		return hash
+	}
+	return sirHash
+}
+
+// InFlight indica que el INSERT de un pago se envió a sir-writer y todavía no se confirma, reenviarlo lo
+// escribiría dos veces. Lo resuelve sir-writer al aplicarlo o el reintento de los pendientes.
+func InFlight(sirHash, syncStatus string) bool {
+	return syncStatus == SyncPending && sirHash == ""
+}
+
+// ResolveOperation decide la operación a enviar a SIR comparando el hash nuevo con el confirmado.
+func ResolveOperation(newHash, confirmedHash string) string {
+	if confirmedHash == "" {
+		return "INSERT"
+	}
+	if strings.EqualFold(newHash, confirmedHash) {
+		return "IGNORE"
+	}
+	return "UPDATE"
 }
@@ -0,0 +1,57 @@
+package mapper
+
+import "testing"
+
+func TestConfirmedHash(t *testing.T) {
+	cases := []struct {
+		name       string
+		hash       string
+		sirHash    string
+		syncStatus string
+		expected   string
+	}{
+		{"previo al estado de sincronización", "abc", "", "", "abc"},
+		{"pendiente sin confirmar", "abc", "", SyncPending, ""},
+		{"pendiente de un UPDATE", "def", "abc", SyncPending, "abc"},
+		{"escrito", "abc", "abc", SyncWritten, "abc"},
+		{"fallido", "def", "abc", SyncFailed, "abc"},
+	}
+	for _, c := range cases {
+		if got := ConfirmedHash(c.hash, c.sirHash, c.syncStatus); got != c.expected {
+			t.Errorf("%s: se esperaba %q, se obtuvo %q", c.name, c.expected, got)
+		}
+	}
+}
+
+func TestResolveOperation(t *testing.T) {
+	cases := []struct {
+		newHash       string
+		confirmedHash string
+		expected      string
+	}{
+		{"abc", "", "INSERT"},
+		{"abc", "abc", "IGNORE"},
+		{"ABC", "abc", "IGNORE"},
+		{"def", "abc", "UPDATE"},
+	}
+	for _, c := range cases {
+		if got := ResolveOperation(c.newHash, c.confirmedHash); got != c.expected {
+			t.Errorf("ResolveOperation(%q, %q): se esperaba %s, se obtuvo %s", c.newHash, c.confirmedHash, c.expected, got)
+		}
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	if !InFlight("", SyncPending) {
+		t.Error("un INSERT pendiente está en proceso")
+	}
+	if InFlight("abc", SyncPending) {
+		t.Error("un UPDATE pendiente ya tiene la fila en SIR")
+	}
+	if InFlight("", "") {
+		t.Error("un pago previo al estado de sincronización ya está escrito")
+	}
+	if InFlight("", SyncFailed) {
+		t.Error("un pago fallido lo reenvía el reintento")
+	}
+}
@@ -0,0 +1,40 @@
+package reports_models
+
+import "time"
+
+// StoreStatus es el resultado de consultar un local en una conciliación.
+type StoreStatus string
+
+const (
+	// StoreOk devolvió pagos y al menos uno se pudo mapear.
+	StoreOk StoreStatus = "ok"
+	// StoreUnreachable no respondió o respondió algo que no se pudo leer.
+	StoreUnreachable StoreStatus = "unreachable"
+	// StoreAuthFailed rechazó el login con las credenciales de KioskoWs.
+	StoreAuthFailed StoreStatus = "auth_failed"
+	// StoreUnmapped devolvió pagos pero el local no tiene merchantId en el catálogo, ninguno se envió a SIR.
+	StoreUnmapped StoreStatus = "unmapped"
+	// StoreEmpty respondió sin pagos para el día.
+	StoreEmpty StoreStatus = "empty"
+)
+
+// StoreOutcome es el resultado de un local en una conciliación, cada proveedor publica uno por local de su
+// catálogo (KioskoWs en kioscos, MIDs_Restaurante en datafast) y uno por cada identificador que no está en él.
+// StoreId es el identificador del local en el catálogo del proveedor: idLocal en kioscos y MID en datafast.
+// DeUna Pichincha no publica resultados: corre como CronJob propio, sin solicitud de api-central ni conciliación
+// en report-system a la que asociarlos.
+type StoreOutcome struct {
+	ConciliatorId string      `json:"conciliatorId"        bson:"conciliatorId"`
+	Provider      string      `json:"provider"             bson:"provider"`
+	StoreId       string      `json:"storeId"              bson:"storeId"`
+	MerchantId    string      `json:"merchantId,omitempty" bson:"merchantId"`
+	Status        StoreStatus `json:"status"               bson:"status"`
+	Reason        string      `json:"reason,omitempty"     bson:"reason,omitempty"`
+	// Received son los pagos que devolvió el proveedor y Unmapped los que se descartaron por no tener merchantId.
+	Received int       `json:"received" bson:"received"`
+	Unmapped int       `json:"unmapped" bson:"unmapped"`
+	Inserted uint32    `json:"inserted" bson:"inserted"`
+	Updated  uint32    `json:"updated"  bson:"updated"`
+	Ignored  uint32    `json:"ignored"  bson:"ignored"`
+	At       time.Time `json:"at"       bson:"at"`
+}
@@ -0,0 +1,15 @@
+package reports_models
+
+import "lib-shared/infrastructure/messaging_nats"
+
+// Eventos que consume report-system en el stream conciliador-tarjetas-report.
+var (
+	NewReportEvent         = messaging_nats.EventType[ReportConciliator]{Subject: "new.data.report", Version: 1}
+	AddReportEvent         = messaging_nats.EventType[ReportData]{Subject: "add.data.report", Version: 1}
+	StartedReportEvent     = messaging_nats.EventType[StartedReport]{Subject: "started.data.report", Version: 1}
+	CompletedReportEvent   = messaging_nats.EventType[CompletedReport]{Subject: "completed.data.report", Version: 1}
+	SirWriteReportEvent    = messaging_nats.EventType[SirWriteReport]{Subject: "sir.data.report", Version: 1}
+	SirRollbackReportEvent = messaging_nats.EventType[SirRollbackReport]{Subject: "rollback.data.report", Version: 1}
+	RunStatusReportEvent   = messaging_nats.EventType[RunStatusReport]{Subject: "status.data.report", Version: 1}
+	StoreOutcomeEvent      = messaging_nats.EventType[StoreOutcome]{Subject: "store.data.report", Version: 1}
+)
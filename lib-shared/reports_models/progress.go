@@ -0,0 +1,72 @@
+package reports_models
+
+import (
+	"math"
+	"time"
+)
+
+// Progress es el avance de una conciliación que el proveedor guarda en el bucket de progreso con el id de la
+// conciliación, report-system lo devuelve tal cual en el detalle mientras la conciliación no termina.
+type Progress struct {
+	ConciliatorId string `json:"conciliator_id"`
+	Provider      string `json:"provider"`
+	Stage         string `json:"stage"`
+	// StageIndex empieza en 1, StageTotal es la cantidad de etapas del proveedor.
+	StageIndex int `json:"stage_index"`
+	StageTotal int `json:"stage_total"`
+	// Done y Total son los elementos (pagos, batches, locales) de la etapa actual.
+	Done  int `json:"done"`
+	Total int `json:"total"`
+	// Percent es el avance de toda la conciliación, cada etapa pesa lo mismo.
+	Percent   float64   `json:"percent"`
+	Store     string    `json:"store,omitempty"`
+	Batch     string    `json:"batch,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewProgress(conciliatorId string, provider string, stageTotal int) *Progress {
+	return &Progress{
+		ConciliatorId: conciliatorId,
+		Provider:      provider,
+		StageTotal:    max(stageTotal, 1),
+		UpdatedAt:     time.Now(),
+	}
+}
+
+// StartStage pasa a la etapa index con total elementos por procesar.
+func (progress *Progress) StartStage(index int, stage string, total int) {
+	progress.StageIndex = index
+	progress.Stage = stage
+	progress.Done = 0
+	progress.Total = total
+	progress.Store = ""
+	progress.Batch = ""
+	progress.update()
+}
+
+// Advance registra done elementos procesados de la etapa actual.
+func (progress *Progress) Advance(done int) {
+	progress.Done = done
+	progress.update()
+}
+
+// Finish deja la conciliación al 100%, en la última etapa.
+func (progress *Progress) Finish() {
+	progress.StageIndex = progress.StageTotal
+	progress.Done = progress.Total
+	progress.Store = ""
+	progress.Batch = ""
+	progress.Percent = 100
+	progress.UpdatedAt = time.Now()
+}
+
+func (progress *Progress) update() {
+	stage := 0.0
+	if progress.Total > 0 {
+		stage = float64(progress.Done) / float64(progress.Total)
+	}
+	completedStages := float64(max(progress.StageIndex-1, 0))
+	percent := (completedStages + stage) / float64(progress.StageTotal) * 100
+	progress.Percent = math.Round(min(percent, 100)*100) / 100
+	progress.UpdatedAt = time.Now()
+}
@@ -8,13 +8,21 @@ import (
 )
 
 type ReportConciliator struct {
-	ConciliatorId string         `json:"conciliatorId" bson:"conciliatorId"`
-	CreatedAt     time.Time      `json:"created_at" bson:"createdAt"`
-	StartedAt     *time.Time     `json:"started_at" bson:"startedAt"`
-	CompletedAt   *time.Time     `json:"completed_at" bson:"completedAt"`
-	ElapsedTime   int            `json:"elapsed_time" bson:"elapsedTime"`
-	Entries       *EntriesReport `json:"entries" bson:"entries"`
-	Request       Request        `json:"request" bson:"request"`
+	ConciliatorId       string             `json:"conciliatorId" bson:"conciliatorId"`
+	CreatedAt           time.Time          `json:"created_at" bson:"createdAt"`
+	StartedAt           *time.Time         `json:"started_at" bson:"startedAt"`
+	ProviderCompletedAt *time.Time         `json:"provider_completed_at" bson:"providerCompletedAt"`
+	CompletedAt         *time.Time         `json:"completed_at" bson:"completedAt"`
+	ElapsedTime         int                `json:"elapsed_time" bson:"elapsedTime"`
+	Entries             *EntriesReport     `json:"entries" bson:"entries"`
+	Sir                 *SirEntriesReport  `json:"sir" bson:"sir,omitempty"`
+	Rollback            *SirRollbackReport `json:"rollback" bson:"rollback,omitempty"`
+	Request             Request            `json:"request" bson:"request"`
+	// Status lo cambia report-system con los eventos de estado, StatusHistory guarda cada transición.
+	Status          RunStatus       `json:"status" bson:"status"`
+	StatusReason    string          `json:"status_reason,omitempty" bson:"statusReason,omitempty"`
+	StatusUpdatedAt *time.Time      `json:"status_updated_at" bson:"statusUpdatedAt"`
+	StatusHistory   []RunTransition `json:"status_history" bson:"statusHistory"`
 }
 type EntriesReport struct {
 	Inserted uint32 `json:"inserted"`
@@ -22,6 +30,17 @@ type EntriesReport struct {
 	Ignored  uint32 `json:"ignored"`
 }
 
+// SirEntriesReport acumula lo que sir-writer confirmó realmente en ST_Transaccional para la conciliación.
+type SirEntriesReport struct {
+	Wrappers        uint32 `json:"wrappers" bson:"wrappers"`                // wrappers enviados por el proveedor
+	AppliedWrappers uint32 `json:"applied_wrappers" bson:"appliedWrappers"` // wrappers confirmados en SIR
+	FailedWrappers  uint32 `json:"failed_wrappers" bson:"failedWrappers"`   // wrappers descartados por error
+	Written         uint32 `json:"written" bson:"written"`
+	Failed          uint32 `json:"failed" bson:"failed"`
+	Quarantined     uint32 `json:"quarantined" bson:"quarantined"`      // filas que no pasaron la validación previa a SIR
+	PublishFailed   uint32 `json:"publish_failed" bson:"publishFailed"` // wrappers que el proveedor no pudo publicar
+}
+
 // GetCreatedAtFormatted devuelve la fecha de creación formateada en español para la zona horaria "America/Guayaquil".
 func (r *ReportConciliator) GetCreatedAtFormatted(timeZone string) string {
 	return formatDateInSpanish(r.CreatedAt, timeZone)
@@ -95,10 +114,17 @@ type ReportConciliatorJsonResponse struct {
 	CreatedAt     string                     `json:"created_at"`
 	StartedAt     string                     `json:"started_at"`
 	CompletedAt   string                     `json:"completed_at" `
+	Status        RunStatus                  `json:"status"`
+	StatusReason  string                     `json:"status_reason,omitempty"`
+	StatusHistory []RunTransition            `json:"status_history"`
 	ElapsedTime   string                     `json:"elapsed_time"`
 	Entries       *ReportEntriesJsonResponse `json:"entries"`
-	Request       Request                    `json:"request"`
-	ReportData    []ReportDataBson           `json:"report_data"`
+	Sir           *SirEntriesReport          `json:"sir"`
+	Rollback      *SirRollbackReport         `json:"rollback"`
+	// Progress es el último progreso del proveedor mientras la conciliación no termina.
+	Progress   *Progress        `json:"progress,omitempty"`
+	Request    Request          `json:"request"`
+	ReportData []ReportDataBson `json:"report_data"`
 }
 type ReportEntriesJsonResponse struct {
 	Inserted uint32 `json:"inserted"`
@@ -128,22 +154,69 @@ type CompletedReport struct {
 	CompletedAt   time.Time              `json:"completedAt" `
 	Entries       EntriesCompletedReport `json:"entries" `
 	ElapsedTime   uint32                 `json:"elapsedTime"`
+	Wrappers      uint32                 `json:"wrappers"` // wrappers publicados a sir.writer.*
+	// wrappers que no se pudieron publicar, sus pagos quedan PENDING para el reintento de sir-writer
+	PublishFailed uint32 `json:"publishFailed"`
 }
 type EntriesCompletedReport struct {
 	Inserted uint32 `json:"inserted"`
 	Updated  uint32 `json:"updated"`
 	Ignored  uint32 `json:"ignored"`
 }
+
+// SirWriteReport es el resultado de aplicar un WrapperTransactions en SIR, lo publica sir-writer en sir.data.report.
+type SirWriteReport struct {
+	ConciliatorId string          `json:"conciliatorId" bson:"conciliatorId"`
+	WrapperId     string          `json:"wrapperId" bson:"wrapperId"`
+	Status        string          `json:"status" bson:"status"` // APPLIED, FAILED
+	Inserted      uint32          `json:"inserted" bson:"inserted"`
+	Updated       uint32          `json:"updated" bson:"updated"`
+	Deleted       uint32          `json:"deleted" bson:"deleted"`
+	Failed        uint32          `json:"failed" bson:"failed"`
+	Quarantined   uint32          `json:"quarantined" bson:"quarantined"`
+	Errors        []SirWriteError `json:"errors" bson:"errors"`
+	// filas que sir-writer dejó en cuarentena, Message tiene las violaciones de la validación
+	Quarantine []SirWriteError `json:"quarantine,omitempty" bson:"quarantine,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt" bson:"createdAt"`
+}
+type SirWriteError struct {
+	UniqueId  string `json:"uniqueId" bson:"uniqueId"`
+	Operation string `json:"operation" bson:"operation"`
+	Message   string `json:"message" bson:"message"`
+}
+
+const (
+	SirWriteApplied = "APPLIED"
+	SirWriteFailed  = "FAILED"
+)
+
+func (receiver SirWriteReport) Written() uint32 {
+	return receiver.Inserted + receiver.Updated + receiver.Deleted
+}
+
+// SirRollbackReport es el resultado de revertir en SIR lo escrito por una conciliación.
+type SirRollbackReport struct {
+	ConciliatorId string    `json:"conciliatorId" bson:"conciliatorId"`
+	RollbackId    string    `json:"rollbackId" bson:"rollbackId"`
+	Status        string    `json:"status" bson:"status"` // APPLIED, FAILED
+	Reason        string    `json:"reason" bson:"reason"`
+	Reverted      uint32    `json:"reverted" bson:"reverted"` // cambios del journal revertidos
+	Deleted       uint32    `json:"deleted" bson:"deleted"`   // filas insertadas por la conciliación que se eliminaron
+	Restored      uint32    `json:"restored" bson:"restored"` // filas devueltas a su imagen anterior
+	Error         string    `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt     time.Time `json:"createdAt" bson:"createdAt"`
+}
+
 type ReportData struct {
 	ConciliatorId string    `json:"conciliator_id" bson:"conciliatorId"`
-	Type          string    `json:"type" bson:"type"` // ERROR, INFO
+	Type          string    `json:"type" bson:"type"` // ERROR, WARNING, INFO
 	Message       string    `json:"message" bson:"message"`
 	Metadata      Metadata  `json:"metadata" bson:"metadata"`
 	CreatedAt     time.Time `json:"created_at" bson:"createdAt"`
 }
 type ReportDataBson struct {
 	ConciliatorId string       `json:"conciliator_id" bson:"conciliatorId"`
-	Type          string       `json:"type" bson:"type"` // ERROR, INFO
+	Type          string       `json:"type" bson:"type"` // ERROR, WARNING, INFO
 	Message       string       `json:"message" bson:"message"`
 	Metadata      MetadataBson `json:"metadata" bson:"metadata"`
 	CreatedAt     time.Time    `json:"created_at" bson:"createdAt"`
@@ -0,0 +1,79 @@
+package reports_models
+
+import (
+	"slices"
+	"time"
+)
+
+// RunStatus es el estado de una conciliación, report-system solo lo cambia siguiendo runTransitions.
+type RunStatus string
+
+const (
+	// RunQueued es el estado al crear el reporte, antes de despachar la solicitud al proveedor.
+	RunQueued     RunStatus = "queued"
+	RunDispatched RunStatus = "dispatched"
+	RunRunning    RunStatus = "running"
+	RunCompleted  RunStatus = "completed"
+	// RunCompletedWithErrors terminó pero hubo registros con error, wrappers rechazados o sin publicar.
+	RunCompletedWithErrors RunStatus = "completed_with_errors"
+	// RunFailed es una conciliación que el proveedor abortó, sus totales no son un día vacío.
+	RunFailed RunStatus = "failed"
+	// RunCancelled es una conciliación que no llegó a ejecutarse.
+	RunCancelled RunStatus = "cancelled"
+	// RunTimedOut la marca el watchdog de report-system si sigue en ejecución pasado el límite.
+	RunTimedOut RunStatus = "timed_out"
+)
+
+// runTransitions son los estados a los que se puede pasar desde cada estado. Una conciliación vencida todavía
+// puede terminar si el proveedor informa tarde.
+var runTransitions = map[RunStatus][]RunStatus{
+	RunQueued:     {RunDispatched, RunRunning, RunCompleted, RunCompletedWithErrors, RunFailed, RunCancelled, RunTimedOut},
+	RunDispatched: {RunRunning, RunCompleted, RunCompletedWithErrors, RunFailed, RunCancelled, RunTimedOut},
+	RunRunning:    {RunCompleted, RunCompletedWithErrors, RunFailed, RunCancelled, RunTimedOut},
+	RunTimedOut:   {RunCompleted, RunCompletedWithErrors, RunFailed},
+}
+
+// CanTransition indica si se puede pasar de status a next.
+func (status RunStatus) CanTransition(next RunStatus) bool {
+	return slices.Contains(runTransitions[status], next)
+}
+
+// Terminal indica si la conciliación ya no va a cambiar de estado por sí sola.
+func (status RunStatus) Terminal() bool {
+	switch status {
+	case RunCompleted, RunCompletedWithErrors, RunFailed, RunCancelled, RunTimedOut:
+		return true
+	}
+	return false
+}
+
+// RunStatusFrom son los estados desde los que se puede pasar a next, para filtrar la actualización en Mongo.
+func RunStatusFrom(next RunStatus) []RunStatus {
+	from := make([]RunStatus, 0)
+	for status, transitions := range runTransitions {
+		if slices.Contains(transitions, next) {
+			from = append(from, status)
+		}
+	}
+	slices.Sort(from)
+	return from
+}
+
+// RunTransition es un cambio de estado con su motivo, el reporte guarda el historial completo.
+type RunTransition struct {
+	Status RunStatus `json:"status" bson:"status"`
+	Reason string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	At     time.Time `json:"at" bson:"at"`
+}
+
+// RunStatusReport es el evento con el que api-central y los proveedores informan un cambio de estado.
+type RunStatusReport struct {
+	ConciliatorId string    `json:"conciliatorId"`
+	Status        RunStatus `json:"status"`
+	Reason        string    `json:"reason"`
+	At            time.Time `json:"at"`
+}
+
+func (report RunStatusReport) Transition() RunTransition {
+	return RunTransition{Status: report.Status, Reason: report.Reason, At: report.At}
+}
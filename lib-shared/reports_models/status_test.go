@@ -0,0 +1,50 @@
+package reports_models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRunStatusFrom(t *testing.T) {
+	cases := map[RunStatus][]RunStatus{
+		RunDispatched: {RunQueued},
+		RunRunning:    {RunDispatched, RunQueued},
+		// una conciliación vencida todavía puede terminar
+		RunCompleted: {RunDispatched, RunQueued, RunRunning, RunTimedOut},
+		RunFailed:    {RunDispatched, RunQueued, RunRunning, RunTimedOut},
+		RunCancelled: {RunDispatched, RunQueued, RunRunning},
+		RunTimedOut:  {RunDispatched, RunQueued, RunRunning},
+		RunQueued:    {},
+	}
+	for next, expected := range cases {
+		if got := RunStatusFrom(next); !slices.Equal(got, expected) {
+			t.Errorf("RunStatusFrom(%s): se esperaba %v, se obtuvo %v", next, expected, got)
+		}
+	}
+}
+
+func TestRunStatusFromMatchesCanTransition(t *testing.T) {
+	statuses := []RunStatus{RunQueued, RunDispatched, RunRunning, RunCompleted, RunCompletedWithErrors, RunFailed, RunCancelled, RunTimedOut}
+	for _, next := range statuses {
+		from := RunStatusFrom(next)
+		for _, status := range statuses {
+			if slices.Contains(from, status) != status.CanTransition(next) {
+				t.Errorf("RunStatusFrom(%s) y %s.CanTransition no coinciden", next, status)
+			}
+		}
+	}
+}
+
+func TestTerminalStatusesOnlyLeaveTimedOut(t *testing.T) {
+	statuses := []RunStatus{RunQueued, RunDispatched, RunRunning, RunCompleted, RunCompletedWithErrors, RunFailed, RunCancelled, RunTimedOut}
+	for _, status := range statuses {
+		if !status.Terminal() || status == RunTimedOut {
+			continue
+		}
+		for _, next := range statuses {
+			if status.CanTransition(next) {
+				t.Errorf("el estado terminal %s no debe pasar a %s", status, next)
+			}
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package services_models
+
+import (
+	"lib-shared/infrastructure/messaging_nats"
+	"strings"
+)
+
+// DispatchEvent es la solicitud de conciliación que api-central despacha al servicio del proveedor, en el
+// stream conciliador-tarjetas-services.
+func DispatchEvent(service string) messaging_nats.EventType[ServiceMessageDate] {
+	return messaging_nats.EventType[ServiceMessageDate]{Subject: strings.ToLower(service) + ".services.dispatch", Version: 1}
+}
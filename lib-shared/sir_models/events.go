@@ -0,0 +1,11 @@
+package sir_models
+
+import "lib-shared/infrastructure/messaging_nats"
+
+// Eventos que consume sir-writer en el stream conciliador-tarjetas, los wrappers se publican con su Id como
+// Nats-Msg-Id.
+var (
+	TransactionsEvent = messaging_nats.EventType[WrapperTransactions]{Subject: "sir.writer.sttransaction", Version: 1}
+	VentasAppEvent    = messaging_nats.EventType[WrapperVentasApp]{Subject: "sir.writer.ventasapp", Version: 1}
+	RollbackEvent     = messaging_nats.EventType[RollbackRequest]{Subject: "sir.writer.rollback", Version: 1}
+)
@@ -0,0 +1,12 @@
+package sir_models
+
+import "time"
+
+// RollbackRequest pide a sir-writer revertir todo lo que escribió en SIR una conciliación.
+// Id se usa en el ledger de mensajes, así una redelivery no revierte dos veces.
+type RollbackRequest struct {
+	Id            string
+	ConciliatorId string
+	Reason        string
+	RequestedAt   time.Time
+}
@@ -4,16 +4,21 @@ import (
 	"crypto/sha3"
 	"encoding/hex"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 )
 
 type WrapperTransactions struct {
-	Id           string
-	Transactions []Transaction
+	Id            string
+	ConciliatorId string
+	Provider      string // proveedor dueño de los pagos, ver mapper.CollectionName
+	Transactions  []Transaction
 }
 type Transaction struct {
 	OperationType string // UPDATE, INSERT, DELETE
+	UniqueId      string // uniqueId del pago en la colección fetch-* del proveedor
+	Hash          string // hash del pago que se escribe en SIR
 	Data          StTransactions
 }
 type StTransactions struct {
@@ -94,3 +99,48 @@ func (transaction StTransactions) GetTransactionHash() string {
 	// Devolver el hash como una cadena hex
 	return hex.EncodeToString(hash.Sum(nil))
 }
+
+// FieldDiff es un campo de StTransactions con distinto valor entre dos versiones de un pago, Field es el nombre
+// JSON del campo.
+type FieldDiff struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// Diff devuelve los campos que cambiaron de transaction a other, en el orden de la estructura.
+func (transaction StTransactions) Diff(other StTransactions) []FieldDiff {
+	diffs := make([]FieldDiff, 0)
+	before := reflect.ValueOf(transaction)
+	after := reflect.ValueOf(other)
+	for i := 0; i < before.NumField(); i++ {
+		if before.Field(i).Equal(after.Field(i)) {
+			continue
+		}
+		field := before.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		diffs = append(diffs, FieldDiff{Field: name, Before: before.Field(i).Interface(), After: after.Field(i).Interface()})
+	}
+	return diffs
+}
+
+// DuplicateKey es la clave con la que se reconoce el mismo pago de tarjeta en dos proveedores (el reporte del
+// switch del kiosco y Datafast): fecha, merchantId, autorización, referencia y monto con dos decimales. Vacía si
+// el pago no trae autorización, sin ella no se puede afirmar que sea el mismo pago.
+func (transaction StTransactions) DuplicateKey() string {
+	authorization := strings.TrimSpace(transaction.NumeroAutorizacion)
+	if authorization == "" {
+		return ""
+	}
+	amount := strings.TrimSpace(transaction.FaceValue)
+	if value, err := strconv.ParseFloat(amount, 64); err == nil {
+		amount = strconv.FormatFloat(value, 'f', 2, 64)
+	}
+	return strings.Join([]string{
+		strings.TrimSpace(transaction.FechaTransaccion),
+		strings.ToUpper(strings.TrimSpace(transaction.MerchantId)),
+		authorization,
+		strings.TrimSpace(transaction.NumeroReferencia),
+		amount,
+	}, "|")
+}
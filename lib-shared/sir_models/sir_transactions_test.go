@@ -0,0 +1,48 @@
+package sir_models
+
+import "testing"
+
+func TestDuplicateKey(t *testing.T) {
+	datafast := StTransactions{
+		MerchantId:         "100000001",
+		FechaTransaccion:   "2024-05-10",
+		NumeroAutorizacion: "123456",
+		NumeroReferencia:   "000789",
+		FaceValue:          "10.5",
+	}
+	// el mismo pago informado por el kiosco con otro formato
+	kiosco := StTransactions{
+		MerchantId:         " 100000001 ",
+		FechaTransaccion:   "2024-05-10",
+		NumeroAutorizacion: "123456 ",
+		NumeroReferencia:   "000789",
+		FaceValue:          "10.50",
+		HoraTransaccion:    "101500",
+		IdGrupoTarjeta:     "VISA",
+	}
+	if datafast.DuplicateKey() != "2024-05-10|100000001|123456|000789|10.50" {
+		t.Fatalf("clave inesperada: %s", datafast.DuplicateKey())
+	}
+	if datafast.DuplicateKey() != kiosco.DuplicateKey() {
+		t.Fatalf("el mismo pago debe tener la misma clave: %s != %s", datafast.DuplicateKey(), kiosco.DuplicateKey())
+	}
+	other := datafast
+	other.FaceValue = "10.51"
+	if other.DuplicateKey() == datafast.DuplicateKey() {
+		t.Fatal("otro monto no es el mismo pago")
+	}
+}
+
+func TestDuplicateKeyWithoutAuthorization(t *testing.T) {
+	transaction := StTransactions{MerchantId: "100000001", FechaTransaccion: "2024-05-10", NumeroAutorizacion: "  ", FaceValue: "10.50"}
+	if key := transaction.DuplicateKey(); key != "" {
+		t.Fatalf("sin autorización no hay clave, se obtuvo %s", key)
+	}
+}
+
+func TestDuplicateKeyKeepsNonNumericAmount(t *testing.T) {
+	transaction := StTransactions{FechaTransaccion: "2024-05-10", MerchantId: "m", NumeroAutorizacion: "1", FaceValue: " N/A "}
+	if key := transaction.DuplicateKey(); key != "2024-05-10|M|1||N/A" {
+		t.Fatalf("clave inesperada: %s", key)
+	}
+}
@@ -0,0 +1,97 @@
+package sir_models
+
+import (
+	"crypto/sha3"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// WrapperVentasApp agrupa las ventas de app/delivery que se publican en sir.writer.ventasapp.
+type WrapperVentasApp struct {
+	Id            string
+	ConciliatorId string
+	Provider      string
+	Transactions  []VentasAppTransaction
+}
+type VentasAppTransaction struct {
+	OperationType string // UPDATE, INSERT, DELETE
+	UniqueId      string
+	Hash          string
+	Data          VentasApp
+}
+
+// VentasApp es una venta del canal app/delivery tal como se escribe en ST_VentasApp.
+type VentasApp struct {
+	MerchantId         string  `json:"merchantId"            bson:"merchantId"`
+	FechaTransaccion   string  `json:"fecha_Transaccion"     bson:"fecha_Transaccion"`
+	HoraTransaccion    string  `json:"hora_Transaccion"      bson:"hora_Transaccion"`
+	CodigoOrden        string  `json:"codigo_Orden"          bson:"codigo_Orden"`
+	Canal              string  `json:"canal"                 bson:"canal"`      // APP, DELIVERY
+	Plataforma         string  `json:"plataforma"            bson:"plataforma"` // app propia o agregador
+	Estado             string  `json:"estado"                bson:"estado"`
+	FormaPago          string  `json:"forma_Pago"            bson:"forma_Pago"`
+	IdGrupoTarjeta     string  `json:"id_Grupo_Tarjeta"      bson:"id_Grupo_Tarjeta"`
+	NumeroTarjetaMask  string  `json:"numero_Tarjeta_Mask"   bson:"numero_Tarjeta_Mask"`
+	NumeroAutorizacion string  `json:"numero_Autorizacion"   bson:"numero_Autorizacion"`
+	NumeroReferencia   string  `json:"numero_Referencia"     bson:"numero_Referencia"`
+	FaceValue          string  `json:"face_Value"            bson:"face_Value"`
+	Subtotal           float32 `json:"subtotal"              bson:"subtotal"`
+	Descuento          float32 `json:"descuento"             bson:"descuento"`
+	Iva                float32 `json:"iva"                   bson:"iva"`
+	Propina            float32 `json:"propina"               bson:"propina"`
+	CostoEnvio         float32 `json:"costoEnvio"            bson:"costoEnvio"`
+	Sistema            string  `json:"sistema"               bson:"sistema"`
+}
+
+func (venta VentasApp) GetUniqueId() string {
+	var sb strings.Builder
+	sb.WriteString(venta.MerchantId)
+	sb.WriteString(venta.Canal)
+	sb.WriteString(venta.Plataforma)
+	sb.WriteString(venta.CodigoOrden)
+	sb.WriteString(venta.FechaTransaccion)
+	hash := sha3.New256()
+	hash.Write([]byte(sb.String()))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+func (venta VentasApp) GetTransactionHash() string {
+	var sb strings.Builder
+	sb.WriteString(venta.MerchantId)
+	sb.WriteString(venta.FechaTransaccion)
+	sb.WriteString(venta.HoraTransaccion)
+	sb.WriteString(venta.CodigoOrden)
+	sb.WriteString(venta.Canal)
+	sb.WriteString(venta.Plataforma)
+	sb.WriteString(venta.Estado)
+	sb.WriteString(venta.FormaPago)
+	sb.WriteString(venta.IdGrupoTarjeta)
+	sb.WriteString(venta.NumeroTarjetaMask)
+	sb.WriteString(venta.NumeroAutorizacion)
+	sb.WriteString(venta.NumeroReferencia)
+	sb.WriteString(venta.FaceValue)
+	sb.WriteString(fmt.Sprintf("%f", venta.Subtotal))
+	sb.WriteString(fmt.Sprintf("%f", venta.Descuento))
+	sb.WriteString(fmt.Sprintf("%f", venta.Iva))
+	sb.WriteString(fmt.Sprintf("%f", venta.Propina))
+	sb.WriteString(fmt.Sprintf("%f", venta.CostoEnvio))
+	sb.WriteString(venta.Sistema)
+	hash := sha3.New256()
+	hash.Write([]byte(sb.String()))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (wrapper WrapperVentasApp) GetId() string            { return wrapper.Id }
+func (wrapper WrapperVentasApp) GetConciliatorId() string { return wrapper.ConciliatorId }
+func (wrapper WrapperVentasApp) GetProvider() string      { return wrapper.Provider }
+func (wrapper WrapperVentasApp) Refs() []TransactionRef {
+	refs := make([]TransactionRef, 0, len(wrapper.Transactions))
+	for _, transaction := range wrapper.Transactions {
+		refs = append(refs, TransactionRef{
+			OperationType: transaction.OperationType,
+			UniqueId:      transaction.UniqueId,
+			Hash:          transaction.Hash,
+		})
+	}
+	return refs
+}
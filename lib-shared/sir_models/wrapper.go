@@ -0,0 +1,32 @@
+package sir_models
+
+// Wrapper es el contrato común de los mensajes sir.writer.*, sir-writer lo usa para el ledger,
+// el reporte de resultados y el estado de sincronización sin depender del tipo de transacción.
+type Wrapper interface {
+	GetId() string
+	GetConciliatorId() string
+	GetProvider() string
+	Refs() []TransactionRef
+}
+
+// TransactionRef identifica el pago detrás de cada transacción de un wrapper.
+type TransactionRef struct {
+	OperationType string
+	UniqueId      string
+	Hash          string
+}
+
+func (wrapper WrapperTransactions) GetId() string            { return wrapper.Id }
+func (wrapper WrapperTransactions) GetConciliatorId() string { return wrapper.ConciliatorId }
+func (wrapper WrapperTransactions) GetProvider() string      { return wrapper.Provider }
+func (wrapper WrapperTransactions) Refs() []TransactionRef {
+	refs := make([]TransactionRef, 0, len(wrapper.Transactions))
+	for _, transaction := range wrapper.Transactions {
+		refs = append(refs, TransactionRef{
+			OperationType: transaction.OperationType,
+			UniqueId:      transaction.UniqueId,
+			Hash:          transaction.Hash,
+		})
+	}
+	return refs
+}
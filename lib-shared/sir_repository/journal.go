@@ -0,0 +1,232 @@
+package sir_repository
+
+import (
+	"database/sql"
+	"fmt"
+	"lib-shared/sir_models"
+	"strings"
+)
+
+// Tablas que escribe el conciliador, se guardan en el journal para saber cómo revertir cada cambio.
+const (
+	TransactionsTableName = "ST_Transaccional"
+	// ChangesTableName es el journal de cambios por conciliación que se usa para el rollback.
+	ChangesTableName = "ST_Conciliador_Cambios"
+)
+
+// Change es una fila escrita en SIR por un wrapper de una conciliación. Data y Before son JSON:
+// Data la fila que se escribió, Before las filas que había bajo la misma clave antes del cambio (vacío en INSERT).
+type Change struct {
+	Id            int64
+	ConciliatorId string
+	WrapperId     string
+	Provider      string
+	UniqueId      string
+	Table         string
+	Operation     string
+	Data          string
+	Before        string
+}
+
+// columnas de ST_Transaccional en el orden en que se leen las imágenes anteriores
+var transactionColumns = []string{
+	"Merchantid", "Fecha_Transaccion", "Hora_Transaccion", "Estado", "Numero_Lote", "Face_Value",
+	"Id_Grupo_Tarjeta", "Id_Adquirente", "numero_tarjeta_mask", "Numero_Autorizacion", "Numero_Referencia",
+	"Tipo_Transaccion", "Resultado_Externo", "Tipo_Switch", "origen_Transaccion", "Sistema", "Voucher",
+	"CuentaNombre", "Subtotal", "Descuento", "Iva", "IvaAplicado", "FidelizacionOpera", "FidelizacionMerca",
+	"FidelizacionTotal", "FidelizacionValor",
+}
+
+// columnas numéricas, el resto se lee como texto
+var numericColumns = map[string]bool{
+	"Tipo_Switch": true, "origen_Transaccion": true, "Subtotal": true, "Descuento": true, "Iva": true,
+	"IvaAplicado": true, "FidelizacionOpera": true, "FidelizacionMerca": true, "FidelizacionTotal": true,
+	"FidelizacionValor": true, "Propina": true, "Costo_Envio": true,
+}
+
+var ventasAppColumns = []string{
+	"Merchantid", "Fecha_Transaccion", "Hora_Transaccion", "Codigo_Orden", "Canal", "Plataforma", "Estado",
+	"Forma_Pago", "Id_Grupo_Tarjeta", "numero_tarjeta_mask", "Numero_Autorizacion", "Numero_Referencia",
+	"Face_Value", "Subtotal", "Descuento", "Iva", "Propina", "Costo_Envio", "Sistema",
+}
+
+// selectColumns arma la lista de columnas sin NULL para que se puedan leer directo en los modelos.
+func (dialect dialect) selectColumns(columns []string) string {
+	selected := make([]string, 0, len(columns))
+	for _, column := range columns {
+		switch {
+		case column == "Fecha_Transaccion":
+			selected = append(selected, fmt.Sprintf("COALESCE("+dialect.dateAsText+", '')", column))
+		case numericColumns[column]:
+			selected = append(selected, "COALESCE("+column+", 0)")
+		default:
+			selected = append(selected, "COALESCE("+column+", '')")
+		}
+	}
+	return strings.Join(selected, ", ")
+}
+
+func (writeTx *sqlWriteTx) FindTransactions(data sir_models.StTransactions) ([]sir_models.StTransactions, error) {
+	rows, err := writeTx.tx.Query(`
+		SELECT `+writeTx.dialect.selectColumns(transactionColumns)+` FROM ST_Transaccional
+		WHERE Merchantid = @merchantId AND Fecha_Transaccion = @fechaTransaccion`,
+		sql.Named("merchantId", data.MerchantId),
+		sql.Named("fechaTransaccion", data.FechaTransaccion),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la imagen anterior de ST_Transaccional: %w", err)
+	}
+	defer rows.Close()
+	result := make([]sir_models.StTransactions, 0)
+	for rows.Next() {
+		var row sir_models.StTransactions
+		err := rows.Scan(&row.MerchantId, &row.FechaTransaccion, &row.HoraTransaccion, &row.Estado, &row.NumeroLote,
+			&row.FaceValue, &row.IdGrupoTarjeta, &row.IdAdquirente, &row.NumeroTarjetaMask, &row.NumeroAutorizacion,
+			&row.NumeroReferencia, &row.TipoTransaccion, &row.ResultadoExterno, &row.TipoSwitch, &row.OrigenTransaccion,
+			&row.Sistema, &row.Voucher, &row.CuentaNombre, &row.Subtotal, &row.Descuento, &row.Iva, &row.IvaAplicado,
+			&row.FidelizacionOpera, &row.FidelizacionMerca, &row.FidelizacionTotal, &row.FidelizacionValor)
+		if err != nil {
+			return nil, fmt.Errorf("error al leer la imagen anterior de ST_Transaccional: %w", err)
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+func (writeTx *sqlWriteTx) FindVentasApp(data sir_models.VentasApp) ([]sir_models.VentasApp, error) {
+	rows, err := writeTx.tx.Query(`
+		SELECT `+writeTx.dialect.selectColumns(ventasAppColumns)+` FROM `+VentasAppTableName+`
+		WHERE Merchantid = @merchantId AND Fecha_Transaccion = @fechaTransaccion
+			AND Codigo_Orden = @codigoOrden AND Canal = @canal AND Plataforma = @plataforma`,
+		sql.Named("merchantId", data.MerchantId),
+		sql.Named("fechaTransaccion", data.FechaTransaccion),
+		sql.Named("codigoOrden", data.CodigoOrden),
+		sql.Named("canal", data.Canal),
+		sql.Named("plataforma", data.Plataforma),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la imagen anterior de %s: %w", VentasAppTableName, err)
+	}
+	defer rows.Close()
+	result := make([]sir_models.VentasApp, 0)
+	for rows.Next() {
+		var row sir_models.VentasApp
+		err := rows.Scan(&row.MerchantId, &row.FechaTransaccion, &row.HoraTransaccion, &row.CodigoOrden, &row.Canal,
+			&row.Plataforma, &row.Estado, &row.FormaPago, &row.IdGrupoTarjeta, &row.NumeroTarjetaMask,
+			&row.NumeroAutorizacion, &row.NumeroReferencia, &row.FaceValue, &row.Subtotal, &row.Descuento, &row.Iva,
+			&row.Propina, &row.CostoEnvio, &row.Sistema)
+		if err != nil {
+			return nil, fmt.Errorf("error al leer la imagen anterior de %s: %w", VentasAppTableName, err)
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// DeleteInsertedTransaction elimina una fila insertada por el conciliador usando los campos del uniqueId,
+// a diferencia de DeleteTransaction no borra las demás transacciones del comercio en la fecha.
+func (writeTx *sqlWriteTx) DeleteInsertedTransaction(data sir_models.StTransactions) error {
+	_, err := writeTx.tx.Exec(`
+		DELETE FROM ST_Transaccional WHERE
+			Merchantid = @merchantId AND Fecha_Transaccion = @fechaTransaccion
+			AND Hora_Transaccion = @horaTransaccion AND Numero_Referencia = @numeroReferencia
+			AND Numero_Autorizacion = @numeroAutorizacion AND numero_tarjeta_mask = @numeroTarjetaMask`,
+		sql.Named("merchantId", data.MerchantId),
+		sql.Named("fechaTransaccion", data.FechaTransaccion),
+		sql.Named("horaTransaccion", data.HoraTransaccion),
+		sql.Named("numeroReferencia", data.NumeroReferencia),
+		sql.Named("numeroAutorizacion", data.NumeroAutorizacion),
+		sql.Named("numeroTarjetaMask", data.NumeroTarjetaMask),
+	)
+	if err != nil {
+		return fmt.Errorf("error al eliminar la fila insertada: %w", err)
+	}
+	return nil
+}
+
+// TransactionExists busca la fila con los mismos campos que usa DeleteInsertedTransaction, así un INSERT
+// reenviado no duplica el pago.
+func (writeTx *sqlWriteTx) TransactionExists(data sir_models.StTransactions) (bool, error) {
+	var count int
+	err := writeTx.tx.QueryRow(`
+		SELECT COUNT(1) FROM ST_Transaccional WHERE
+			Merchantid = @merchantId AND Fecha_Transaccion = @fechaTransaccion
+			AND Hora_Transaccion = @horaTransaccion AND Numero_Referencia = @numeroReferencia
+			AND Numero_Autorizacion = @numeroAutorizacion AND numero_tarjeta_mask = @numeroTarjetaMask`,
+		sql.Named("merchantId", data.MerchantId),
+		sql.Named("fechaTransaccion", data.FechaTransaccion),
+		sql.Named("horaTransaccion", data.HoraTransaccion),
+		sql.Named("numeroReferencia", data.NumeroReferencia),
+		sql.Named("numeroAutorizacion", data.NumeroAutorizacion),
+		sql.Named("numeroTarjetaMask", data.NumeroTarjetaMask),
+	).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("error al buscar la fila en ST_Transaccional: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (writeTx *sqlWriteTx) RecordChange(change Change) error {
+	var before any
+	if change.Before != "" {
+		before = change.Before
+	}
+	_, err := writeTx.tx.Exec(`
+		INSERT INTO `+ChangesTableName+` (
+			Id_Conciliador, Id_Mensaje, Proveedor, Unique_Id, Tabla, Operacion, Datos, Imagen_Anterior
+		) VALUES (
+			@conciliatorId, @wrapperId, @provider, @uniqueId, @table, @operation, @data, @before
+		)`,
+		sql.Named("conciliatorId", change.ConciliatorId),
+		sql.Named("wrapperId", change.WrapperId),
+		sql.Named("provider", change.Provider),
+		sql.Named("uniqueId", change.UniqueId),
+		sql.Named("table", change.Table),
+		sql.Named("operation", change.Operation),
+		sql.Named("data", change.Data),
+		sql.Named("before", before),
+	)
+	if err != nil {
+		return fmt.Errorf("error al registrar el cambio en %s: %w", ChangesTableName, err)
+	}
+	return nil
+}
+
+func (writeTx *sqlWriteTx) FindChanges(conciliatorId string) ([]Change, error) {
+	rows, err := writeTx.tx.Query(`
+		SELECT Id_Cambio, Id_Conciliador, Id_Mensaje, COALESCE(Proveedor, ''), COALESCE(Unique_Id, ''),
+			Tabla, Operacion, Datos, COALESCE(Imagen_Anterior, '')
+		FROM `+ChangesTableName+`
+		WHERE Id_Conciliador = @conciliatorId AND Id_Rollback IS NULL
+		ORDER BY Id_Cambio DESC`,
+		sql.Named("conciliatorId", conciliatorId),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error al consultar %s: %w", ChangesTableName, err)
+	}
+	defer rows.Close()
+	result := make([]Change, 0)
+	for rows.Next() {
+		var change Change
+		err := rows.Scan(&change.Id, &change.ConciliatorId, &change.WrapperId, &change.Provider, &change.UniqueId,
+			&change.Table, &change.Operation, &change.Data, &change.Before)
+		if err != nil {
+			return nil, fmt.Errorf("error al leer %s: %w", ChangesTableName, err)
+		}
+		result = append(result, change)
+	}
+	return result, rows.Err()
+}
+
+func (writeTx *sqlWriteTx) MarkChangesReverted(conciliatorId string, rollbackId string) error {
+	_, err := writeTx.tx.Exec(`
+		UPDATE `+ChangesTableName+` SET Id_Rollback = @rollbackId
+		WHERE Id_Conciliador = @conciliatorId AND Id_Rollback IS NULL`,
+		sql.Named("rollbackId", rollbackId),
+		sql.Named("conciliatorId", conciliatorId),
+	)
+	if err != nil {
+		return fmt.Errorf("error al marcar los cambios revertidos: %w", err)
+	}
+	return nil
+}
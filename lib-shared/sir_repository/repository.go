@@ -0,0 +1,144 @@
+package sir_repository
+
+import (
+	"fmt"
+	"lib-shared/sir_models"
+)
+
+// Drivers soportados para la base SIR.
+const (
+	DriverSqlServer = "sqlserver"
+	DriverSqlite    = "sqlite"
+)
+
+// Options configura la conexión a SIR. Con DriverSqlite, DSN es la ruta del archivo (o ":memory:") y
+// FixturesDir la carpeta con los JSON que se cargan al crear el esquema, vacío usa los fixtures embebidos.
+type Options struct {
+	Driver      string
+	DSN         string
+	FixturesDir string
+}
+
+// RestaurantMid es un MID activo de una red de pagos con los datos que se escriben en ST_Transaccional.
+type RestaurantMid struct {
+	CodTienda  string
+	SwitchT    string
+	MID        string
+	TipoSwitch string
+	Origen     string
+	Sistema    string
+	CodCadena  string
+}
+
+// CardGroupRange es un rango de bines de FormadePago_Bines resuelto contra su ST_Grupo_Tarjeta.
+type CardGroupRange struct {
+	IdGrupoTarjeta string
+	CodCadena      int
+	Minimo         int
+	Maximo         int
+}
+
+// PaymentBin es un rango de bines de FormadePago_Bines con el nombre de la forma de pago.
+type PaymentBin struct {
+	Nombre    string
+	CodCadena int
+	Minimo    int
+	Maximo    int
+}
+
+// CardGroup es un registro de ST_Grupo_Tarjeta.
+type CardGroup struct {
+	Id          string
+	Descripcion string
+}
+
+// Restaurant es un registro de Restaurante con SwitchT configurado.
+type Restaurant struct {
+	CodRestaurante string
+	CodTienda      string
+	SwitchT        string
+}
+
+// KioskServer es un registro de KioskoWs con los datos de acceso a la API del kiosco.
+type KioskServer struct {
+	IdLocal   string
+	Direccion string
+	Puerto    string
+	Email     string
+	Clave     string
+}
+
+// CatalogRepository lee los catálogos de SIR que usan los caches de los proveedores.
+type CatalogRepository interface {
+	// FindRestaurantMids devuelve los MIDs activos de la red de pagos indicada, con el origen de transacción dado.
+	FindRestaurantMids(redPagos string, origen string) ([]RestaurantMid, error)
+	FindCardGroupRanges() ([]CardGroupRange, error)
+	FindPaymentBins() ([]PaymentBin, error)
+	FindCardGroups() ([]CardGroup, error)
+	FindRestaurants() ([]Restaurant, error)
+	FindKioskServers() ([]KioskServer, error)
+}
+
+// WriteTx es una transacción abierta sobre las tablas de escritura de SIR.
+type WriteTx interface {
+	// IsMessageProcessed consulta el ledger bloqueando la fila para que dos entregas del mismo wrapper no se apliquen a la vez.
+	IsMessageProcessed(id string) (bool, error)
+	MarkMessageProcessed(id string, transactions int) error
+	InsertTransaction(data sir_models.StTransactions) error
+	UpdateTransaction(data sir_models.StTransactions) error
+	DeleteTransaction(data sir_models.StTransactions) error
+	InsertVentaApp(data sir_models.VentasApp) error
+	UpdateVentaApp(data sir_models.VentasApp) error
+	DeleteVentaApp(data sir_models.VentasApp) error
+	// FindTransactions devuelve las filas de ST_Transaccional bajo la clave que usan UPDATE y DELETE.
+	FindTransactions(data sir_models.StTransactions) ([]sir_models.StTransactions, error)
+	FindVentasApp(data sir_models.VentasApp) ([]sir_models.VentasApp, error)
+	DeleteInsertedTransaction(data sir_models.StTransactions) error
+	// TransactionExists indica si la fila ya está en ST_Transaccional con los campos del uniqueId.
+	TransactionExists(data sir_models.StTransactions) (bool, error)
+	// RecordChange guarda el cambio en el journal de la conciliación dentro de la misma transacción.
+	RecordChange(change Change) error
+	// FindChanges devuelve los cambios de la conciliación que no fueron revertidos, del más reciente al más antiguo.
+	FindChanges(conciliatorId string) ([]Change, error)
+	MarkChangesReverted(conciliatorId string, rollbackId string) error
+	Commit() error
+	Rollback() error
+}
+
+// TransactionRepository escribe en ST_Transaccional y ST_VentasApp, con el journal para el rollback.
+type TransactionRepository interface {
+	// EnsureSchema crea las tablas propias del conciliador (ledger, journal, ST_VentasApp) si no existen.
+	EnsureSchema() error
+	Begin() (WriteTx, error)
+}
+
+// SirRepository agrupa la lectura de catálogos y la escritura en SIR sobre una misma conexión.
+type SirRepository interface {
+	CatalogRepository
+	TransactionRepository
+	Close() error
+}
+
+// NewSirRepository abre la base SIR con el driver configurado.
+func NewSirRepository(opts Options) (SirRepository, error) {
+	switch opts.Driver {
+	case "", DriverSqlServer:
+		return newSqlRepository(sqlServerDialect, opts.DSN)
+	case DriverSqlite:
+		repository, err := newSqlRepository(sqliteDialect, opts.DSN)
+		if err != nil {
+			return nil, err
+		}
+		if err := repository.EnsureSchema(); err != nil {
+			repository.Close()
+			return nil, err
+		}
+		if err := seedFixtures(repository.db, opts.FixturesDir); err != nil {
+			repository.Close()
+			return nil, err
+		}
+		return repository, nil
+	default:
+		return nil, fmt.Errorf("driver de SIR desconocido '%s'", opts.Driver)
+	}
+}
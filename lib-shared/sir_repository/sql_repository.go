@@ -0,0 +1,413 @@
+package sir_repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"lib-shared/sir_models"
+)
+
+// dialect contiene lo que cambia entre motores, el resto de consultas usa parámetros @nombre que
+// entienden tanto go-mssqldb como sqlite.
+type dialect struct {
+	driverName string
+	// schema se ejecuta en orden en EnsureSchema, cada sentencia debe ser idempotente
+	schema               []string
+	restaurantMidsQuery  string
+	cardGroupRangesQuery string
+	paymentBinsQuery     string
+	cardGroupsQuery      string
+	restaurantsQuery     string
+	kioskServersQuery    string
+	ledgerLookupQuery    string
+	// dateAsText convierte la columna (%s) de fecha a texto AAAA-MM-DD
+	dateAsText string
+	// maxOpenConns limita el pool, 0 sin límite
+	maxOpenConns int
+}
+
+type sqlRepository struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func newSqlRepository(dialect dialect, dsn string) (*sqlRepository, error) {
+	db, err := sql.Open(dialect.driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir la base SIR: %w", err)
+	}
+	if dialect.maxOpenConns > 0 {
+		db.SetMaxOpenConns(dialect.maxOpenConns)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error conectando a la base SIR: %w", err)
+	}
+	return &sqlRepository{db: db, dialect: dialect}, nil
+}
+
+func (repository *sqlRepository) Close() error {
+	return repository.db.Close()
+}
+
+func (repository *sqlRepository) EnsureSchema() error {
+	for _, statement := range repository.dialect.schema {
+		if _, err := repository.db.Exec(statement); err != nil {
+			return fmt.Errorf("error creando el esquema de SIR: %w", err)
+		}
+	}
+	return nil
+}
+
+func (repository *sqlRepository) FindRestaurantMids(redPagos string, origen string) ([]RestaurantMid, error) {
+	rows, err := repository.db.Query(repository.dialect.restaurantMidsQuery,
+		sql.Named("redPagos", redPagos),
+		sql.Named("origen", origen),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando MIDs_Restaurante: %w", err)
+	}
+	defer rows.Close()
+	result := make([]RestaurantMid, 0)
+	for rows.Next() {
+		var mid RestaurantMid
+		if err := rows.Scan(&mid.CodTienda, &mid.SwitchT, &mid.MID, &mid.TipoSwitch, &mid.Origen, &mid.Sistema, &mid.CodCadena); err != nil {
+			return nil, fmt.Errorf("error al leer MIDs_Restaurante: %w", err)
+		}
+		result = append(result, mid)
+	}
+	return result, rows.Err()
+}
+
+func (repository *sqlRepository) FindCardGroupRanges() ([]CardGroupRange, error) {
+	rows, err := repository.db.Query(repository.dialect.cardGroupRangesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando ST_Grupo_Tarjeta: %w", err)
+	}
+	defer rows.Close()
+	result := make([]CardGroupRange, 0)
+	for rows.Next() {
+		var group CardGroupRange
+		if err := rows.Scan(&group.IdGrupoTarjeta, &group.CodCadena, &group.Minimo, &group.Maximo); err != nil {
+			return nil, fmt.Errorf("error al leer ST_Grupo_Tarjeta: %w", err)
+		}
+		result = append(result, group)
+	}
+	return result, rows.Err()
+}
+
+func (repository *sqlRepository) FindPaymentBins() ([]PaymentBin, error) {
+	rows, err := repository.db.Query(repository.dialect.paymentBinsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando FormadePago_Bines: %w", err)
+	}
+	defer rows.Close()
+	result := make([]PaymentBin, 0)
+	for rows.Next() {
+		var bin PaymentBin
+		if err := rows.Scan(&bin.Nombre, &bin.Minimo, &bin.Maximo, &bin.CodCadena); err != nil {
+			return nil, fmt.Errorf("error al leer FormadePago_Bines: %w", err)
+		}
+		result = append(result, bin)
+	}
+	return result, rows.Err()
+}
+
+func (repository *sqlRepository) FindCardGroups() ([]CardGroup, error) {
+	rows, err := repository.db.Query(repository.dialect.cardGroupsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando ST_Grupo_Tarjeta: %w", err)
+	}
+	defer rows.Close()
+	result := make([]CardGroup, 0)
+	for rows.Next() {
+		var group CardGroup
+		if err := rows.Scan(&group.Id, &group.Descripcion); err != nil {
+			return nil, fmt.Errorf("error al leer ST_Grupo_Tarjeta: %w", err)
+		}
+		result = append(result, group)
+	}
+	return result, rows.Err()
+}
+
+func (repository *sqlRepository) FindRestaurants() ([]Restaurant, error) {
+	rows, err := repository.db.Query(repository.dialect.restaurantsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando Restaurante: %w", err)
+	}
+	defer rows.Close()
+	result := make([]Restaurant, 0)
+	for rows.Next() {
+		var restaurant Restaurant
+		if err := rows.Scan(&restaurant.CodRestaurante, &restaurant.CodTienda, &restaurant.SwitchT); err != nil {
+			return nil, fmt.Errorf("error al leer Restaurante: %w", err)
+		}
+		result = append(result, restaurant)
+	}
+	return result, rows.Err()
+}
+
+func (repository *sqlRepository) FindKioskServers() ([]KioskServer, error) {
+	rows, err := repository.db.Query(repository.dialect.kioskServersQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando KioskoWs: %w", err)
+	}
+	defer rows.Close()
+	result := make([]KioskServer, 0)
+	for rows.Next() {
+		var server KioskServer
+		if err := rows.Scan(&server.IdLocal, &server.Direccion, &server.Puerto, &server.Email, &server.Clave); err != nil {
+			return nil, fmt.Errorf("error al leer KioskoWs: %w", err)
+		}
+		result = append(result, server)
+	}
+	return result, rows.Err()
+}
+
+func (repository *sqlRepository) Begin() (WriteTx, error) {
+	tx, err := repository.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqlWriteTx{tx: tx, dialect: repository.dialect}, nil
+}
+
+type sqlWriteTx struct {
+	tx      *sql.Tx
+	dialect dialect
+}
+
+func (writeTx *sqlWriteTx) Commit() error {
+	return writeTx.tx.Commit()
+}
+
+func (writeTx *sqlWriteTx) Rollback() error {
+	err := writeTx.tx.Rollback()
+	if errors.Is(err, sql.ErrTxDone) {
+		return nil
+	}
+	return err
+}
+
+func (writeTx *sqlWriteTx) IsMessageProcessed(id string) (bool, error) {
+	var found int
+	err := writeTx.tx.QueryRow(writeTx.dialect.ledgerLookupQuery, sql.Named("id", id)).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error al consultar el ledger para el wrapper %s: %w", id, err)
+	}
+	return true, nil
+}
+
+func (writeTx *sqlWriteTx) MarkMessageProcessed(id string, transactions int) error {
+	_, err := writeTx.tx.Exec(`
+		INSERT INTO `+LedgerTableName+` (Id_Mensaje, Transacciones)
+		VALUES (@id, @transactions)`,
+		sql.Named("id", id),
+		sql.Named("transactions", transactions),
+	)
+	if err != nil {
+		return fmt.Errorf("error al registrar el wrapper %s en el ledger: %w", id, err)
+	}
+	return nil
+}
+
+func (writeTx *sqlWriteTx) InsertTransaction(data sir_models.StTransactions) error {
+	_, err := writeTx.tx.Exec(`
+		INSERT INTO ST_Transaccional (
+			Merchantid, Fecha_Transaccion, Hora_Transaccion, Estado,
+			Numero_Lote, Face_Value, Id_Grupo_Tarjeta, Id_Adquirente,
+			numero_tarjeta_mask, Numero_Autorizacion, Numero_Referencia,
+			Tipo_Transaccion, Resultado_Externo, Tipo_Switch, origen_Transaccion,
+			Sistema, Voucher, CuentaNombre, Subtotal, Descuento, Iva,
+			IvaAplicado, FidelizacionOpera, FidelizacionMerca, FidelizacionTotal,
+			FidelizacionValor
+		) VALUES (
+			@merchantId, @fechaTransaccion, @horaTransaccion, @estado,
+			@numeroLote, @faceValue, @idGrupoTarjeta, @idAdquirente,
+			@numeroTarjetaMask, @numeroAutorizacion, @numeroReferencia,
+			@tipoTransaccion, @resultadoExterno, @tipoSwitch, @origenTransaccion,
+			@sistema, @voucher, @cuentaNombre, @subtotal, @descuento, @iva,
+			@ivaAplicado, @fidelizacionOpera, @fidelizacionMerca, @fidelizacionTotal,
+			@fidelizacionValor
+		)`,
+		transactionParams(data)...,
+	)
+	if err != nil {
+		return fmt.Errorf("error al insertar: %w", err)
+	}
+	return nil
+}
+
+func (writeTx *sqlWriteTx) UpdateTransaction(data sir_models.StTransactions) error {
+	_, err := writeTx.tx.Exec(`
+		UPDATE ST_Transaccional SET
+			Hora_Transaccion = @horaTransaccion,
+			Estado = @estado,
+			Numero_Lote = @numeroLote,
+			Face_Value = @faceValue,
+			Id_Grupo_Tarjeta = @idGrupoTarjeta,
+			Id_Adquirente = @idAdquirente,
+			numero_tarjeta_mask = @numeroTarjetaMask,
+			Numero_Autorizacion = @numeroAutorizacion,
+			Numero_Referencia = @numeroReferencia,
+			Tipo_Transaccion = @tipoTransaccion,
+			Resultado_Externo = @resultadoExterno,
+			Tipo_Switch = @tipoSwitch,
+			origen_Transaccion = @origenTransaccion,
+			Sistema = @sistema,
+			Voucher = @voucher,
+			CuentaNombre = @cuentaNombre,
+			Subtotal = @subtotal,
+			Descuento = @descuento,
+			Iva = @iva,
+			IvaAplicado = @ivaAplicado,
+			FidelizacionOpera = @fidelizacionOpera,
+			FidelizacionMerca = @fidelizacionMerca,
+			FidelizacionTotal = @fidelizacionTotal,
+			FidelizacionValor = @fidelizacionValor
+		WHERE
+			Merchantid = @merchantId AND Fecha_Transaccion = @fechaTransaccion`,
+		transactionParams(data)...,
+	)
+	if err != nil {
+		return fmt.Errorf("error al actualizar: %w", err)
+	}
+	return nil
+}
+
+func (writeTx *sqlWriteTx) DeleteTransaction(data sir_models.StTransactions) error {
+	_, err := writeTx.tx.Exec(`
+		DELETE FROM ST_Transaccional WHERE
+			Merchantid = @merchantId AND Fecha_Transaccion = @fechaTransaccion`,
+		sql.Named("merchantId", data.MerchantId),
+		sql.Named("fechaTransaccion", data.FechaTransaccion),
+	)
+	if err != nil {
+		return fmt.Errorf("error al eliminar: %w", err)
+	}
+	return nil
+}
+
+func (writeTx *sqlWriteTx) InsertVentaApp(data sir_models.VentasApp) error {
+	_, err := writeTx.tx.Exec(`
+		INSERT INTO `+VentasAppTableName+` (
+			Merchantid, Fecha_Transaccion, Hora_Transaccion, Codigo_Orden,
+			Canal, Plataforma, Estado, Forma_Pago, Id_Grupo_Tarjeta,
+			numero_tarjeta_mask, Numero_Autorizacion, Numero_Referencia,
+			Face_Value, Subtotal, Descuento, Iva, Propina, Costo_Envio, Sistema
+		) VALUES (
+			@merchantId, @fechaTransaccion, @horaTransaccion, @codigoOrden,
+			@canal, @plataforma, @estado, @formaPago, @idGrupoTarjeta,
+			@numeroTarjetaMask, @numeroAutorizacion, @numeroReferencia,
+			@faceValue, @subtotal, @descuento, @iva, @propina, @costoEnvio, @sistema
+		)`,
+		ventaAppParams(data)...,
+	)
+	if err != nil {
+		return fmt.Errorf("error al insertar venta app: %w", err)
+	}
+	return nil
+}
+
+func (writeTx *sqlWriteTx) UpdateVentaApp(data sir_models.VentasApp) error {
+	_, err := writeTx.tx.Exec(`
+		UPDATE `+VentasAppTableName+` SET
+			Hora_Transaccion = @horaTransaccion,
+			Estado = @estado,
+			Forma_Pago = @formaPago,
+			Id_Grupo_Tarjeta = @idGrupoTarjeta,
+			numero_tarjeta_mask = @numeroTarjetaMask,
+			Numero_Autorizacion = @numeroAutorizacion,
+			Numero_Referencia = @numeroReferencia,
+			Face_Value = @faceValue,
+			Subtotal = @subtotal,
+			Descuento = @descuento,
+			Iva = @iva,
+			Propina = @propina,
+			Costo_Envio = @costoEnvio,
+			Sistema = @sistema
+		WHERE
+			Merchantid = @merchantId AND Fecha_Transaccion = @fechaTransaccion
+			AND Codigo_Orden = @codigoOrden AND Canal = @canal AND Plataforma = @plataforma`,
+		ventaAppParams(data)...,
+	)
+	if err != nil {
+		return fmt.Errorf("error al actualizar venta app: %w", err)
+	}
+	return nil
+}
+
+func (writeTx *sqlWriteTx) DeleteVentaApp(data sir_models.VentasApp) error {
+	_, err := writeTx.tx.Exec(`
+		DELETE FROM `+VentasAppTableName+` WHERE
+			Merchantid = @merchantId AND Fecha_Transaccion = @fechaTransaccion
+			AND Codigo_Orden = @codigoOrden AND Canal = @canal AND Plataforma = @plataforma`,
+		sql.Named("merchantId", data.MerchantId),
+		sql.Named("fechaTransaccion", data.FechaTransaccion),
+		sql.Named("codigoOrden", data.CodigoOrden),
+		sql.Named("canal", data.Canal),
+		sql.Named("plataforma", data.Plataforma),
+	)
+	if err != nil {
+		return fmt.Errorf("error al eliminar venta app: %w", err)
+	}
+	return nil
+}
+
+func transactionParams(data sir_models.StTransactions) []any {
+	return []any{
+		sql.Named("merchantId", data.MerchantId),
+		sql.Named("fechaTransaccion", data.FechaTransaccion),
+		sql.Named("horaTransaccion", data.HoraTransaccion),
+		sql.Named("estado", data.Estado),
+		sql.Named("numeroLote", data.NumeroLote),
+		sql.Named("faceValue", data.FaceValue),
+		sql.Named("idGrupoTarjeta", data.IdGrupoTarjeta),
+		sql.Named("idAdquirente", data.IdAdquirente),
+		sql.Named("numeroTarjetaMask", data.NumeroTarjetaMask),
+		sql.Named("numeroAutorizacion", data.NumeroAutorizacion),
+		sql.Named("numeroReferencia", data.NumeroReferencia),
+		sql.Named("tipoTransaccion", data.TipoTransaccion),
+		sql.Named("resultadoExterno", data.ResultadoExterno),
+		sql.Named("tipoSwitch", data.TipoSwitch),
+		sql.Named("origenTransaccion", data.OrigenTransaccion),
+		sql.Named("sistema", data.Sistema),
+		sql.Named("voucher", data.Voucher),
+		sql.Named("cuentaNombre", data.CuentaNombre),
+		sql.Named("subtotal", data.Subtotal),
+		sql.Named("descuento", data.Descuento),
+		sql.Named("iva", data.Iva),
+		sql.Named("ivaAplicado", data.IvaAplicado),
+		sql.Named("fidelizacionOpera", data.FidelizacionOpera),
+		sql.Named("fidelizacionMerca", data.FidelizacionMerca),
+		sql.Named("fidelizacionTotal", data.FidelizacionTotal),
+		sql.Named("fidelizacionValor", data.FidelizacionValor),
+	}
+}
+
+func ventaAppParams(data sir_models.VentasApp) []any {
+	return []any{
+		sql.Named("merchantId", data.MerchantId),
+		sql.Named("fechaTransaccion", data.FechaTransaccion),
+		sql.Named("horaTransaccion", data.HoraTransaccion),
+		sql.Named("codigoOrden", data.CodigoOrden),
+		sql.Named("canal", data.Canal),
+		sql.Named("plataforma", data.Plataforma),
+		sql.Named("estado", data.Estado),
+		sql.Named("formaPago", data.FormaPago),
+		sql.Named("idGrupoTarjeta", data.IdGrupoTarjeta),
+		sql.Named("numeroTarjetaMask", data.NumeroTarjetaMask),
+		sql.Named("numeroAutorizacion", data.NumeroAutorizacion),
+		sql.Named("numeroReferencia", data.NumeroReferencia),
+		sql.Named("faceValue", data.FaceValue),
+		sql.Named("subtotal", data.Subtotal),
+		sql.Named("descuento", data.Descuento),
+		sql.Named("iva", data.Iva),
+		sql.Named("propina", data.Propina),
+		sql.Named("costoEnvio", data.CostoEnvio),
+		sql.Named("sistema", data.Sistema),
+	}
+}
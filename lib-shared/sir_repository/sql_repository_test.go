@@ -0,0 +1,216 @@
+package sir_repository_test
+
+import (
+	"lib-shared/sir_models"
+	"lib-shared/sir_repository"
+	"testing"
+)
+
+func newTestRepository(t *testing.T) sir_repository.SirRepository {
+	t.Helper()
+	repository, err := sir_repository.NewSirRepository(sir_repository.Options{Driver: sir_repository.DriverSqlite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatalf("no se pudo abrir SIR en SQLite: %v", err)
+	}
+	t.Cleanup(func() { repository.Close() })
+	return repository
+}
+
+func begin(t *testing.T, repository sir_repository.SirRepository) sir_repository.WriteTx {
+	t.Helper()
+	tx, err := repository.Begin()
+	if err != nil {
+		t.Fatalf("no se pudo iniciar la transacción: %v", err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+func transaction(referencia string, faceValue string) sir_models.StTransactions {
+	return sir_models.StTransactions{
+		MerchantId:         "100000001",
+		FechaTransaccion:   "2024-05-10",
+		HoraTransaccion:    "101500",
+		Estado:             "APROBADA",
+		FaceValue:          faceValue,
+		IdGrupoTarjeta:     "VISA",
+		NumeroTarjetaMask:  "411111XXXXXX1111",
+		NumeroAutorizacion: "A" + referencia,
+		NumeroReferencia:   referencia,
+		TipoSwitch:         1,
+		OrigenTransaccion:  1,
+		Sistema:            "DATBALANCE",
+	}
+}
+
+func TestFixturesAreLoaded(t *testing.T) {
+	repository := newTestRepository(t)
+	restaurants, err := repository.FindRestaurants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restaurants) == 0 {
+		t.Fatal("los fixtures embebidos no cargaron Restaurante")
+	}
+	groups, err := repository.FindCardGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) == 0 {
+		t.Fatal("los fixtures embebidos no cargaron ST_Grupo_Tarjeta")
+	}
+}
+
+func TestLedgerSkipsRedelivery(t *testing.T) {
+	repository := newTestRepository(t)
+	row := transaction("0001", "10.50")
+
+	tx := begin(t, repository)
+	processed, err := tx.IsMessageProcessed("wrapper-1")
+	if err != nil || processed {
+		t.Fatalf("un wrapper nuevo no debe estar en el ledger: %v %v", processed, err)
+	}
+	if err := tx.InsertTransaction(row); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.MarkMessageProcessed("wrapper-1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx = begin(t, repository)
+	processed, err = tx.IsMessageProcessed("wrapper-1")
+	if err != nil || !processed {
+		t.Fatalf("la redelivery debe encontrar el wrapper en el ledger: %v %v", processed, err)
+	}
+	rows, err := tx.FindTransactions(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("se esperaba 1 fila en ST_Transaccional, hay %d", len(rows))
+	}
+	if rows[0].GetTransactionHash() != row.GetTransactionHash() {
+		t.Fatalf("la fila leída no coincide con la insertada: %+v", rows[0])
+	}
+}
+
+func TestRollbackDiscardsWrapper(t *testing.T) {
+	repository := newTestRepository(t)
+	row := transaction("0001", "10.50")
+
+	tx := begin(t, repository)
+	if err := tx.InsertTransaction(row); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.MarkMessageProcessed("wrapper-1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx = begin(t, repository)
+	processed, err := tx.IsMessageProcessed("wrapper-1")
+	if err != nil || processed {
+		t.Fatalf("un wrapper con rollback no debe quedar en el ledger: %v %v", processed, err)
+	}
+	exists, err := tx.TransactionExists(row)
+	if err != nil || exists {
+		t.Fatalf("un wrapper con rollback no debe dejar filas: %v %v", exists, err)
+	}
+}
+
+func TestTransactionExists(t *testing.T) {
+	repository := newTestRepository(t)
+	row := transaction("0001", "10.50")
+
+	tx := begin(t, repository)
+	exists, err := tx.TransactionExists(row)
+	if err != nil || exists {
+		t.Fatalf("la fila no debe existir antes del INSERT: %v %v", exists, err)
+	}
+	if err := tx.InsertTransaction(row); err != nil {
+		t.Fatal(err)
+	}
+	// el monto no es parte de la clave, un reintento con otro valor sigue siendo el mismo pago
+	exists, err = tx.TransactionExists(transaction("0001", "11.00"))
+	if err != nil || !exists {
+		t.Fatalf("la fila debe existir después del INSERT: %v %v", exists, err)
+	}
+	exists, err = tx.TransactionExists(transaction("0002", "10.50"))
+	if err != nil || exists {
+		t.Fatalf("otra referencia no debe coincidir: %v %v", exists, err)
+	}
+}
+
+func TestDeleteInsertedTransactionKeepsOtherRows(t *testing.T) {
+	repository := newTestRepository(t)
+	inserted := transaction("0001", "10.50")
+	other := transaction("0002", "20.00")
+
+	tx := begin(t, repository)
+	for _, row := range []sir_models.StTransactions{inserted, other} {
+		if err := tx.InsertTransaction(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.DeleteInsertedTransaction(inserted); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := tx.FindTransactions(inserted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].GetUniqueId() != other.GetUniqueId() {
+		t.Fatalf("solo debe quedar la otra fila del comercio en la fecha: %+v", rows)
+	}
+}
+
+func TestJournalChanges(t *testing.T) {
+	repository := newTestRepository(t)
+
+	tx := begin(t, repository)
+	for _, change := range []sir_repository.Change{
+		{ConciliatorId: "conciliacion-1", WrapperId: "wrapper-1", Provider: "KIOSKO", UniqueId: "a", Table: sir_repository.TransactionsTableName, Operation: "INSERT", Data: `{}`},
+		{ConciliatorId: "conciliacion-1", WrapperId: "wrapper-2", Provider: "KIOSKO", UniqueId: "b", Table: sir_repository.TransactionsTableName, Operation: "UPDATE", Data: `{}`, Before: `[]`},
+		{ConciliatorId: "conciliacion-2", WrapperId: "wrapper-3", Provider: "DATAFAST", UniqueId: "c", Table: sir_repository.TransactionsTableName, Operation: "INSERT", Data: `{}`},
+	} {
+		if err := tx.RecordChange(change); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changes, err := tx.FindChanges("conciliacion-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("se esperaban 2 cambios de la conciliación, hay %d", len(changes))
+	}
+	// del más reciente al más antiguo, el rollback los revierte en ese orden
+	if changes[0].UniqueId != "b" || changes[1].UniqueId != "a" {
+		t.Fatalf("los cambios no vienen del más reciente al más antiguo: %+v", changes)
+	}
+	if changes[0].Before != `[]` || changes[1].Before != "" {
+		t.Fatalf("la imagen anterior no se guardó como se registró: %+v", changes)
+	}
+	if err := tx.MarkChangesReverted("conciliacion-1", "rollback-1"); err != nil {
+		t.Fatal(err)
+	}
+	changes, err = tx.FindChanges("conciliacion-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("los cambios revertidos no deben volver a aparecer: %+v", changes)
+	}
+	changes, err = tx.FindChanges("conciliacion-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("el rollback de una conciliación no debe tocar las demás: %+v", changes)
+	}
+}
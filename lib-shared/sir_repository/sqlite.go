@@ -0,0 +1,256 @@
+package sir_repository
+
+import (
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// fixtures por defecto para levantar SIR en local, un archivo <Tabla>.json por tabla con un arreglo de filas.
+//
+//go:embed fixtures/*.json
+var embeddedFixtures embed.FS
+
+// sqliteDialect reproduce en SQLite las tablas de SIR que usa el conciliador, sirve para correr
+// sir-writer y los caches sin una instancia de Azure SQL.
+var sqliteDialect = dialect{
+	driverName: "sqlite",
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS Restaurante (
+			Cod_Restaurante INTEGER PRIMARY KEY,
+			Cod_Tienda      TEXT,
+			SwitchT         TEXT,
+			Cod_Cadena      INTEGER
+		)`,
+		`CREATE TABLE IF NOT EXISTS Red_Pagos (
+			Cod_Red_Pagos INTEGER PRIMARY KEY,
+			Descripcion   TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS MIDs_Restaurante (
+			Cod_Restaurante INTEGER,
+			Cod_Red_Pagos   INTEGER,
+			MID             TEXT,
+			Estado          INTEGER
+		)`,
+		`CREATE TABLE IF NOT EXISTS ST_Tipo_Switch (
+			Id_tipo_switch INTEGER PRIMARY KEY,
+			Descripcion    TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS ST_Origen_Transaccion (
+			id_origen   INTEGER PRIMARY KEY,
+			Descripcion TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS FormasPago (
+			Cod_FormaPago INTEGER PRIMARY KEY,
+			Nombre        TEXT,
+			Cod_Cadena    INTEGER
+		)`,
+		`CREATE TABLE IF NOT EXISTS FormadePago_Bines (
+			Cod_FormaPago INTEGER,
+			Cod_Cadena    INTEGER,
+			Minimo        INTEGER,
+			Maximo        INTEGER
+		)`,
+		`CREATE TABLE IF NOT EXISTS ST_Grupo_Tarjeta (
+			id_grupo_tarjeta TEXT PRIMARY KEY,
+			Descripcion      TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS KioskoWs (
+			idLocal   TEXT,
+			direccion TEXT,
+			puerto    TEXT,
+			email     TEXT,
+			clave     TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS ST_Transaccional (
+			Id_Transaccional    INTEGER PRIMARY KEY AUTOINCREMENT,
+			Merchantid          TEXT,
+			Fecha_Transaccion   TEXT,
+			Hora_Transaccion    TEXT,
+			Estado              TEXT,
+			Numero_Lote         TEXT,
+			Face_Value          TEXT,
+			Id_Grupo_Tarjeta    TEXT,
+			Id_Adquirente       TEXT,
+			numero_tarjeta_mask TEXT,
+			Numero_Autorizacion TEXT,
+			Numero_Referencia   TEXT,
+			Tipo_Transaccion    TEXT,
+			Resultado_Externo   TEXT,
+			Tipo_Switch         INTEGER,
+			origen_Transaccion  INTEGER,
+			Sistema             TEXT,
+			Voucher             TEXT,
+			CuentaNombre        TEXT,
+			Subtotal            REAL,
+			Descuento           REAL,
+			Iva                 REAL,
+			IvaAplicado         REAL,
+			FidelizacionOpera   REAL,
+			FidelizacionMerca   REAL,
+			FidelizacionTotal   REAL,
+			FidelizacionValor   REAL
+		)`,
+		`CREATE TABLE IF NOT EXISTS ` + VentasAppTableName + ` (
+			Id_VentaApp         INTEGER PRIMARY KEY AUTOINCREMENT,
+			Merchantid          TEXT NOT NULL,
+			Fecha_Transaccion   TEXT NOT NULL,
+			Hora_Transaccion    TEXT,
+			Codigo_Orden        TEXT NOT NULL,
+			Canal               TEXT NOT NULL,
+			Plataforma          TEXT NOT NULL,
+			Estado              TEXT,
+			Forma_Pago          TEXT,
+			Id_Grupo_Tarjeta    TEXT,
+			numero_tarjeta_mask TEXT,
+			Numero_Autorizacion TEXT,
+			Numero_Referencia   TEXT,
+			Face_Value          TEXT,
+			Subtotal            REAL,
+			Descuento           REAL,
+			Iva                 REAL,
+			Propina             REAL,
+			Costo_Envio         REAL,
+			Sistema             TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS ` + LedgerTableName + ` (
+			Id_Mensaje      TEXT    NOT NULL PRIMARY KEY,
+			Transacciones   INTEGER NOT NULL,
+			Fecha_Procesado TEXT    NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS ` + ChangesTableName + ` (
+			Id_Cambio       INTEGER PRIMARY KEY AUTOINCREMENT,
+			Id_Conciliador  TEXT NOT NULL,
+			Id_Mensaje      TEXT NOT NULL,
+			Proveedor       TEXT,
+			Unique_Id       TEXT,
+			Tabla           TEXT NOT NULL,
+			Operacion       TEXT NOT NULL,
+			Datos           TEXT NOT NULL,
+			Imagen_Anterior TEXT,
+			Id_Rollback     TEXT,
+			Fecha           TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS IX_` + ChangesTableName + `_Conciliador ON ` + ChangesTableName + ` (Id_Conciliador, Id_Rollback)`,
+	},
+	restaurantMidsQuery: `SELECT
+				r.Cod_Tienda,
+				r.SwitchT,
+				mids.MID,
+				ts.Id_tipo_switch AS tipo_switch,
+				ot.id_origen AS origen,
+				'DATBALANCE' AS sistema,
+				r.Cod_Cadena
+			FROM MIDs_Restaurante AS mids
+			INNER JOIN Restaurante AS r
+				ON r.Cod_Restaurante = mids.Cod_Restaurante
+			INNER JOIN Red_Pagos AS medio
+				ON medio.Cod_Red_Pagos = mids.Cod_Red_Pagos
+			CROSS JOIN (SELECT Id_tipo_switch FROM ST_Tipo_Switch WHERE Descripcion = 'Alignet/Externo') ts
+			CROSS JOIN (SELECT id_origen FROM ST_Origen_Transaccion WHERE Descripcion = @origen) ot
+			WHERE medio.Descripcion = @redPagos
+			AND mids.Estado = 1`,
+	cardGroupRangesQuery: `SELECT
+				id_grupo_tarjeta,
+				FPN.Cod_Cadena,
+				FPN.Minimo,
+				FPN.Maximo
+			FROM ST_Grupo_Tarjeta
+			INNER JOIN (
+				SELECT DISTINCT
+					TRIM(fp.Nombre) AS Nombre,
+					fpb.Cod_Cadena,
+					fpb.Minimo,
+					fpb.Maximo
+				FROM FormadePago_Bines AS fpb
+				INNER JOIN FormasPago AS fp
+					ON fp.Cod_FormaPago = fpb.Cod_FormaPago
+			) AS FPN
+			ON TRIM(Descripcion) LIKE '%' ||
+				(CASE
+					WHEN Nombre = 'ALIA' THEN 'COUTA FACIL'
+					ELSE Nombre
+				END) || '%'`,
+	paymentBinsQuery: `SELECT DISTINCT TRIM(fp.Nombre), Minimo, Maximo, fp.Cod_Cadena FROM FormadePago_Bines AS fpb
+			INNER JOIN FormasPago AS fp ON fp.Cod_FormaPago = fpb.Cod_FormaPago`,
+	cardGroupsQuery:   `SELECT id_grupo_tarjeta, Descripcion FROM ST_Grupo_Tarjeta`,
+	restaurantsQuery:  `SELECT Cod_Restaurante, COALESCE(Cod_Tienda, ''), SwitchT FROM Restaurante WHERE SwitchT IS NOT NULL AND TRIM(SwitchT) <> ''`,
+	kioskServersQuery: `SELECT DISTINCT idLocal, direccion, puerto, email, clave FROM KioskoWs`,
+	// SQLite no tiene bloqueos por fila, el pool de una sola conexión ya serializa las transacciones
+	ledgerLookupQuery: `SELECT 1 FROM ` + LedgerTableName + ` WHERE Id_Mensaje = @id`,
+	dateAsText:        "%s",
+	maxOpenConns:      1,
+}
+
+// seedFixtures carga los archivos <Tabla>.json de la carpeta indicada (o los embebidos si está vacía).
+// Las tablas que ya tienen filas no se tocan, así un archivo SQLite persistente no se duplica al reiniciar.
+func seedFixtures(db *sql.DB, dir string) error {
+	var fixtures fs.FS
+	root := "fixtures"
+	if dir == "" {
+		fixtures = embeddedFixtures
+	} else {
+		fixtures = os.DirFS(dir)
+		root = "."
+	}
+	files, err := fs.Glob(fixtures, path.Join(root, "*.json"))
+	if err != nil {
+		return fmt.Errorf("error al listar los fixtures de SIR: %w", err)
+	}
+	for _, file := range files {
+		table := strings.TrimSuffix(path.Base(file), ".json")
+		content, err := fs.ReadFile(fixtures, file)
+		if err != nil {
+			return fmt.Errorf("error al leer el fixture %s: %w", file, err)
+		}
+		var rows []map[string]any
+		if err := json.Unmarshal(content, &rows); err != nil {
+			return fmt.Errorf("error al deserializar el fixture %s: %w", file, err)
+		}
+		if err := seedTable(db, table, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func seedTable(db *sql.DB, table string, rows []map[string]any) error {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM "` + table + `"`).Scan(&count); err != nil {
+		return fmt.Errorf("el fixture %s no corresponde a una tabla de SIR: %w", table, err)
+	}
+	if count > 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, row := range rows {
+		columns := make([]string, 0, len(row))
+		for column := range row {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		placeholders := make([]string, 0, len(columns))
+		values := make([]any, 0, len(columns))
+		for _, column := range columns {
+			placeholders = append(placeholders, "?")
+			values = append(values, row[column])
+		}
+		query := fmt.Sprintf(`INSERT INTO "%s" ("%s") VALUES (%s)`, table, strings.Join(columns, `", "`), strings.Join(placeholders, ", "))
+		if _, err := tx.Exec(query, values...); err != nil {
+			return fmt.Errorf("error al cargar el fixture %s: %w", table, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,113 @@
+package sir_repository
+
+import (
+	"github.com/microsoft/go-mssqldb/azuread"
+)
+
+// Tablas propias del conciliador dentro de SIR.
+const (
+	// LedgerTableName registra los wrappers ya aplicados, se usa para que las redeliveries de JetStream
+	// no vuelvan a insertar filas que ya fueron confirmadas.
+	LedgerTableName = "ST_Conciliador_Mensajes"
+	// VentasAppTableName es la tabla destino de las ventas del canal app/delivery.
+	VentasAppTableName = "ST_VentasApp"
+)
+
+var sqlServerDialect = dialect{
+	driverName: azuread.DriverName,
+	schema: []string{
+		`IF OBJECT_ID('dbo.` + LedgerTableName + `', 'U') IS NULL
+		CREATE TABLE dbo.` + LedgerTableName + ` (
+			Id_Mensaje      NVARCHAR(64) NOT NULL PRIMARY KEY,
+			Transacciones   INT          NOT NULL,
+			Fecha_Procesado DATETIME2    NOT NULL DEFAULT SYSUTCDATETIME()
+		)`,
+		`IF OBJECT_ID('dbo.` + VentasAppTableName + `', 'U') IS NULL
+		CREATE TABLE dbo.` + VentasAppTableName + ` (
+			Id_VentaApp          BIGINT IDENTITY(1,1) NOT NULL PRIMARY KEY,
+			Merchantid           VARCHAR(50)   NOT NULL,
+			Fecha_Transaccion    DATE          NOT NULL,
+			Hora_Transaccion     VARCHAR(10)   NULL,
+			Codigo_Orden         VARCHAR(100)  NOT NULL,
+			Canal                VARCHAR(30)   NOT NULL,
+			Plataforma           VARCHAR(50)   NOT NULL,
+			Estado               VARCHAR(10)   NULL,
+			Forma_Pago           VARCHAR(50)   NULL,
+			Id_Grupo_Tarjeta     VARCHAR(20)   NULL,
+			numero_tarjeta_mask  VARCHAR(30)   NULL,
+			Numero_Autorizacion  VARCHAR(50)   NULL,
+			Numero_Referencia    VARCHAR(50)   NULL,
+			Face_Value           VARCHAR(20)   NULL,
+			Subtotal             DECIMAL(18,2) NULL,
+			Descuento            DECIMAL(18,2) NULL,
+			Iva                  DECIMAL(18,2) NULL,
+			Propina              DECIMAL(18,2) NULL,
+			Costo_Envio          DECIMAL(18,2) NULL,
+			Sistema              VARCHAR(20)   NULL
+		)`,
+		`IF OBJECT_ID('dbo.` + ChangesTableName + `', 'U') IS NULL
+		BEGIN
+			CREATE TABLE dbo.` + ChangesTableName + ` (
+				Id_Cambio       BIGINT IDENTITY(1,1) NOT NULL PRIMARY KEY,
+				Id_Conciliador  NVARCHAR(64)  NOT NULL,
+				Id_Mensaje      NVARCHAR(64)  NOT NULL,
+				Proveedor       NVARCHAR(30)  NULL,
+				Unique_Id       NVARCHAR(128) NULL,
+				Tabla           NVARCHAR(30)  NOT NULL,
+				Operacion       NVARCHAR(10)  NOT NULL,
+				Datos           NVARCHAR(MAX) NOT NULL,
+				Imagen_Anterior NVARCHAR(MAX) NULL,
+				Id_Rollback     NVARCHAR(64)  NULL,
+				Fecha           DATETIME2     NOT NULL DEFAULT SYSUTCDATETIME()
+			);
+			CREATE INDEX IX_` + ChangesTableName + `_Conciliador ON dbo.` + ChangesTableName + ` (Id_Conciliador, Id_Rollback);
+		END`,
+	},
+	restaurantMidsQuery: `SELECT
+				r.Cod_Tienda,
+				r.SwitchT,
+				mids.MID,
+				ts.Id_tipo_switch AS tipo_switch,
+				ot.id_origen AS origen,
+				'DATBALANCE' AS sistema,
+				r.Cod_Cadena
+			FROM dbo.MIDs_Restaurante AS mids WITH(NOLOCK)
+			INNER JOIN dbo.Restaurante AS r WITH(NOLOCK)
+				ON r.Cod_Restaurante = mids.Cod_Restaurante
+			INNER JOIN dbo.Red_Pagos AS medio WITH(NOLOCK)
+				ON medio.Cod_Red_Pagos = mids.Cod_Red_Pagos
+			CROSS JOIN (SELECT Id_tipo_switch FROM ST_Tipo_Switch WITH(NOLOCK) WHERE Descripcion = 'Alignet/Externo') ts
+			CROSS JOIN (SELECT id_origen FROM ST_Origen_Transaccion WITH(NOLOCK) WHERE Descripcion = @origen) ot
+			WHERE medio.Descripcion = @redPagos
+			AND mids.Estado = 1;`,
+	cardGroupRangesQuery: `SELECT
+				id_grupo_tarjeta,
+				FPN.Cod_Cadena,
+				FPN.Minimo,
+				FPN.Maximo
+			FROM ST_Grupo_Tarjeta WITH(NOLOCK)
+			INNER JOIN (
+				SELECT DISTINCT
+					RTRIM(LTRIM(fp.Nombre)) AS Nombre,
+					fpb.Cod_Cadena,
+					fpb.Minimo,
+					fpb.Maximo
+				FROM FormadePago_Bines AS fpb WITH(NOLOCK)
+				INNER JOIN FormasPago AS fp WITH(NOLOCK)
+					ON fp.Cod_FormaPago = fpb.Cod_FormaPago
+			) AS FPN
+			ON LTRIM(RTRIM(Descripcion)) LIKE '%' +
+				(CASE
+					WHEN Nombre = 'ALIA' THEN 'COUTA FACIL'
+					ELSE Nombre
+				END) + '%';`,
+	paymentBinsQuery: `SELECT DISTINCT(RTRIM(LTRIM(fp.Nombre))), Minimo, Maximo, fp.Cod_Cadena as Nombre FROM FormadePago_Bines AS fpb WITH (NOLOCK)
+         INNER JOIN FormasPago AS fp WITH (NOLOCK) ON fp.Cod_FormaPago = fpb.Cod_FormaPago`,
+	cardGroupsQuery:   `SELECT id_grupo_tarjeta, Descripcion FROM ST_Grupo_Tarjeta WITH (NOLOCK)`,
+	restaurantsQuery:  `SELECT Cod_Restaurante, ISNULL(Cod_Tienda, ''), SwitchT FROM Restaurante where SwitchT is not null and TRIM(SwitchT) <> ''`,
+	kioskServersQuery: `select distinct(idLocal), direccion, puerto, email, clave from KioskoWs`,
+	ledgerLookupQuery: `
+		SELECT 1 FROM dbo.` + LedgerTableName + ` WITH (UPDLOCK, HOLDLOCK)
+		WHERE Id_Mensaje = @id`,
+	dateAsText: "CONVERT(VARCHAR(10), %s, 23)",
+}
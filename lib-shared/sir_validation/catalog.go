@@ -0,0 +1,81 @@
+package sir_validation
+
+import (
+	"fmt"
+	"lib-shared/sir_repository"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Catalog guarda en memoria los ids de SIR contra los que se validan las filas: los merchantId (SwitchT de
+// Restaurante) y los grupos de tarjeta (ST_Grupo_Tarjeta). Se recarga cuando tiene más de maxAge, así un
+// restaurante nuevo no queda en cuarentena hasta reiniciar el servicio.
+type Catalog struct {
+	repository sir_repository.CatalogRepository
+	maxAge     time.Duration
+	mu         sync.RWMutex
+	merchants  map[string]struct{}
+	cardGroups map[string]struct{}
+	loadedAt   time.Time
+}
+
+func NewCatalog(repository sir_repository.CatalogRepository, maxAge time.Duration) *Catalog {
+	return &Catalog{
+		repository: repository,
+		maxAge:     maxAge,
+		merchants:  make(map[string]struct{}),
+		cardGroups: make(map[string]struct{}),
+	}
+}
+
+// Refresh vuelve a leer los catálogos si nunca se cargaron o si ya vencieron.
+func (catalog *Catalog) Refresh() error {
+	catalog.mu.RLock()
+	fresh := !catalog.loadedAt.IsZero() && time.Since(catalog.loadedAt) < catalog.maxAge
+	catalog.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+	restaurants, err := catalog.repository.FindRestaurants()
+	if err != nil {
+		return fmt.Errorf("error al leer los restaurantes de SIR: %w", err)
+	}
+	groups, err := catalog.repository.FindCardGroups()
+	if err != nil {
+		return fmt.Errorf("error al leer los grupos de tarjeta de SIR: %w", err)
+	}
+	merchants := make(map[string]struct{}, len(restaurants))
+	for _, restaurant := range restaurants {
+		merchants[normalize(restaurant.SwitchT)] = struct{}{}
+	}
+	cardGroups := make(map[string]struct{}, len(groups))
+	for _, group := range groups {
+		cardGroups[normalize(group.Id)] = struct{}{}
+	}
+	catalog.mu.Lock()
+	catalog.merchants = merchants
+	catalog.cardGroups = cardGroups
+	catalog.loadedAt = time.Now()
+	catalog.mu.Unlock()
+	return nil
+}
+
+func (catalog *Catalog) HasMerchant(merchantId string) bool {
+	catalog.mu.RLock()
+	defer catalog.mu.RUnlock()
+	_, exists := catalog.merchants[normalize(merchantId)]
+	return exists
+}
+
+func (catalog *Catalog) HasCardGroup(idGrupoTarjeta string) bool {
+	catalog.mu.RLock()
+	defer catalog.mu.RUnlock()
+	_, exists := catalog.cardGroups[normalize(idGrupoTarjeta)]
+	return exists
+}
+
+// SIR guarda los ids en columnas CHAR/VARCHAR con espacios a la derecha
+func normalize(id string) string {
+	return strings.ToUpper(strings.TrimSpace(id))
+}
@@ -0,0 +1,18 @@
+package sir_validation
+
+import "time"
+
+// QuarantinedRow es una fila que sir-writer no escribió en SIR porque no pasó la validación, queda guardada
+// con el wrapper y la conciliación de origen para corregirla y reenviarla.
+type QuarantinedRow struct {
+	ConciliatorId string      `json:"conciliatorId" bson:"conciliatorId"`
+	WrapperId     string      `json:"wrapperId" bson:"wrapperId"`
+	Provider      string      `json:"provider" bson:"provider"`
+	UniqueId      string      `json:"uniqueId" bson:"uniqueId"`
+	Operation     string      `json:"operation" bson:"operation"`
+	Hash          string      `json:"hash" bson:"hash"`
+	Table         string      `json:"table" bson:"table"`
+	Data          any         `json:"data" bson:"data"`
+	Violations    []Violation `json:"violations" bson:"violations"`
+	CreatedAt     time.Time   `json:"createdAt" bson:"createdAt"`
+}
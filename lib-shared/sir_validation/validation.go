@@ -0,0 +1,158 @@
+package sir_validation
+
+import (
+	"fmt"
+	"lib-shared/sir_models"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formatos que acepta SIR en Fecha_Transaccion y Hora_Transaccion. Kioscos y Datafast envían la hora sin
+// separadores, De Una la envía tal como llega de la API.
+const FechaLayout = "2006-01-02"
+
+var HoraLayouts = []string{"150405", "15:04:05"}
+
+// fecha mínima aceptada, los mappers que no logran parsear la fecha del proveedor devuelven 0001-01-01
+var minFecha = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Violation es un campo de la fila que no se puede escribir en SIR.
+type Violation struct {
+	Field   string `json:"field" bson:"field"`
+	Value   string `json:"value" bson:"value"`
+	Message string `json:"message" bson:"message"`
+}
+
+func (violation Violation) String() string {
+	return fmt.Sprintf("%s='%s': %s", violation.Field, violation.Value, violation.Message)
+}
+
+// Summary une las violaciones en un solo texto para syncError y los reportes.
+func Summary(violations []Violation) string {
+	messages := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		messages = append(messages, violation.String())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ValidateTransaction revisa una fila de ST_Transaccional antes de escribirla. Con catalog nil solo se
+// validan los campos y formatos, sin consultar los ids en SIR.
+func ValidateTransaction(data sir_models.StTransactions, catalog *Catalog) []Violation {
+	violations := make([]Violation, 0)
+	violations = required(violations, "MerchantId", data.MerchantId)
+	violations = required(violations, "IdGrupoTarjeta", data.IdGrupoTarjeta)
+	violations = required(violations, "Sistema", data.Sistema)
+	violations = fecha(violations, data.FechaTransaccion)
+	violations = hora(violations, data.HoraTransaccion, true)
+	violations = faceValue(violations, data.FaceValue, true)
+	// getTipoSwitch y getOrigen de Datafast devuelven -1 cuando el MID no está en el cache
+	if data.TipoSwitch <= 0 {
+		violations = append(violations, Violation{Field: "TipoSwitch", Value: strconv.Itoa(data.TipoSwitch), Message: "tipo de switch no resuelto"})
+	}
+	if data.OrigenTransaccion <= 0 {
+		violations = append(violations, Violation{Field: "OrigenTransaccion", Value: strconv.Itoa(data.OrigenTransaccion), Message: "origen de transacción no resuelto"})
+	}
+	violations = amounts(violations, []amount{
+		{"Subtotal", data.Subtotal},
+		{"Descuento", data.Descuento},
+		{"Iva", data.Iva},
+		{"IvaAplicado", data.IvaAplicado},
+		{"FidelizacionOpera", data.FidelizacionOpera},
+		{"FidelizacionMerca", data.FidelizacionMerca},
+		{"FidelizacionTotal", data.FidelizacionTotal},
+		{"FidelizacionValor", data.FidelizacionValor},
+	})
+	return inCatalog(violations, catalog, data.MerchantId, data.IdGrupoTarjeta)
+}
+
+// ValidateVentaApp revisa una venta de ST_VentasApp, la hora, el valor y el grupo de tarjeta son opcionales
+// (ventas en efectivo) pero si vienen deben tener el formato correcto.
+func ValidateVentaApp(data sir_models.VentasApp, catalog *Catalog) []Violation {
+	violations := make([]Violation, 0)
+	violations = required(violations, "MerchantId", data.MerchantId)
+	violations = required(violations, "CodigoOrden", data.CodigoOrden)
+	violations = required(violations, "Canal", data.Canal)
+	violations = required(violations, "Plataforma", data.Plataforma)
+	violations = fecha(violations, data.FechaTransaccion)
+	violations = hora(violations, data.HoraTransaccion, false)
+	violations = faceValue(violations, data.FaceValue, false)
+	violations = amounts(violations, []amount{
+		{"Subtotal", data.Subtotal},
+		{"Descuento", data.Descuento},
+		{"Iva", data.Iva},
+		{"Propina", data.Propina},
+		{"CostoEnvio", data.CostoEnvio},
+	})
+	return inCatalog(violations, catalog, data.MerchantId, data.IdGrupoTarjeta)
+}
+
+func required(violations []Violation, field string, value string) []Violation {
+	if strings.TrimSpace(value) == "" {
+		return append(violations, Violation{Field: field, Value: value, Message: "campo obligatorio vacío"})
+	}
+	return violations
+}
+
+func fecha(violations []Violation, value string) []Violation {
+	parsed, err := time.Parse(FechaLayout, value)
+	if err != nil {
+		return append(violations, Violation{Field: "FechaTransaccion", Value: value, Message: "la fecha no tiene el formato " + FechaLayout})
+	}
+	if parsed.Before(minFecha) {
+		return append(violations, Violation{Field: "FechaTransaccion", Value: value, Message: "fecha fuera de rango"})
+	}
+	return violations
+}
+
+func hora(violations []Violation, value string, mandatory bool) []Violation {
+	if value == "" && !mandatory {
+		return violations
+	}
+	for _, layout := range HoraLayouts {
+		if _, err := time.Parse(layout, value); err == nil {
+			return violations
+		}
+	}
+	return append(violations, Violation{Field: "HoraTransaccion", Value: value, Message: "la hora no tiene el formato HHMMSS ni HH:MM:SS"})
+}
+
+func faceValue(violations []Violation, value string, mandatory bool) []Violation {
+	if value == "" && !mandatory {
+		return violations
+	}
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return append(violations, Violation{Field: "FaceValue", Value: value, Message: "el valor no es numérico"})
+	}
+	return violations
+}
+
+type amount struct {
+	field string
+	value float32
+}
+
+func amounts(violations []Violation, values []amount) []Violation {
+	for _, item := range values {
+		if math.IsNaN(float64(item.value)) || math.IsInf(float64(item.value), 0) {
+			violations = append(violations, Violation{Field: item.field, Value: fmt.Sprintf("%f", item.value), Message: "el monto no es numérico"})
+		}
+	}
+	return violations
+}
+
+func inCatalog(violations []Violation, catalog *Catalog, merchantId string, idGrupoTarjeta string) []Violation {
+	if catalog == nil {
+		return violations
+	}
+	if strings.TrimSpace(merchantId) != "" && !catalog.HasMerchant(merchantId) {
+		violations = append(violations, Violation{Field: "MerchantId", Value: merchantId, Message: "el merchantId no existe en Restaurante"})
+	}
+	if strings.TrimSpace(idGrupoTarjeta) != "" && !catalog.HasCardGroup(idGrupoTarjeta) {
+		violations = append(violations, Violation{Field: "IdGrupoTarjeta", Value: idGrupoTarjeta, Message: "el grupo de tarjeta no existe en ST_Grupo_Tarjeta"})
+	}
+	return violations
+}
@@ -0,0 +1,139 @@
+package topology
+
+import (
+	"lib-shared/infrastructure/messaging_nats"
+	"lib-shared/reports_models"
+	"lib-shared/services_models"
+	"lib-shared/sir_models"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Streams del conciliador, todos son colas de trabajo: cada mensaje lo procesa un solo consumer y se borra
+// con el Ack.
+const (
+	ServicesStream  = "conciliador-tarjetas-services"
+	SirWriterStream = "conciliador-tarjetas"
+	ReportStream    = "conciliador-tarjetas-report"
+)
+
+// durables de los consumers declarados
+const (
+	KioscoServices     = "KIOSCO_SERVICES"
+	DatafastServices   = "DATAFAST_SERVICES"
+	SirWriter          = "SIR_WRITER"
+	SirWriterVentasApp = "SIR_WRITER_VENTASAPP"
+	SirWriterRollback  = "SIR_WRITER_ROLLBACK"
+	NewReports         = "NEW_REPORTS"
+	AddReports         = "ADD_REPORTS"
+	StartedReport      = "STARTED_REPORT"
+	CompletedReport    = "COMPLETED_REPORT"
+	SirReports         = "SIR_REPORTS"
+	RollbackReports    = "ROLLBACK_REPORTS"
+	RunStatusReports   = "RUN_STATUS_REPORTS"
+	StoreReports       = "STORE_REPORTS"
+)
+
+var (
+	// una réplica de proveedor procesa una conciliación a la vez, las demás quedan para las otras réplicas
+	servicesPool = messaging_nats.WorkerPool{Workers: 1}
+	// las escrituras en SIR de distintos wrappers no dependen del orden
+	sirWriterPool = messaging_nats.WorkerPool{Workers: 4}
+	// un wrapper que falla suele ser SIR caído o bloqueado, se reintenta cada 30 segundos hasta 5 entregas
+	sirWriterPolicy = messaging_nats.RetryPolicy{MaxDeliver: 5, Backoff: []time.Duration{30 * time.Second}}
+	// las escrituras de reportes en Mongo no dependen del orden
+	reportPool = messaging_nats.WorkerPool{Workers: 4}
+)
+
+// LocksBucket guarda un lock por solicitud (hash de servicio y fecha) mientras la conciliación corre, el TTL
+// libera el lock de un proveedor que murió sin soltarlo.
+var LocksBucket = messaging_nats.BucketSpec{
+	Name:        "CONCILIATOR_LOCKS",
+	Description: "locks de las conciliaciones en ejecución",
+	TTL:         2 * time.Hour,
+	History:     1,
+	Replicas:    1,
+}
+
+// ProgressBucket guarda el progreso que publican los proveedores y muestran api-central y report-system.
+var ProgressBucket = messaging_nats.BucketSpec{
+	Name:        "CONCILIATORS_PROGRESS",
+	Description: "progreso de las conciliaciones en ejecución",
+	TTL:         2 * time.Hour,
+	History:     1,
+	Replicas:    1,
+}
+
+// SirWriterMaxAge es lo que un wrapper puede esperar en SirWriterStream antes de descartarse, un pago que sigue
+// PENDING después de ese tiempo ya no tiene su wrapper en el stream.
+const SirWriterMaxAge = 3 * (24 * time.Hour)
+
+// Conciliador es la topología que reconcilia cada servicio al conectarse a NATS y que compara el comando
+// "api-central topology".
+var Conciliador = messaging_nats.Topology{
+	Streams: []messaging_nats.StreamSpec{
+		{
+			Name:      ServicesStream,
+			Subjects:  []string{"*.services.dispatch"},
+			Retention: jetstream.WorkQueuePolicy,
+			MaxAge:    1 * time.Hour,
+			Replicas:  1,
+		},
+		{
+			Name: SirWriterStream,
+			Subjects: []string{
+				sir_models.TransactionsEvent.Subject,
+				sir_models.VentasAppEvent.Subject,
+				sir_models.RollbackEvent.Subject,
+			},
+			Retention: jetstream.WorkQueuePolicy,
+			MaxAge:    SirWriterMaxAge,
+			Replicas:  1,
+		},
+		{
+			Name:      ReportStream,
+			Subjects:  []string{"*.data.report"},
+			Retention: jetstream.WorkQueuePolicy,
+			MaxAge:    24 * time.Hour,
+			Replicas:  1,
+		},
+		messaging_nats.DeadLetterStreamSpec,
+	},
+	Consumers: []messaging_nats.ConsumerSpec{
+		{Stream: ServicesStream, Durable: KioscoServices, Subject: services_models.DispatchEvent("kiosco").Subject, Pool: servicesPool, Policy: messaging_nats.DefaultRetryPolicy},
+		{Stream: ServicesStream, Durable: DatafastServices, Subject: services_models.DispatchEvent("datafast").Subject, Pool: servicesPool, Policy: messaging_nats.DefaultRetryPolicy},
+		{Stream: SirWriterStream, Durable: SirWriter, Subject: sir_models.TransactionsEvent.Subject, Pool: sirWriterPool, Policy: sirWriterPolicy},
+		{Stream: SirWriterStream, Durable: SirWriterVentasApp, Subject: sir_models.VentasAppEvent.Subject, Pool: sirWriterPool, Policy: sirWriterPolicy},
+		{Stream: SirWriterStream, Durable: SirWriterRollback, Subject: sir_models.RollbackEvent.Subject, Pool: sirWriterPool, Policy: sirWriterPolicy},
+		{Stream: ReportStream, Durable: NewReports, Subject: reports_models.NewReportEvent.Subject, Pool: reportPool, Policy: messaging_nats.DefaultRetryPolicy},
+		{Stream: ReportStream, Durable: AddReports, Subject: reports_models.AddReportEvent.Subject, Pool: reportPool, Policy: messaging_nats.DefaultRetryPolicy},
+		{Stream: ReportStream, Durable: StartedReport, Subject: reports_models.StartedReportEvent.Subject, Pool: reportPool, Policy: messaging_nats.DefaultRetryPolicy},
+		{Stream: ReportStream, Durable: CompletedReport, Subject: reports_models.CompletedReportEvent.Subject, Pool: reportPool, Policy: messaging_nats.DefaultRetryPolicy},
+		{Stream: ReportStream, Durable: SirReports, Subject: reports_models.SirWriteReportEvent.Subject, Pool: reportPool, Policy: messaging_nats.DefaultRetryPolicy},
+		{Stream: ReportStream, Durable: RollbackReports, Subject: reports_models.SirRollbackReportEvent.Subject, Pool: reportPool, Policy: messaging_nats.DefaultRetryPolicy},
+		{Stream: ReportStream, Durable: RunStatusReports, Subject: reports_models.RunStatusReportEvent.Subject, Pool: reportPool, Policy: messaging_nats.DefaultRetryPolicy},
+		{Stream: ReportStream, Durable: StoreReports, Subject: reports_models.StoreOutcomeEvent.Subject, Pool: reportPool, Policy: messaging_nats.DefaultRetryPolicy},
+	},
+	Buckets: []messaging_nats.BucketSpec{LocksBucket, ProgressBucket},
+}
+
+// Consumer devuelve el consumer declarado en Conciliador, un durable que no existe es un error de programación.
+func Consumer(durable string) messaging_nats.ConsumerSpec {
+	spec, err := Conciliador.Consumer(durable)
+	if err != nil {
+		panic(err)
+	}
+	return spec
+}
+
+// Locks son los locks de las solicitudes de conciliación, por hash de la solicitud y con el id de la
+// conciliación que lo tiene.
+func Locks(starter *messaging_nats.NatsStarter) messaging_nats.Lock {
+	return messaging_nats.NewLock(starter, LocksBucket)
+}
+
+// Progress es el progreso de las conciliaciones, por id de la conciliación.
+func Progress(starter *messaging_nats.NatsStarter) messaging_nats.KeyValue[reports_models.Progress] {
+	return messaging_nats.NewKeyValue[reports_models.Progress](starter, ProgressBucket)
+}
@@ -4,6 +4,8 @@ import (
 	"api-starter-jobs/internal/config"
 	"api-starter-jobs/internal/server"
 	"api-starter-jobs/utils"
+	"flag"
+	"os"
 )
 
 /*
@@ -12,9 +14,27 @@ import (
 * Este microservicio está diseñado para ejecutarse como un CronJob dentro de un clúster de Kubernetes.
 * El servicio de DATAFAST se encarga de generar y proporcionar el reporte de las transacciones
 * 24 horas después de haber efectuado el corte del lote.
+*
+* Comandos:
+*   api-central                                 atiende la API del conciliador
+*   api-central topology [-apply]               muestra las diferencias entre la topología declarada y
+*                                               JetStream, con -apply las reconcilia
  */
 func main() {
 	cfg := config.LoadConfig()
+	if len(os.Args) > 1 && os.Args[1] == "topology" {
+		runTopology(cfg, os.Args[2:])
+		return
+	}
 	server.NewContainer(cfg)
-	utils.Info.Println("✅ Servicio inicializado")
+	utils.Info.Println("✅ Servicio finalizado")
+}
+
+func runTopology(cfg config.Config, args []string) {
+	topologyFlags := flag.NewFlagSet("topology", flag.ExitOnError)
+	apply := topologyFlags.Bool("apply", false, "crea o actualiza los streams y consumers que difieren")
+	topologyFlags.Parse(args)
+	if err := server.RunTopology(cfg, *apply); err != nil {
+		utils.Error.Fatalf("[topology] %v", err)
+	}
 }
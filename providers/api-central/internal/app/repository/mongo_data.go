@@ -2,7 +2,11 @@ package repository
 
 import (
 	"api-starter-jobs/internal/config"
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"lib-shared/reports_models"
 )
 
 type MerchantPaymentHash struct {
@@ -13,9 +17,28 @@ type MerchantPaymentHash struct {
 type MongoDataRepository struct {
 	Client             *mongo.Client
 	DatafastCollection *mongo.Collection
+	ReportCollection   *mongo.Collection
 }
 
 func NewMongoDataRepository(client *mongo.Client, cfg config.Config) *MongoDataRepository {
 	DatafastCollection := client.Database(cfg.Mongo.Database).Collection("fetch-deunapichincha")
-	return &MongoDataRepository{Client: client, DatafastCollection: DatafastCollection}
+	ReportCollection := client.Database(cfg.Mongo.Database).Collection("reports")
+	return &MongoDataRepository{Client: client, DatafastCollection: DatafastCollection, ReportCollection: ReportCollection}
+}
+
+// FindReport devuelve el reporte de la conciliación que guarda report-system, nil si no existe.
+func (receiver *MongoDataRepository) FindReport(conciliatorId string) (*reports_models.ReportConciliator, error) {
+	var report reports_models.ReportConciliator
+	err := receiver.ReportCollection.FindOne(context.Background(), bson.M{"conciliatorId": conciliatorId}).Decode(&report)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (receiver *MongoDataRepository) Close() {
+	receiver.Client.Disconnect(context.Background())
 }
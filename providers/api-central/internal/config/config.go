@@ -3,6 +3,7 @@ package config
 import (
 	"api-starter-jobs/utils"
 	"github.com/joho/godotenv"
+	"lib-shared/infrastructure/messaging_nats"
 	"log"
 	"os"
 )
@@ -10,7 +11,7 @@ import (
 type Config struct {
 	HttpServer string
 	Mongo      MongoConfig
-	Nats       NatsConfig
+	Nats       messaging_nats.Connection
 	TimeZone   string
 }
 
@@ -18,9 +19,7 @@ type MongoConfig struct {
 	URI      string
 	Database string
 }
-type NatsConfig struct {
-	URI string
-}
+
 type SqlServerSir struct {
 	JDBC string
 }
@@ -40,9 +39,7 @@ func LoadConfig() Config {
 			URI:      getEnv("MONGO_URI", "no_configurado"),
 			Database: getEnv("MONGO_DATABASE", "no_configurado"),
 		},
-		Nats: NatsConfig{
-			URI: getEnv("NATS_URI", "no_configurado"),
-		},
+		Nats:     messaging_nats.ConnectionFromEnv(),
 		TimeZone: getEnv("TIMEZONE", "no_configurado"),
 	}
 }
@@ -5,38 +5,46 @@ import (
 	"api-starter-jobs/internal/app/repository"
 	"api-starter-jobs/internal/config"
 	"api-starter-jobs/utils"
+	"context"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"lib-shared/infrastructure/messaging_nats"
 	"lib-shared/reports_models"
 	"lib-shared/services_models"
+	"lib-shared/sir_models"
+	"lib-shared/topology"
 	utils2 "lib-shared/utils"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
+// tiempo que se espera a las peticiones en proceso y a las publicaciones pendientes al recibir SIGTERM
+const shutdownTimeout = 20 * time.Second
+
 var nats *messaging_nats.NatsStarter
 var location *time.Location
 var repositoryData *repository.MongoDataRepository
 
-var (
-	BucketNameLocker       = "CONCILIATOR_LOCKS"
-	BucketServicesProgress = "CONCILIATORS_PROGRESS"
-)
-
+// NewContainer atiende la API hasta recibir SIGINT o SIGTERM, y vuelve cuando las peticiones en proceso
+// terminaron y las publicaciones pendientes a NATS quedaron confirmadas.
 func NewContainer(cfg config.Config) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	mongoClient, err := db.NewMongoClient(cfg.Mongo.URI)
 	if err != nil {
 		utils.Error.Panic("Error creando el cliente de MongoDB: %v", err)
 	}
 	repositoryData = repository.NewMongoDataRepository(mongoClient, cfg)
 	// Conectar a NATS
-	nats = messaging_nats.NewStartNats(cfg.Nats.URI, &messaging_nats.OptsNats{
-		NameStream: "conciliador-tarjetas-services",
-		Subjects:   []string{"*.services.dispatch"},
-		MaxAge:     1 * time.Hour,
-	})
+	nats, err = messaging_nats.NewStartNats(cfg.Nats, &messaging_nats.OptsNats{Topology: &topology.Conciliador})
+	if err != nil {
+		utils.Error.Fatalf("Error conectando a NATS: %v", err)
+	}
 	location, err = time.LoadLocation(cfg.TimeZone)
 	if err != nil {
 		utils.Error.Panic("Error al cargar la zona horaria: ", err)
@@ -45,8 +53,26 @@ func NewContainer(cfg config.Config) {
 	app := fiber.New()
 	group := app.Group("/api/payment-conciliator")
 	group.Post("/generate-conciliator", handlerProcessConciliador)
+	group.Post("/rollback-conciliator/:id", handlerRollbackConciliador)
+	group.Get("/dead-letters", handlerListDeadLetters)
+	group.Post("/dead-letters/:seq/replay", handlerReplayDeadLetter)
+	go func() {
+		<-ctx.Done()
+		utils.Warning.Println("[shutdown] señal recibida, se detiene el servidor http")
+		if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+			utils.Error.Printf("[shutdown] error al detener el servidor http: %v\n", err)
+		}
+	}()
 	utils.Info.Println("Servidor en http://" + cfg.HttpServer)
-	app.Listen(cfg.HttpServer)
+	if err := app.Listen(cfg.HttpServer); err != nil {
+		utils.Error.Printf("error en el servidor http: %v\n", err)
+		stop()
+	}
+	<-ctx.Done()
+	if err := nats.Shutdown(shutdownTimeout); err != nil {
+		utils.Error.Printf("[shutdown] %v\n", err)
+	}
+	repositoryData.Close()
 }
 
 type RequestBody struct {
@@ -110,30 +136,227 @@ func handlerProcessConciliador(c *fiber.Ctx) error {
 		StartedAt:     nil,
 		CompletedAt:   nil,
 		Request:       request,
+		Status:        reports_models.RunQueued,
 	}
 	hash := request.Hash()
-	locked, err := nats.AcquiredLock(BucketNameLocker, hash)
+	locked, err := topology.Locks(nats).Acquire(hash, uidAsString)
 	if err != nil {
 		utils.Error.Println("Error al acquirar el locked: %v", err)
 	}
 	if !locked {
-		progress, err := nats.GetValueBucket(BucketServicesProgress, hash)
-		if err != nil {
-			utils.Error.Printf("Error al obtener el progreso de la operación: %v", err)
-		}
-
-		utils.Error.Printf("Ya existe un proceso en progreso al [ %s%% ] para la fecha [ %s ] del servicio [ %s ]", progress, body.Fecha, serviceConciliator)
-		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{
-			Error: fmt.Sprintf("Existe una transacción en ejecución con progreso [ %s%% ] para la fecha [ %s ] del servicio [ %s ], espera a que finalice para continuar", progress, body.Fecha, serviceConciliator),
+		progress := runningProgress(hash)
+		utils.Error.Printf("Ya existe un proceso en progreso al [ %.2f%% ] para la fecha [ %s ] del servicio [ %s ]", progress.Percent, body.Fecha, serviceConciliator)
+		return c.Status(fiber.StatusConflict).JSON(ConflictResponse{
+			Error:    fmt.Sprintf("Existe una transacción en ejecución con progreso [ %.2f%% ] para la fecha [ %s ] del servicio [ %s ], espera a que finalice para continuar", progress.Percent, body.Fecha, serviceConciliator),
+			Progress: progress,
 		})
 	}
 
 	message := services_models.ServiceMessageDate{ConciliatorId: uidAsString, ProcessDate: parsedDate.UTC(), HashId: hash}
-	nats.EventSender.SendMsgBytesJson("new.data.report", report)
-	nats.EventSender.SendMsgBytesJson(fmt.Sprintf("%s.services.dispatch", serviceConciliator), message)
+	if err := reports_models.NewReportEvent.Publish(nats.EventSender, uidAsString, report); err != nil {
+		return publishFailed(c, hash, err)
+	}
+	if err := services_models.DispatchEvent(serviceConciliator).Publish(nats.EventSender, uidAsString, message); err != nil {
+		// el reporte ya quedó creado, se cancela para que no lo marque como vencido el watchdog
+		publishStatus(uidAsString, reports_models.RunCancelled, fmt.Sprintf("no se pudo despachar al proveedor: %v", err))
+		return publishFailed(c, hash, err)
+	}
+	publishStatus(uidAsString, reports_models.RunDispatched, "")
 	return c.Status(fiber.StatusOK).JSON(SuccessResponse{
 		Id:      uidAsString,
 		Hash:    hash,
 		Message: fmt.Sprintf("Obteniendo datos de conciliación para el servicio [%s] en la fecha [%s](AAAA-MM-DD)", strings.ToUpper(serviceConciliator), formateada),
 	})
 }
+
+// ConflictResponse es la respuesta cuando la misma solicitud ya se está conciliando, con su progreso.
+type ConflictResponse struct {
+	Error    string                  `json:"error"`
+	Progress reports_models.Progress `json:"progress"`
+}
+
+// runningProgress es el progreso de la conciliación que tiene el lock de la solicitud, vacío si todavía no
+// publicó progreso.
+func runningProgress(hash string) reports_models.Progress {
+	conciliatorId, found, err := topology.Locks(nats).Owner(hash)
+	if err != nil || !found {
+		if err != nil {
+			utils.Error.Printf("Error al obtener la conciliación en ejecución: %v\n", err)
+		}
+		return reports_models.Progress{}
+	}
+	progress, found, err := topology.Progress(nats).Get(conciliatorId)
+	if err != nil {
+		utils.Error.Printf("Error al obtener el progreso de la operación: %v\n", err)
+	}
+	if !found {
+		return reports_models.Progress{ConciliatorId: conciliatorId}
+	}
+	return progress
+}
+
+// publishStatus informa a report-system el estado de la conciliación, si falla solo se registra porque la
+// conciliación sigue igual y el proveedor informa los siguientes estados.
+func publishStatus(conciliatorId string, status reports_models.RunStatus, reason string) {
+	statusReport := reports_models.RunStatusReport{ConciliatorId: conciliatorId, Status: status, Reason: reason, At: time.Now()}
+	if err := reports_models.RunStatusReportEvent.Publish(nats.EventSender, conciliatorId, statusReport); err != nil {
+		utils.Error.Printf("error al informar el estado %s de la conciliación %s: %v\n", status, conciliatorId, err)
+	}
+}
+
+// publishFailed libera el lock de la conciliación que no se pudo despachar, así se puede volver a solicitar.
+func publishFailed(c *fiber.Ctx, hash string, err error) error {
+	utils.Error.Printf("error al despachar la conciliación: %v\n", err)
+	if unlockErr := topology.Locks(nats).Release(hash); unlockErr != nil {
+		utils.Error.Printf("error al liberar el lock %s: %v\n", hash, unlockErr)
+	}
+	return c.Status(fiber.StatusServiceUnavailable).JSON(ErrorResponse{
+		Error: fmt.Sprintf("No se pudo despachar la conciliación, intenta nuevamente: %v", err),
+	})
+}
+
+type RollbackRequestBody struct {
+	Reason string `json:"reason"`
+}
+
+type RollbackResponse struct {
+	Id            string `json:"id"`
+	ConciliatorId string `json:"conciliatorId"`
+	Message       string `json:"message"`
+}
+
+// handlerRollbackConciliador pide a sir-writer revertir lo que la conciliación escribió en SIR,
+// el resultado queda registrado en el reporte de la conciliación.
+func handlerRollbackConciliador(c *fiber.Ctx) error {
+	conciliatorId := strings.TrimSpace(c.Params("id"))
+	if utils2.IsEmptyString(conciliatorId) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "Debes especificar el id de la conciliación",
+		})
+	}
+	var body RollbackRequestBody
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error: "JSON inválido",
+			})
+		}
+	}
+	report, err := repositoryData.FindReport(conciliatorId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Error al obtener la conciliación: %v", err),
+		})
+	}
+	if report == nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error: fmt.Sprintf("No existe la conciliación [ %s ]", conciliatorId),
+		})
+	}
+	// mientras la conciliación siga escribiendo en SIR el rollback dejaría filas sin revertir, una vencida por el
+	// watchdog ya no escribe. Los reportes previos al estado solo tienen completedAt.
+	if !report.Status.Terminal() && (report.Status != "" || report.CompletedAt == nil) {
+		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{
+			Error: fmt.Sprintf("La conciliación [ %s ] no ha finalizado, espera a que termine para revertirla", conciliatorId),
+		})
+	}
+	uid, _ := uuid.NewV7()
+	request := sir_models.RollbackRequest{
+		Id:            uid.String(),
+		ConciliatorId: conciliatorId,
+		Reason:        strings.TrimSpace(body.Reason),
+		RequestedAt:   time.Now(),
+	}
+	if err := sir_models.RollbackEvent.PublishWithId(nats.EventSender, request.Id, conciliatorId, request); err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(ErrorResponse{
+			Error: fmt.Sprintf("No se pudo solicitar el rollback: %v", err),
+		})
+	}
+	if err := reports_models.AddReportEvent.Publish(nats.EventSender, conciliatorId, reports_models.ReportData{
+		ConciliatorId: conciliatorId,
+		Type:          "INFO",
+		Message:       fmt.Sprintf("Rollback %s solicitado: %s", request.Id, request.Reason),
+		CreatedAt:     request.RequestedAt,
+	}); err != nil {
+		utils.Error.Printf("error al registrar la solicitud de rollback %s en el reporte: %v\n", request.Id, err)
+	}
+	return c.Status(fiber.StatusAccepted).JSON(RollbackResponse{
+		Id:            request.Id,
+		ConciliatorId: conciliatorId,
+		Message:       fmt.Sprintf("Revirtiendo en SIR lo escrito por la conciliación [%s], el resultado quedará en su reporte", conciliatorId),
+	})
+}
+
+// máximo de mensajes del dead-letter que devuelve una consulta
+const maxDeadLetters = 200
+
+// handlerListDeadLetters lista los mensajes que los listeners mandaron al dead-letter, filtrando por el stream
+// de origen (?stream=) y paginando por secuencia (?from=&limit=).
+func handlerListDeadLetters(c *fiber.Ctx) error {
+	fromSeq, err := strconv.ParseUint(c.Query("from", "1"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "El parámetro from debe ser una secuencia numérica",
+		})
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "50"))
+	if err != nil || limit <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "El parámetro limit debe ser un número mayor a cero",
+		})
+	}
+	if limit > maxDeadLetters {
+		limit = maxDeadLetters
+	}
+	deadLetters, err := nats.ListDeadLetters(strings.TrimSpace(c.Query("stream")), fromSeq, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Error al leer el dead-letter: %v", err),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(deadLetters)
+}
+
+// handlerReplayDeadLetter vuelve a publicar un mensaje del dead-letter en su subject original para que el
+// listener lo procese otra vez.
+func handlerReplayDeadLetter(c *fiber.Ctx) error {
+	seq, err := strconv.ParseUint(c.Params("seq"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error: "La secuencia del mensaje debe ser numérica",
+		})
+	}
+	deadLetter, err := nats.ReplayDeadLetter(seq)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error: fmt.Sprintf("Error al reenviar el mensaje: %v", err),
+		})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(deadLetter)
+}
+
+// RunTopology imprime las diferencias entre topology.Conciliador y JetStream, y con apply las reconcilia. No
+// reconcilia al conectar para que el diff muestre el estado real.
+func RunTopology(cfg config.Config, apply bool) error {
+	natsManager, err := messaging_nats.NewStartNats(cfg.Nats, nil)
+	if err != nil {
+		return err
+	}
+	defer natsManager.Close()
+	js := natsManager.ManagerDataNats.GetJetStream()
+	changes, err := messaging_nats.Diff(js, topology.Conciliador)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Println("sin diferencias")
+		return nil
+	}
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	if !apply {
+		return nil
+	}
+	return messaging_nats.Reconcile(js, topology.Conciliador)
+}
@@ -1,45 +1,75 @@
 package server
 
 import (
+	"context"
 	db "datafast-services/internal/app/databases"
 	"datafast-services/internal/app/repository"
 	"datafast-services/internal/config"
 	"datafast-services/internal/service"
 	"datafast-services/utils"
-	"encoding/json"
-	"github.com/nats-io/nats.go/jetstream"
+	"errors"
 	"lib-shared/infrastructure/messaging_nats"
 	"lib-shared/services_models"
+	"lib-shared/sir_repository"
+	"lib-shared/topology"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-var exit = make(chan os.Signal, 1)
+// tiempo que se espera a la consulta en proceso al recibir SIGTERM, si no termina el mensaje vuelve a la cola
+const shutdownTimeout = 20 * time.Second
 
+// NewContainer atiende las solicitudes del proveedor hasta recibir SIGINT o SIGTERM y vuelve cuando la consulta
+// en proceso terminó (o se devolvió con NAK) y las conexiones quedaron cerradas.
 func NewContainer(cfg config.Config) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	mongoClient, err := db.NewMongoClient(cfg.Mongo.URI)
 	if err != nil {
 		utils.Error.Panic("Error creando el cliente de MongoDB: %v", err)
 	}
 	mongoDataRepository := repository.NewMongoDataRepository(mongoClient, cfg)
 	// Conectar a NATS
-	natsManager := messaging_nats.NewStartNats(cfg.Nats.URI, nil)
-	cache := service.NewDataCacheRestaurant(cfg)
+	natsManager, err := messaging_nats.NewStartNats(cfg.Nats, &messaging_nats.OptsNats{Topology: &topology.Conciliador})
+	if err != nil {
+		utils.Error.Fatalf("Error conectando a NATS: %v", err)
+	}
+	sirRepository, err := sir_repository.NewSirRepository(sir_repository.Options{
+		Driver:      cfg.SqlServerSir.Driver,
+		DSN:         cfg.SqlServerSir.JDBC,
+		FixturesDir: cfg.SqlServerSir.Fixtures,
+	})
+	if err != nil {
+		utils.Error.Panicf("Error conectando a la base SIR: %v", err)
+	}
+	cache := service.NewDataCacheRestaurant(sirRepository)
 	cache.LoadRestaurantAndGrupo()
 	provider := service.NewApiProvider(mongoDataRepository, natsManager, cfg, cache)
-	err = natsManager.EventListener.Execute("conciliador-tarjetas-services", exit, 1, "datafast.services.dispatch", "DATAFAST_SERVICES", func(msg jetstream.Msg) {
-		var serviceMessage services_models.ServiceMessageDate
-		err := json.Unmarshal(msg.Data(), &serviceMessage)
-		if err != nil {
-			utils.Error.Println("error al deserializar el mensaje para datafast service", err)
-			msg.Ack()
-			return
-		}
+	// una consulta a la vez por réplica, con heartbeats mientras dura; los errores de la consulta se informan a
+	// report-system y la conciliación se completa, solo un mensaje que no se puede deserializar termina en el
+	// dead-letter
+	err = services_models.DispatchEvent("datafast").Consume(ctx, natsManager.EventListener, topology.Consumer(topology.DatafastServices), func(event messaging_nats.Envelope[services_models.ServiceMessageDate]) error {
 		utils.Warning.Println("Procesando Datafast ------------> [ subscripcion ]")
-		provider.RetrievePayments(serviceMessage.ConciliatorId, serviceMessage.HashId, serviceMessage.ProcessDate)
-		msg.Ack()
+		provider.RetrievePayments(event.Data.ConciliatorId, event.Data.HashId, event.Data.ProcessDate)
+		return nil
 	})
 	if err != nil {
 		utils.Error.Panic("Error creando el Listener de Nats.IO:", err)
 	}
-	select {}
+	<-ctx.Done()
+	utils.Warning.Println("[shutdown] señal recibida, se deja de consumir y se espera la consulta en proceso")
+	if err := natsManager.Shutdown(shutdownTimeout); err != nil {
+		utils.Error.Printf("[shutdown] %v\n", err)
+		if errors.Is(err, messaging_nats.ErrHandlersRunning) {
+			// la consulta en proceso sigue guardando pagos y publicando wrappers, cerrar SIR o Mongo la cortaría
+			utils.Warning.Println("[shutdown] hay una consulta en proceso, no se cierran las conexiones a SIR y MongoDB")
+			return
+		}
+	}
+	if err := sirRepository.Close(); err != nil {
+		utils.Error.Printf("[shutdown] error al cerrar la conexión a SIR: %v\n", err)
+	}
+	mongoDataRepository.Close()
 }
@@ -2,13 +2,11 @@ package service
 
 import (
 	"bytes"
-	"context"
 	db "datafast-services/internal/app/databases"
 	"datafast-services/internal/app/repository"
 	"datafast-services/internal/config"
 	"datafast-services/internal/models"
 	"datafast-services/utils"
-	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	uuid2 "github.com/google/uuid"
@@ -17,6 +15,7 @@ import (
 	lib_mapper "lib-shared/mapper"
 	"lib-shared/reports_models"
 	"lib-shared/sir_models"
+	"lib-shared/topology"
 	utils3 "lib-shared/utils"
 	"math"
 	"net/http"
@@ -58,25 +57,25 @@ func NewApiProvider(mongoRepository *repository.MongoDataRepository, natsManager
 	}
 }
 
-var (
-	BucketNameLocker       = "CONCILIATOR_LOCKS"
-	BucketServicesProgress = "CONCILIATORS_PROGRESS"
-)
-
 func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string, processDate time.Time) {
 	// Obtener datos de configuración
-	provider.SetProgress(hash, fmt.Sprintf("%.2f", 0.0))
+	progress := reports_models.NewProgress(conciliatorId, lib_mapper.ProviderDatafast, 3)
+	provider.SetProgress(progress)
+	defer provider.releaseLock(hash)
 	// Leer la fecha para el filtro
 	startedEventMessage := reports_models.StartedReport{
 		ConciliatorId: conciliatorId,
 		StartedTime:   time.Now(),
 	}
 	utils.Info.Println("started.data.report " + conciliatorId)
-	provider.natsManager.EventSender.SendMsgBytesJson("started.data.report", startedEventMessage)
+	if err := reports_models.StartedReportEvent.Publish(provider.natsManager.EventSender, conciliatorId, startedEventMessage); err != nil {
+		utils.Error.Printf("[datafast] no se pudo informar el inicio de la conciliación %s: %v\n", conciliatorId, err)
+	}
 	// Establecer la zona horaria
 	location, err := time.LoadLocation(provider.cfg.TimeZone)
 	if err != nil {
 		utils.Error.Println("Error al cargar la zona horaria: ", err)
+		provider.Fail(conciliatorId, fmt.Sprintf("error al cargar la zona horaria %s: %v", provider.cfg.TimeZone, err))
 		return
 	}
 	// Obtener la fecha y hora actual en la zona horaria especificada
@@ -91,11 +90,10 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 		msg := fmt.Sprintf("error conectando a la base de datos: %v\n", err)
 		utils.Error.Printf(msg)
 		provider.SendErrorConciliator(conciliatorId, msg, nil)
-		provider.Complete(conciliatorId, startExecutor, 0, 0, 0)
+		provider.Fail(conciliatorId, msg)
 		return
 	}
 	defer conn.Close()
-	defer provider.natsManager.AcquiredUnlock(BucketNameLocker, hash)
 	// Ejecutar la consulta y obtener múltiples registros como un slice de mapas
 	query := "select Url_servicio, usuario, contrasena from Configuracion_WebServices where Nombre = 'API_SOAP_DATAFAST'"
 	var url, usuario, clave string
@@ -104,7 +102,7 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 		errMsg := fmt.Sprintf("No se puede continuar con la conciliación: error ejecutando la  consulta: %v", err)
 		utils.Error.Println(errMsg)
 		provider.SendErrorConciliator(conciliatorId, errMsg, nil)
-		provider.Complete(conciliatorId, startExecutor, 0, 0, 0)
+		provider.Fail(conciliatorId, errMsg)
 		return
 	}
 	// Retornar el regex que permitirá validar para no subir totalmente lo que devuelva datafast y solo (lo que corresponde)
@@ -137,7 +135,8 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 		errMsg := fmt.Sprintf("No se puede continuar con la conciliación: Error creando la solicitud: %v", err)
 		utils.Error.Println(errMsg)
 		provider.SendErrorConciliator(conciliatorId, errMsg, datafastMetadata)
-		provider.Complete(conciliatorId, startExecutor, 0, 0, 0)
+		provider.failStores(conciliatorId, reports_models.StoreUnreachable, errMsg)
+		provider.Fail(conciliatorId, errMsg)
 		return
 	}
 
@@ -157,7 +156,8 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 		errMsg := fmt.Sprintf("No se puede continuar con la conciliación: error inicializando la petición Post por SOAP: %v", err)
 		utils.Error.Println(errMsg)
 		provider.SendErrorConciliator(conciliatorId, errMsg, datafastMetadata)
-		provider.Complete(conciliatorId, startExecutor, 0, 0, 0)
+		provider.failStores(conciliatorId, reports_models.StoreUnreachable, errMsg)
+		provider.Fail(conciliatorId, errMsg)
 		return
 	}
 	defer resp.Body.Close()
@@ -167,7 +167,12 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 		errMsg := fmt.Sprintf("error al obtener transacciones de datafast StatusCode: %d, Body: %s", resp.StatusCode, string(errorBody))
 		utils.Error.Println(errMsg)
 		provider.SendErrorConciliator(conciliatorId, errMsg, datafastMetadata)
-		provider.Complete(conciliatorId, startExecutor, 0, 0, 0)
+		status := reports_models.StoreUnreachable
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			status = reports_models.StoreAuthFailed
+		}
+		provider.failStores(conciliatorId, status, errMsg)
+		provider.Fail(conciliatorId, errMsg)
 		return
 	}
 	body, err := io.ReadAll(resp.Body)
@@ -175,7 +180,8 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 		errMsg := fmt.Sprintf("[datafast][ReadAll] No se puede continuar con la conciliación error al interpretar la respuesta de la petición: %v", err)
 		utils.Error.Println(errMsg)
 		provider.SendErrorConciliator(conciliatorId, errMsg, datafastMetadata)
-		provider.Complete(conciliatorId, startExecutor, 0, 0, 0)
+		provider.failStores(conciliatorId, reports_models.StoreUnreachable, errMsg)
+		provider.Fail(conciliatorId, errMsg)
 		return
 	}
 
@@ -186,7 +192,8 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 		errMsg := fmt.Sprintf("No se puede continuar con la conciliación: error procesando el XML SOAP: %v", err)
 		utils.Error.Println(errMsg)
 		provider.SendErrorConciliator(conciliatorId, errMsg, datafastMetadata)
-		provider.Complete(conciliatorId, startExecutor, 0, 0, 0)
+		provider.failStores(conciliatorId, reports_models.StoreUnreachable, errMsg)
+		provider.Fail(conciliatorId, errMsg)
 		return
 	}
 
@@ -203,7 +210,8 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 		errMsg := fmt.Sprintf("No se puede continuar con la conciliación: error procesando el XML embebido: %v", err)
 		utils.Error.Println(errMsg)
 		provider.SendErrorConciliator(conciliatorId, errMsg, datafastMetadata)
-		provider.Complete(conciliatorId, startExecutor, 0, 0, 0)
+		provider.failStores(conciliatorId, reports_models.StoreUnreachable, errMsg)
+		provider.Fail(conciliatorId, errMsg)
 		return
 	}
 	// Recorrer los registros y procesarlos
@@ -212,21 +220,30 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 	originalRecords := *paymentResponse.Records
 	records := make([]models.PaymentData, 0)
 	regexCompile := regexp.MustCompile(provider.cfg.TidsDatafast)
-	provider.SetProgress(hash, "Etapa 1/3 - Filtrando transacciones")
+	progress.StartStage(1, "Filtrando transacciones", len(originalRecords))
+	provider.SetProgress(progress)
 	for _, payment := range originalRecords {
 		if regexCompile.MatchString(payment.TID) && payment.Bin != "179131" {
 			records = append(records, payment)
 		}
 	}
+	progress.Advance(len(originalRecords))
+	provider.SetProgress(progress)
 	paymentResponse.Records = nil
 	sizePayments := len(records)
 	utils.Warning.Printf("[datafast] se procesaran %d pagos", sizePayments)
 	lastReportedProgress := 0.0
+	progress.StartStage(2, "Normalizando pagos", sizePayments)
+	outcomes := provider.catalogOutcomes(conciliatorId)
+	midByUniqueId := make(map[string]string)
 	for i, payment := range records {
 		codCadena := provider.cache.getCodCadena(payment.MID)
 		// Mapeo de los campos
 		merchantId := provider.cache.getMerchantId(payment.MID)
+		outcome := outcomes.store(conciliatorId, payment.MID, merchantId)
+		outcome.Received++
 		if utils3.IsEmptyString(merchantId) {
+			outcome.Unmapped++
 			errMsg := fmt.Sprintf("[datafast] No se encontró el merchantId (No existe o está desactivado) con el MID '%s', autorización '%s',referencia '%s'", payment.MID, payment.Autorizacion, payment.Referencia)
 			utils.Error.Println(errMsg)
 			itemMetadata := &DatafastItemMetadata{
@@ -256,12 +273,13 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 			OrigenTransaccion:  provider.cache.getOrigen(payment.MID),
 			Sistema:            provider.cache.getSistema(payment.MID),
 		}
+		midByUniqueId[transformed.GetUniqueId()] = payment.MID
 		paymentsNormalize = append(paymentsNormalize, lib_mapper.Payment{
 			ConciliatorId: conciliatorId,
 			StoreId:       merchantId,
 			UniqueId:      transformed.GetUniqueId(),
 			Hash:          transformed.GetTransactionHash(),
-			Provider:      "DATAFAST",
+			Provider:      lib_mapper.ProviderDatafast,
 			CreatedAt:     createdAt,
 			Data: lib_mapper.PaymentData{
 				Input:  payment,
@@ -275,12 +293,14 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 		roundedProgress := math.Floor(totalProgress/progressStep) * progressStep
 		if roundedProgress > lastReportedProgress {
 			lastReportedProgress = roundedProgress
-			provider.SetProgress(hash, "Etapa 2/3 - "+fmt.Sprintf("%.2f", totalProgress))
+			progress.Store = merchantId
+			progress.Advance(currentIteration)
+			provider.SetProgress(progress)
 		}
 	}
 	paymentResponse.Records = nil
 	batches := batchProcessPayments(paymentsNormalize, 250)
-	var entriesInserted, entriesUpdated, entriesIgnored uint32
+	var entriesInserted, entriesUpdated, entriesIgnored, wrappersSent, wrappersFailed uint32
 
 	totalBatches := len(batches)
 	// i = 0 [ i + 1 = 1 ]
@@ -290,6 +310,7 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 	// (i + 1) = ?
 	// Regla de 3 para obtener el progreso al 100%
 	lastReportedProgress = 0.0
+	progress.StartStage(3, "Enviando a SIR", totalBatches)
 	for i, batch := range batches {
 		utils.Info.Println(fmt.Sprintf("[Datafast-Insert-Mongo] Procesando batch #%d\n", i+1))
 		StTransactionsData := make([]sir_models.Transaction, 0)
@@ -299,29 +320,43 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 		}
 		// Enviar proceso a SIR con sus respectivas operations
 		findPaymentsHash, _ := provider.mongoRepository.FindPaymentsHash(uniqueIds)
-		for _, payment := range batch {
-			operation := "INSERT"
+		for j, payment := range batch {
+			confirmedHash := ""
+			inFlight := false
 			for _, paymentHash := range findPaymentsHash {
 				if strings.EqualFold(payment.UniqueId, paymentHash.UniqueId) {
-					if strings.EqualFold(payment.Hash, paymentHash.Hash) {
-						operation = "IGNORE"
-						entriesIgnored++
-						continue
-					}
-					operation = "UPDATE"
-					entriesUpdated++
+					confirmedHash = paymentHash.ConfirmedHash()
+					inFlight = paymentHash.InFlight()
 					break
 				}
 			}
-			if operation == "INSERT" {
-				entriesInserted++
+			// se compara contra el hash confirmado por SIR, no contra el último guardado en Mongo
+			operation := lib_mapper.ResolveOperation(payment.Hash, confirmedHash)
+			if inFlight {
+				// el INSERT de una corrida anterior sigue pendiente, se deja a sir-writer o al reintento
+				operation = "IGNORE"
 			}
-
-			if operation == "IGNORE" {
+			outcome := outcomes[midByUniqueId[payment.UniqueId]]
+			switch operation {
+			case "INSERT":
+				entriesInserted++
+				outcome.Inserted++
+			case "UPDATE":
+				entriesUpdated++
+				outcome.Updated++
+			case "IGNORE":
+				entriesIgnored++
+				outcome.Ignored++
 				continue
 			}
+			batch[j].SyncStatus = lib_mapper.SyncPending
+			// un documento previo al estado de sincronización tiene confirmado su hash sin sirHash, se guarda antes de
+			// pisar hash para que la próxima corrida no lo vuelva a enviar como INSERT
+			batch[j].SirHash = confirmedHash
 			StTransactionsData = append(StTransactionsData, sir_models.Transaction{
 				OperationType: operation,
+				UniqueId:      payment.UniqueId,
+				Hash:          payment.Hash,
 				Data:          payment.Data.Output,
 			})
 		}
@@ -331,11 +366,20 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 		}
 		if len(StTransactionsData) > 0 {
 			uuid, _ := uuid2.NewV7()
-			batchAsBytes, _ := json.Marshal(sir_models.WrapperTransactions{
-				Id:           uuid.String(),
-				Transactions: StTransactionsData,
-			})
-			provider.natsManager.EventSender.SendMsgBytes("sir.writer.sttransaction", batchAsBytes)
+			transactionsWrapper := sir_models.WrapperTransactions{
+				Id:            uuid.String(),
+				ConciliatorId: conciliatorId,
+				Provider:      lib_mapper.ProviderDatafast,
+				Transactions:  StTransactionsData,
+			}
+			if err := sir_models.TransactionsEvent.PublishWithId(provider.natsManager.EventSender, transactionsWrapper.Id, transactionsWrapper.ConciliatorId, transactionsWrapper); err != nil {
+				errMsg := fmt.Sprintf("[datafast] no se pudo publicar el wrapper %s con %d pagos, quedan pendientes para el reintento: %v", uuid.String(), len(StTransactionsData), err)
+				utils.Error.Println(errMsg)
+				provider.SendErrorConciliator(conciliatorId, errMsg, nil)
+				wrappersFailed++
+			} else {
+				wrappersSent++
+			}
 		} else {
 			utils.Info.Println(fmt.Sprintf("[Datafast-Publish] no hay datos para modificar (Empty) (ya existe o no hay cambios) #%d\n", i+1))
 		}
@@ -345,10 +389,15 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 		roundedProgress := math.Floor(totalProgress/progressStep) * progressStep
 		if roundedProgress > lastReportedProgress {
 			lastReportedProgress = roundedProgress
-			provider.SetProgress(hash, "Etapa 3/3 - "+fmt.Sprintf("%.2f", totalProgress))
+			progress.Batch = fmt.Sprintf("%d/%d", currentIteration, totalBatches)
+			progress.Advance(currentIteration)
+			provider.SetProgress(progress)
 		}
 	}
-	provider.SetProgress(hash, fmt.Sprintf("%.2f", 100.0))
+	progress.Finish()
+	provider.SetProgress(progress)
+	outcomes.finish()
+	provider.SendStoreOutcomes(outcomes)
 	elapsedExecutor := time.Since(startExecutor)
 	utils.Info.Println("[datafast] pagos completado, la tarea tardó " + utils.FormatDuration(elapsedExecutor))
 	completedEventMessage := reports_models.CompletedReport{
@@ -360,8 +409,12 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 			Updated:  entriesUpdated,
 			Ignored:  entriesIgnored,
 		},
+		Wrappers:      wrappersSent,
+		PublishFailed: wrappersFailed,
+	}
+	if err := reports_models.CompletedReportEvent.Publish(provider.natsManager.EventSender, conciliatorId, completedEventMessage); err != nil {
+		utils.Error.Printf("[datafast] no se pudo informar la finalización de la conciliación %s: %v\n", conciliatorId, err)
 	}
-	provider.natsManager.EventSender.SendMsgBytesJson("completed.data.report", completedEventMessage)
 }
 
 func batchProcessPayments(payments []lib_mapper.Payment, batchSize int) [][]lib_mapper.Payment {
@@ -384,29 +437,31 @@ func formatFecha(fecha string) string {
 	// Formatear la fecha en "Y-m-d"
 	return parsedDate.Format("2006-01-02")
 }
-func (provider *ApiProviderDatafast) Complete(conciliatorId string, startTime time.Time, inserted, updated, ignored uint32) {
-	elapsedExecutor := time.Since(startTime)
-	provider.SetProgress(conciliatorId, fmt.Sprintf("%.2f", 100.0))
-	completedEventMessage := reports_models.CompletedReport{
+
+// Fail informa que la conciliación se abortó, report-system la marca como fallida en lugar de completada con
+// totales en cero.
+func (provider *ApiProviderDatafast) Fail(conciliatorId string, reason string) {
+	statusReport := reports_models.RunStatusReport{
 		ConciliatorId: conciliatorId,
-		CompletedAt:   time.Now(),
-		ElapsedTime:   uint32(elapsedExecutor.Seconds()),
-		Entries: reports_models.EntriesCompletedReport{
-			Inserted: inserted,
-			Updated:  updated,
-			Ignored:  ignored,
-		},
+		Status:        reports_models.RunFailed,
+		Reason:        strings.TrimSpace(reason),
+		At:            time.Now(),
+	}
+	if err := reports_models.RunStatusReportEvent.Publish(provider.natsManager.EventSender, conciliatorId, statusReport); err != nil {
+		utils.Error.Printf("[datafast] no se pudo informar la falla de la conciliación %s: %v\n", conciliatorId, err)
 	}
-	provider.natsManager.EventSender.SendMsgBytesJson("completed.data.report", completedEventMessage)
 }
-func (provider *ApiProviderDatafast) SetProgress(conciliatorId string, progressAsString string) {
-	kv := provider.natsManager.CreateIfNotExistBucket(BucketServicesProgress)
-	if kv != nil {
-		utils.Info.Println("datafast progress " + progressAsString)
-		_, err := kv.Put(context.Background(), conciliatorId, []byte(progressAsString))
-		if err != nil {
-			utils.Error.Printf("Error al cargar guardar el progreso en Nats KV: conciliatorId: %s, %v\n", conciliatorId, err)
-		}
+func (provider *ApiProviderDatafast) SetProgress(progress *reports_models.Progress) {
+	utils.Info.Printf("datafast progress %s %.2f%%\n", progress.Stage, progress.Percent)
+	if err := topology.Progress(provider.natsManager).Put(progress.ConciliatorId, *progress); err != nil {
+		utils.Error.Printf("Error al cargar guardar el progreso en Nats KV: conciliatorId: %s, %v\n", progress.ConciliatorId, err)
+	}
+}
+
+// releaseLock libera la solicitud para que se pueda volver a conciliar la misma fecha.
+func (provider *ApiProviderDatafast) releaseLock(hash string) {
+	if err := topology.Locks(provider.natsManager).Release(hash); err != nil {
+		utils.Error.Printf("[datafast] %v\n", err)
 	}
 }
 func formatHora(fecha string) string {
@@ -440,7 +495,9 @@ func (provider *ApiProviderDatafast) SendInfoConciliator(conciliatorId, message
 		},
 		CreatedAt: time.Now(),
 	}
-	provider.natsManager.EventSender.SendMsgBytesJson("add.data.report", msg)
+	if err := reports_models.AddReportEvent.Publish(provider.natsManager.EventSender, conciliatorId, msg); err != nil {
+		utils.Error.Printf("[datafast] no se pudo agregar al reporte de la conciliación %s: %v\n", conciliatorId, err)
+	}
 }
 func (provider *ApiProviderDatafast) SendErrorConciliator(conciliatorId, message string, metadata any) {
 	msg := reports_models.ReportData{
@@ -452,7 +509,9 @@ func (provider *ApiProviderDatafast) SendErrorConciliator(conciliatorId, message
 		},
 		CreatedAt: time.Now(),
 	}
-	provider.natsManager.EventSender.SendMsgBytesJson("add.data.report", msg)
+	if err := reports_models.AddReportEvent.Publish(provider.natsManager.EventSender, conciliatorId, msg); err != nil {
+		utils.Error.Printf("[datafast] no se pudo agregar al reporte de la conciliación %s: %v\n", conciliatorId, err)
+	}
 }
 func xmlEscapeToNormal(escaped string) string {
 	replacer := strings.NewReplacer(
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"datafast-services/utils"
+	"fmt"
+	lib_mapper "lib-shared/mapper"
+	"lib-shared/reports_models"
+	"slices"
+	"time"
+)
+
+// storeOutcomes es el resultado de cada MID de la conciliación, Datafast devuelve los pagos de todos los locales
+// en una sola respuesta y el resultado se arma agrupando por MID.
+type storeOutcomes map[string]*reports_models.StoreOutcome
+
+// catalogOutcomes arranca con un resultado vacío por cada MID de MIDs_Restaurante, los que no tengan pagos
+// quedan como empty.
+func (provider *ApiProviderDatafast) catalogOutcomes(conciliatorId string) storeOutcomes {
+	outcomes := make(storeOutcomes)
+	for _, restaurante := range provider.cache.RestaurantCache {
+		outcomes.store(conciliatorId, restaurante.MID, restaurante.SwitchT)
+	}
+	return outcomes
+}
+
+// store devuelve el resultado del MID y lo crea si el MID no está en el catálogo.
+func (outcomes storeOutcomes) store(conciliatorId, mid, merchantId string) *reports_models.StoreOutcome {
+	outcome, found := outcomes[mid]
+	if !found {
+		outcome = &reports_models.StoreOutcome{
+			ConciliatorId: conciliatorId,
+			Provider:      lib_mapper.ProviderDatafast,
+			StoreId:       mid,
+			MerchantId:    merchantId,
+		}
+		outcomes[mid] = outcome
+	}
+	return outcome
+}
+
+// finish asigna el estado de cada MID según los pagos que recibió.
+func (outcomes storeOutcomes) finish() {
+	for _, outcome := range outcomes {
+		switch {
+		case outcome.Received == 0:
+			outcome.Status = reports_models.StoreEmpty
+		case outcome.Unmapped == outcome.Received:
+			outcome.Status = reports_models.StoreUnmapped
+			outcome.Reason = fmt.Sprintf("el MID %s no tiene merchantId en MIDs_Restaurante (no existe o está desactivado)", outcome.StoreId)
+		default:
+			outcome.Status = reports_models.StoreOk
+		}
+	}
+}
+
+// failStores informa todos los MID del catálogo con status cuando la consulta a Datafast falló, ningún local
+// se pudo consultar.
+func (provider *ApiProviderDatafast) failStores(conciliatorId string, status reports_models.StoreStatus, reason string) {
+	outcomes := provider.catalogOutcomes(conciliatorId)
+	for _, outcome := range outcomes {
+		outcome.Status = status
+		outcome.Reason = reason
+	}
+	provider.SendStoreOutcomes(outcomes)
+}
+
+// SendStoreOutcomes informa el resultado de cada MID para la cobertura de la conciliación en report-system.
+func (provider *ApiProviderDatafast) SendStoreOutcomes(outcomes storeOutcomes) {
+	at := time.Now()
+	mids := make([]string, 0, len(outcomes))
+	for mid := range outcomes {
+		mids = append(mids, mid)
+	}
+	slices.Sort(mids)
+	for _, mid := range mids {
+		outcome := *outcomes[mid]
+		outcome.At = at
+		if err := reports_models.StoreOutcomeEvent.Publish(provider.natsManager.EventSender, outcome.ConciliatorId, outcome); err != nil {
+			utils.Error.Printf("[datafast] no se pudo informar el resultado del MID %s de la conciliación %s: %v\n", mid, outcome.ConciliatorId, err)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"deunapichincha-services/internal/service"
 	"deunapichincha-services/utils"
 	"lib-shared/infrastructure/messaging_nats"
+	"lib-shared/sir_repository"
+	"lib-shared/topology"
 )
 
 func NewContainer(cfg config.Config) {
@@ -16,8 +18,19 @@ func NewContainer(cfg config.Config) {
 	}
 	mongoDataRepository := repository.NewMongoDataRepository(mongoClient, cfg)
 	// Conectar a NATS
-	natsManager := messaging_nats.NewStartNats(cfg.Nats.URI, nil)
-	cache := service.NewDataCacheRestaurant(cfg)
+	natsManager, err := messaging_nats.NewStartNats(cfg.Nats, &messaging_nats.OptsNats{Topology: &topology.Conciliador})
+	if err != nil {
+		utils.Error.Fatalf("Error conectando a NATS: %v", err)
+	}
+	sirRepository, err := sir_repository.NewSirRepository(sir_repository.Options{
+		Driver:      cfg.SqlServerSir.Driver,
+		DSN:         cfg.SqlServerSir.JDBC,
+		FixturesDir: cfg.SqlServerSir.Fixtures,
+	})
+	if err != nil {
+		utils.Error.Panicf("Error conectando a la base SIR: %v", err)
+	}
+	cache := service.NewDataCacheRestaurant(sirRepository)
 	cache.LoadRestaurant()
 	provider := service.NewApiProvider(mongoDataRepository, natsManager, cfg, cache)
 	provider.RetrievePayments()
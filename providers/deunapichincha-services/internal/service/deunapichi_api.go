@@ -108,6 +108,7 @@ func (provider *ApiProviderDatafast) RetrievePayments() {
 		// Procesar pagos de la página actual
 		for _, payment := range *paymentResponse.Data {
 			merchantId := provider.cache.getMerchantId(payment.Store.Name)
+			// sin conciliación no hay cobertura por local en report-system, el local sin merchantId solo se registra
 			if utils3.IsEmptyString(merchantId) {
 				utils.Error.Printf("[deunapichincha][merchantId] El MerchantId para la autorización '%s', storeName '%s',referencia '%s' está vacia\n", payment.TransferNumber, payment.Store.Name, payment.ReferenceId)
 				continue
@@ -133,7 +134,7 @@ func (provider *ApiProviderDatafast) RetrievePayments() {
 
 			paymentsNormalize = append(paymentsNormalize, lib_mapper.Payment{
 				UniqueId:  transformed.MerchantId + transformed.NumeroAutorizacion + transformed.NumeroLote,
-				Provider:  "DEUNA-PICHI",
+				Provider:  lib_mapper.ProviderDeunaPichincha,
 				CreatedAt: createdAt,
 				Data: lib_mapper.PaymentData{
 					Input:  payment,
@@ -148,23 +149,33 @@ func (provider *ApiProviderDatafast) RetrievePayments() {
 			uniqueIds = append(uniqueIds, payment.UniqueId)
 		}
 		findPaymentsHash, _ := provider.mongoRepository.FindPaymentsHash(uniqueIds)
-		for _, payment := range paymentsNormalize {
-			operation := "INSERT"
+		for j, payment := range paymentsNormalize {
+			confirmedHash := ""
+			inFlight := false
 			for _, paymentHash := range findPaymentsHash {
 				if strings.EqualFold(payment.UniqueId, paymentHash.UniqueId) {
-					if strings.EqualFold(payment.Hash, paymentHash.Hash) {
-						operation = "IGNORE"
-						continue
-					}
-					operation = "UPDATE"
+					confirmedHash = paymentHash.ConfirmedHash()
+					inFlight = paymentHash.InFlight()
+					break
 				}
 			}
+			// se compara contra el hash confirmado por SIR, no contra el último guardado en Mongo
+			operation := lib_mapper.ResolveOperation(payment.Hash, confirmedHash)
+			if inFlight {
+				// el INSERT de una corrida anterior sigue pendiente, se deja a sir-writer o al reintento
+				operation = "IGNORE"
+			}
 			if operation == "IGNORE" {
 				continue
 			}
-
+			paymentsNormalize[j].SyncStatus = lib_mapper.SyncPending
+			// un documento previo al estado de sincronización tiene confirmado su hash sin sirHash, se guarda antes de
+			// pisar hash para que la próxima corrida no lo vuelva a enviar como INSERT
+			paymentsNormalize[j].SirHash = confirmedHash
 			StTransactionsData = append(StTransactionsData, sir_models.Transaction{
 				OperationType: operation,
+				UniqueId:      payment.UniqueId,
+				Hash:          payment.Hash,
 				Data:          payment.Data.Output,
 			})
 		}
@@ -176,11 +187,14 @@ func (provider *ApiProviderDatafast) RetrievePayments() {
 		}
 		if len(StTransactionsData) > 0 {
 			uuid, _ := uuid2.NewV7()
-			batchAsBytes, _ := json.Marshal(sir_models.WrapperTransactions{
+			transactionsWrapper := sir_models.WrapperTransactions{
 				Id:           uuid.String(),
+				Provider:     lib_mapper.ProviderDeunaPichincha,
 				Transactions: StTransactionsData,
-			})
-			provider.natsManager.EventSender.SendMsgBytes("sir.writer.sttransaction", batchAsBytes)
+			}
+			if err := sir_models.TransactionsEvent.PublishWithId(provider.natsManager.EventSender, transactionsWrapper.Id, transactionsWrapper.ConciliatorId, transactionsWrapper); err != nil {
+				utils.Error.Printf("[DeunaPichincha-Publish] no se pudo publicar el wrapper %s de la página #%d, sus pagos quedan pendientes para el reintento: %v\n", uuid.String(), page, err)
+			}
 		} else {
 			utils.Info.Println(fmt.Sprintf("[DeunaPichincha-Publish] no hay datos para modificar (Empty) (ya existe o no hay cambios) page #%d\n", page))
 		}
@@ -3,13 +3,14 @@ package config
 import (
 	"github.com/joho/godotenv"
 	"invoker-services/utils"
+	"lib-shared/infrastructure/messaging_nats"
 	"log"
 	"os"
 )
 
 type Config struct {
 	Mongo                  MongoConfig
-	Nats                   NatsConfig
+	Nats                   messaging_nats.Connection
 	TimeZone               string
 	TimeOffset             string
 	ApiCentralConciliador  string
@@ -20,9 +21,7 @@ type MongoConfig struct {
 	URI      string
 	Database string
 }
-type NatsConfig struct {
-	URI string
-}
+
 type SqlServerSir struct {
 	JDBC string
 }
@@ -41,9 +40,7 @@ func LoadConfig() Config {
 			URI:      getEnv("MONGO_URI", "no_configurado"),
 			Database: getEnv("MONGO_DATABASE", "no_configurado"),
 		},
-		Nats: NatsConfig{
-			URI: getEnv("NATS_URI", "no_configurado"),
-		},
+		Nats:                   messaging_nats.ConnectionFromEnv(),
 		TimeZone:               getEnv("TIMEZONE", "no_configurado"),
 		TimeOffset:             getEnv("TIME_OFFSET", "0d"),
 		ApiCentralConciliador:  getEnv("CONCILIADOR_API", "no_configurado"),
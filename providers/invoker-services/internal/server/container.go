@@ -10,6 +10,7 @@ import (
 	"invoker-services/utils"
 	"io"
 	"lib-shared/infrastructure/messaging_nats"
+	"lib-shared/topology"
 	"net/http"
 	"strconv"
 	"strings"
@@ -56,7 +57,10 @@ func NewContainer(cfg config.Config) {
 	}
 	repositoryData = repository.NewMongoDataRepository(mongoClient, cfg)
 	// Conectar a NATS
-	nats = messaging_nats.NewStartNats(cfg.Nats.URI, nil)
+	nats, err = messaging_nats.NewStartNats(cfg.Nats, &messaging_nats.OptsNats{Topology: &topology.Conciliador})
+	if err != nil {
+		utils.Error.Fatalf("Error conectando a NATS: %v", err)
+	}
 	location, err = time.LoadLocation(cfg.TimeZone)
 	if err != nil {
 		utils.Error.Panic("Error al cargar la zona horaria: ", err)
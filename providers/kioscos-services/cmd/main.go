@@ -16,5 +16,5 @@ import (
 func main() {
 	cfg := config.LoadConfig()
 	server.NewContainer(cfg)
-	utils.Info.Println("✅ Servicio inicializado")
+	utils.Info.Println("✅ Servicio finalizado")
 }
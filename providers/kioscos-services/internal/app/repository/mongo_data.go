@@ -10,9 +10,22 @@ import (
 )
 
 type MerchantPaymentHash struct {
-	UniqueId string `bson:"uniqueId"`
-	Hash     string `bson:"hash"`
+	UniqueId   string `bson:"uniqueId"`
+	Hash       string `bson:"hash"`
+	SirHash    string `bson:"sirHash"`
+	SyncStatus string `bson:"syncStatus"`
 }
+
+// ConfirmedHash devuelve el hash que sir-writer confirmó en ST_Transaccional para el pago.
+func (receiver MerchantPaymentHash) ConfirmedHash() string {
+	return lib_mapper.ConfirmedHash(receiver.Hash, receiver.SirHash, receiver.SyncStatus)
+}
+
+// InFlight indica que el INSERT del pago sigue pendiente en sir-writer.
+func (receiver MerchantPaymentHash) InFlight() bool {
+	return lib_mapper.InFlight(receiver.SirHash, receiver.SyncStatus)
+}
+
 type MongoDataRepository struct {
 	Client             *mongo.Client
 	DatafastCollection *mongo.Collection
@@ -25,10 +38,15 @@ func NewMongoDataRepository(client *mongo.Client, cfg config.Config) *MongoDataR
 func (receiver *MongoDataRepository) SaveBulkModel(payments []lib_mapper.Payment) error {
 	models := make([]mongo.WriteModel, 0)
 	for _, payment := range payments {
+		update := bson.M{"$set": payment}
+		// el documento queda con la última conciliación, runs guarda el pago de cada una para compararlas
+		if payment.ConciliatorId != "" {
+			update["$push"] = bson.M{"runs": bson.M{"$each": bson.A{payment.Run()}, "$slice": -lib_mapper.MaxPaymentRuns}}
+		}
 		models = append(models, mongo.
 			NewUpdateOneModel().
 			SetFilter(bson.D{{"uniqueId", payment.UniqueId}}).
-			SetUpdate(bson.M{"$set": payment}).SetUpsert(true))
+			SetUpdate(update).SetUpsert(true))
 	}
 	opts := options.BulkWrite().SetOrdered(true)
 	// Runs a bulk write operation for the specified write operations
@@ -44,6 +62,8 @@ func (receiver *MongoDataRepository) FindPaymentsHash(paymentsIds []string) ([]*
 	projection := bson.D{
 		{"uniqueId", 1}, // Incluir el campo 'uniqueId'
 		{"hash", 1},     // Incluir el campo 'hash'
+		{"sirHash", 1},
+		{"syncStatus", 1},
 	}
 	cursor, err := receiver.DatafastCollection.Find(context.Background(), filter, options.Find().SetProjection(projection))
 	if err != nil {
@@ -60,3 +80,7 @@ func (receiver *MongoDataRepository) FindPaymentsHash(paymentsIds []string) ([]*
 	}
 	return paymentsHash, nil
 }
+
+func (receiver *MongoDataRepository) Close() {
+	receiver.Client.Disconnect(context.Background())
+}
@@ -3,13 +3,14 @@ package config
 import (
 	"github.com/joho/godotenv"
 	"kioscos-services/utils"
+	"lib-shared/infrastructure/messaging_nats"
 	"log"
 	"os"
 )
 
 type Config struct {
 	Mongo        MongoConfig
-	Nats         NatsConfig
+	Nats         messaging_nats.Connection
 	SqlServerSir SqlServerSir
 	TimeZone     string
 }
@@ -18,11 +19,12 @@ type MongoConfig struct {
 	URI      string
 	Database string
 }
-type NatsConfig struct {
-	URI string
-}
+
 type SqlServerSir struct {
 	JDBC string
+	// Driver de la base SIR: sqlserver (por defecto) o sqlite para correr en local con fixtures
+	Driver   string
+	Fixtures string
 }
 
 func LoadConfig() Config {
@@ -39,11 +41,11 @@ func LoadConfig() Config {
 			URI:      getEnv("MONGO_URI", "no_configurado"),
 			Database: getEnv("MONGO_DATABASE", "no_configurado"),
 		},
-		Nats: NatsConfig{
-			URI: getEnv("NATS_URI", "no_configurado"),
-		},
+		Nats: messaging_nats.ConnectionFromEnv(),
 		SqlServerSir: SqlServerSir{
-			JDBC: getEnv("SIR_DATABASE", "no_configurado"),
+			JDBC:     getEnv("SIR_DATABASE", "no_configurado"),
+			Driver:   getEnv("SIR_DRIVER", "sqlserver"),
+			Fixtures: getEnv("SIR_FIXTURES", ""),
 		},
 		TimeZone: getEnv("TIMEZONE", "no_configurado"),
 	}
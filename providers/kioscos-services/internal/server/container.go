@@ -1,8 +1,8 @@
 package server
 
 import (
-	"encoding/json"
-	"github.com/nats-io/nats.go/jetstream"
+	"context"
+	"errors"
 	db "kioscos-services/internal/app/databases"
 	"kioscos-services/internal/app/repository"
 	"kioscos-services/internal/config"
@@ -10,35 +10,65 @@ import (
 	"kioscos-services/utils"
 	"lib-shared/infrastructure/messaging_nats"
 	"lib-shared/services_models"
+	"lib-shared/sir_repository"
+	"lib-shared/topology"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-var exit = make(chan os.Signal, 1)
+// tiempo que se espera a la consulta en proceso al recibir SIGTERM, si no termina el mensaje vuelve a la cola
+const shutdownTimeout = 20 * time.Second
 
+// NewContainer atiende las solicitudes del proveedor hasta recibir SIGINT o SIGTERM y vuelve cuando la consulta
+// en proceso terminó (o se devolvió con NAK) y las conexiones quedaron cerradas.
 func NewContainer(cfg config.Config) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	mongoClient, err := db.NewMongoClient(cfg.Mongo.URI)
 	if err != nil {
 		utils.Error.Panic("Error creando el cliente de MongoDB: %v", err)
 	}
 	mongoDataRepository := repository.NewMongoDataRepository(mongoClient, cfg)
 	// Conectar a NATS
-	natsManager := messaging_nats.NewStartNats(cfg.Nats.URI, nil)
-	cache := service.NewDataCacheRestaurant(cfg)
+	natsManager, err := messaging_nats.NewStartNats(cfg.Nats, &messaging_nats.OptsNats{Topology: &topology.Conciliador})
+	if err != nil {
+		utils.Error.Fatalf("Error conectando a NATS: %v", err)
+	}
+	sirRepository, err := sir_repository.NewSirRepository(sir_repository.Options{
+		Driver:      cfg.SqlServerSir.Driver,
+		DSN:         cfg.SqlServerSir.JDBC,
+		FixturesDir: cfg.SqlServerSir.Fixtures,
+	})
+	if err != nil {
+		utils.Error.Panicf("Error conectando a la base SIR: %v", err)
+	}
+	cache := service.NewDataCacheRestaurant(sirRepository)
 	cache.LoadRestaurant()
 	provider := service.NewApiProvider(mongoDataRepository, natsManager, cfg, cache)
-	err = natsManager.EventListener.Execute("conciliador-tarjetas-services", exit, 1, "kiosco.services.dispatch", "KIOSCO_SERVICES", func(msg jetstream.Msg) {
-		var serviceMessage services_models.ServiceMessageDate
-		err := json.Unmarshal(msg.Data(), &serviceMessage)
-		if err != nil {
-			utils.Error.Println("error al deserializar el mensaje para kiosco service", err)
-			msg.Ack()
-			return
-		}
-		provider.RetrievePayments(serviceMessage.ConciliatorId, serviceMessage.HashId, serviceMessage.ProcessDate)
-		msg.Ack()
+	// una consulta a la vez por réplica, con heartbeats mientras dura; los errores de la consulta se informan a
+	// report-system y la conciliación se completa, solo un mensaje que no se puede deserializar termina en el
+	// dead-letter
+	err = services_models.DispatchEvent("kiosco").Consume(ctx, natsManager.EventListener, topology.Consumer(topology.KioscoServices), func(event messaging_nats.Envelope[services_models.ServiceMessageDate]) error {
+		provider.RetrievePayments(event.Data.ConciliatorId, event.Data.HashId, event.Data.ProcessDate)
+		return nil
 	})
 	if err != nil {
 		utils.Error.Panic("Error creando el Listener de Nats.IO:", err)
 	}
-	select {}
+	<-ctx.Done()
+	utils.Warning.Println("[shutdown] señal recibida, se deja de consumir y se espera la consulta en proceso")
+	if err := natsManager.Shutdown(shutdownTimeout); err != nil {
+		utils.Error.Printf("[shutdown] %v\n", err)
+		if errors.Is(err, messaging_nats.ErrHandlersRunning) {
+			// la consulta en proceso sigue guardando pagos y publicando wrappers, cerrar SIR o Mongo la cortaría
+			utils.Warning.Println("[shutdown] hay una consulta en proceso, no se cierran las conexiones a SIR y MongoDB")
+			return
+		}
+	}
+	if err := sirRepository.Close(); err != nil {
+		utils.Error.Printf("[shutdown] error al cerrar la conexión a SIR: %v\n", err)
+	}
+	mongoDataRepository.Close()
 }
@@ -1,9 +1,8 @@
 package service
 
 import (
-	db "kioscos-services/internal/app/databases"
-	"kioscos-services/internal/config"
 	"kioscos-services/utils"
+	"lib-shared/sir_repository"
 )
 
 type Restaurante struct {
@@ -21,51 +20,29 @@ type GrupoTarjeta struct {
 type DataCacheRestaurant struct {
 	RestaurantCache   map[string]Restaurante
 	GrupoTarjetaCache map[string]GrupoTarjeta
-	Cfg               config.Config
+	Catalog           sir_repository.CatalogRepository
 }
 
-func NewDataCacheRestaurant(cfg config.Config) *DataCacheRestaurant {
+func NewDataCacheRestaurant(catalog sir_repository.CatalogRepository) *DataCacheRestaurant {
 	return &DataCacheRestaurant{
 		RestaurantCache:   make(map[string]Restaurante),
 		GrupoTarjetaCache: make(map[string]GrupoTarjeta),
-		Cfg:               cfg,
+		Catalog:           catalog,
 	}
 }
 
 func (cache *DataCacheRestaurant) LoadRestaurant() {
-
-	// Crear una nueva conexión a la base de datos
-	sql := db.SQLServerConnection{}
-	conn, err := sql.NewSQLServerConnection(cache.Cfg.SqlServerSir.JDBC)
-	if err != nil {
-		utils.Error.Panic("[cache-restaurant-datafast] error conectando a la base de datos: ", err)
-		return
-	}
-	defer conn.Close()
-	// Ejecutar la consulta y obtener múltiples registros como un slice de mapas
-	query := `SELECT SwitchT, Cod_Restaurante FROM Restaurante where SwitchT is not null and TRIM(SwitchT) <> ''`
-	rows, err := conn.Query(query)
+	restaurants, err := cache.Catalog.FindRestaurants()
 	if err != nil {
 		utils.Error.Panic("[cache-restaurant-datafast] error ejecutando la consulta: ", err)
 		return
 	}
-	for rows.Next() {
-		var (
-			switchT string
-			idLocal string
-		)
-		err := rows.Scan(&switchT, &idLocal)
-		if err != nil {
-			utils.Error.Panic("[cache-restaurant-datafast] error al retornar los datos (Scan)", err)
-			return
-		}
-		cache.RestaurantCache[idLocal] = Restaurante{
-			IdLocal: idLocal,
-			SwitchT: switchT,
+	for _, restaurant := range restaurants {
+		cache.RestaurantCache[restaurant.CodRestaurante] = Restaurante{
+			IdLocal: restaurant.CodRestaurante,
+			SwitchT: restaurant.SwitchT,
 		}
 	}
-	rows.Close()
-
 }
 func (cache *DataCacheRestaurant) getMerchantId(idLocal string) string {
 	for _, restaurante := range cache.RestaurantCache {
@@ -2,12 +2,11 @@ package service
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	uuid2 "github.com/google/uuid"
 	"io"
-	db "kioscos-services/internal/app/databases"
 	"kioscos-services/internal/app/repository"
 	"kioscos-services/internal/config"
 	"kioscos-services/internal/models"
@@ -16,6 +15,7 @@ import (
 	lib_mapper "lib-shared/mapper"
 	"lib-shared/reports_models"
 	"lib-shared/sir_models"
+	"lib-shared/topology"
 	utils3 "lib-shared/utils"
 	"net/http"
 	"strings"
@@ -24,11 +24,6 @@ import (
 	"time"
 )
 
-var (
-	BucketNameLocker       = "CONCILIATOR_LOCKS"
-	BucketServicesProgress = "CONCILIATORS_PROGRESS"
-)
-
 type ApiProviderDatafast struct {
 	mongoRepository *repository.MongoDataRepository
 	country         string
@@ -58,10 +53,13 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 
 	// Leer la fecha para el filtro
 
+	defer provider.releaseLock(hash)
 	// Establecer la zona horaria
 	location, err := time.LoadLocation(provider.cfg.TimeZone)
 	if err != nil {
 		utils.Error.Println("Error al cargar la zona horaria: ", err)
+		provider.Fail(conciliatorId, fmt.Sprintf("error al cargar la zona horaria %s: %v", provider.cfg.TimeZone, err))
+		return
 	}
 
 	// Obtener la fecha y hora actual en la zona horaria especificada
@@ -70,36 +68,23 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 	localTime := processDate.In(location)
 	utils.Info.Println("Procesando conciliador en fecha en formato AAAA-MM-DD -> " + localTime.Format("2006-01-02"))
 	dateFormat := localTime.Format("20060102")
-	// Crear una nueva conexión a la base de datos
-	sql := db.SQLServerConnection{}
-	conn, err := sql.NewSQLServerConnection(provider.cfg.SqlServerSir.JDBC)
-	if err != nil {
-		utils.Error.Printf("error conectando a la base de datos: %v\n", err)
-	}
-	defer conn.Close()
-	defer provider.natsManager.AcquiredUnlock(BucketNameLocker, hash)
-
-	// Ejecutar la consulta y obtener múltiples registros como un slice de mapas
-	query := "select distinct(idLocal), direccion, puerto, email, clave from KioskoWs"
 
-	rows, err := conn.Query(query)
+	servers, err := provider.cache.Catalog.FindKioskServers()
 	if err != nil {
-		utils.Error.Printf("error ejecutando la consulta: %v\n", err)
+		errMsg := fmt.Sprintf("No se puede continuar con la conciliación: error al consultar los servidores de kioscos: %v", err)
+		utils.Error.Println(errMsg)
+		provider.SendErrorConciliator(conciliatorId, errMsg, nil)
+		provider.Fail(conciliatorId, errMsg)
+		return
 	}
 	ipAddressRestaurants := make([]*IpAddressRestaurant, 0)
-	for rows.Next() {
-		var direccion, puerto, email, clave, idLocal string
-		err = rows.Scan(&idLocal, &direccion, &puerto, &email, &clave)
-		if err != nil {
-			utils.Error.Printf("error scaning data la consulta: %v\n", err)
-			continue
-		}
+	for _, server := range servers {
 		ipAddressRestaurants = append(ipAddressRestaurants, &IpAddressRestaurant{
-			Direccion: direccion,
-			Puerto:    puerto,
-			Email:     email,
-			Clave:     clave,
-			IdLocal:   idLocal,
+			Direccion: server.Direccion,
+			Puerto:    server.Puerto,
+			Email:     server.Email,
+			Clave:     server.Clave,
+			IdLocal:   server.IdLocal,
 		})
 	}
 	maxConcurrent := 15
@@ -112,23 +97,31 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 		StartedTime:   time.Now(),
 	}
 
-	// Calcular Progreso de Tarea
-	tasksDone := make(chan int, totalRestaurantsLen)
+	// Calcular Progreso de Tarea, una sola goroutine modifica progress hasta que se cierra tasksDone
+	progress := reports_models.NewProgress(conciliatorId, lib_mapper.ProviderKiosko, 1)
+	progress.StartStage(1, "Consultando locales", totalRestaurantsLen)
+	provider.SetProgress(progress)
+	tasksDone := make(chan string, totalRestaurantsLen)
+	progressDone := make(chan struct{})
 	totalTasks := totalRestaurantsLen
 	go func() {
+		defer close(progressDone)
 		completed := 0
-		for range tasksDone {
+		for store := range tasksDone {
 			completed++
 			pending := totalTasks - completed
-			progress := float64(completed) / float64(totalTasks) * 100
-			provider.SetProgress(hash, fmt.Sprintf("%.2f", progress))
+			progress.Store = store
+			progress.Advance(completed)
+			provider.SetProgress(progress)
 			utils.Info.Printf("Progreso: %.2f%% - Completadas: %d - Pendientes: %d",
-				progress, completed, pending)
+				progress.Percent, completed, pending)
 		}
 	}()
-	provider.natsManager.EventSender.SendMsgBytesJson("started.data.report", startedEventMessage)
+	if err := reports_models.StartedReportEvent.Publish(provider.natsManager.EventSender, conciliatorId, startedEventMessage); err != nil {
+		utils.Error.Printf("[kiosco] no se pudo informar el inicio de la conciliación %s: %v\n", conciliatorId, err)
+	}
 
-	var entriesInserted, entriesUpdated, entriesIgnored atomic.Uint32
+	var entriesInserted, entriesUpdated, entriesIgnored, wrappersSent, wrappersFailed atomic.Uint32
 	for i, ipAddrRest := range ipAddressRestaurants {
 		wg.Add(1)
 		go func(ip *IpAddressRestaurant, index int) {
@@ -140,17 +133,22 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 					utils.Error.Printf("[task-batch kiosco] (%s) Recovered from panic: %v", ip.Direccion, r)
 				}
 				// Notificar tarea completada
-				tasksDone <- 1
+				tasksDone <- ip.IdLocal
 			}()
 			utils.Info.Printf("start process restaurante %s\n", ip.Direccion)
-			inserted, ignored, updated := provider.processRestaurant(ip, dateFormat, conciliatorId)
+			inserted, ignored, updated, wrappers, failed := provider.processRestaurant(ip, dateFormat, conciliatorId)
 			entriesInserted.Add(inserted)
 			entriesUpdated.Add(updated)
 			entriesIgnored.Add(ignored)
+			wrappersSent.Add(wrappers)
+			wrappersFailed.Add(failed)
 		}(ipAddrRest, i)
 	}
 	wg.Wait()
-	provider.SetProgress(hash, "100.00")
+	close(tasksDone)
+	<-progressDone
+	progress.Finish()
+	provider.SetProgress(progress)
 	elapsedExecutor := time.Since(startExecutor)
 	inserted := entriesInserted.Load()
 	updated := entriesUpdated.Load()
@@ -164,19 +162,48 @@ func (provider *ApiProviderDatafast) RetrievePayments(conciliatorId, hash string
 			Updated:  updated,
 			Ignored:  ignored,
 		},
+		Wrappers:      wrappersSent.Load(),
+		PublishFailed: wrappersFailed.Load(),
 	}
 
-	provider.natsManager.EventSender.SendMsgBytesJson("completed.data.report", completedEventMessage)
+	if err := reports_models.CompletedReportEvent.Publish(provider.natsManager.EventSender, conciliatorId, completedEventMessage); err != nil {
+		utils.Error.Printf("[kiosco] no se pudo informar la finalización de la conciliación %s: %v\n", conciliatorId, err)
+	}
 	utils.Info.Printf("[kiosco] pagos completado, la tarea tardó %s con registros inserted %d, updated %d, ignored %d", utils.FormatDuration(elapsedExecutor),
 		inserted, updated, ignored)
 }
-func (provider *ApiProviderDatafast) SetProgress(conciliatorId string, progressAsString string) {
-	kv := provider.natsManager.CreateIfNotExistBucket(BucketServicesProgress)
-	if kv != nil {
-		_, err := kv.Put(context.Background(), conciliatorId, []byte(progressAsString))
-		if err != nil {
-			utils.Error.Printf("Error al cargar guardar el progreso en Nats KV: conciliatorId: %s, %v\n", conciliatorId, err)
-		}
+
+// Fail informa que la conciliación se abortó, report-system la marca como fallida en lugar de completada sin
+// locales.
+func (provider *ApiProviderDatafast) Fail(conciliatorId string, reason string) {
+	statusReport := reports_models.RunStatusReport{
+		ConciliatorId: conciliatorId,
+		Status:        reports_models.RunFailed,
+		Reason:        reason,
+		At:            time.Now(),
+	}
+	if err := reports_models.RunStatusReportEvent.Publish(provider.natsManager.EventSender, conciliatorId, statusReport); err != nil {
+		utils.Error.Printf("[kiosco] no se pudo informar la falla de la conciliación %s: %v\n", conciliatorId, err)
+	}
+}
+
+// SendStoreOutcome informa el resultado de un local para la cobertura de la conciliación en report-system.
+func (provider *ApiProviderDatafast) SendStoreOutcome(outcome reports_models.StoreOutcome) {
+	outcome.At = time.Now()
+	if err := reports_models.StoreOutcomeEvent.Publish(provider.natsManager.EventSender, outcome.ConciliatorId, outcome); err != nil {
+		utils.Error.Printf("[kiosco] no se pudo informar el resultado del local %s de la conciliación %s: %v\n", outcome.StoreId, outcome.ConciliatorId, err)
+	}
+}
+func (provider *ApiProviderDatafast) SetProgress(progress *reports_models.Progress) {
+	if err := topology.Progress(provider.natsManager).Put(progress.ConciliatorId, *progress); err != nil {
+		utils.Error.Printf("Error al cargar guardar el progreso en Nats KV: conciliatorId: %s, %v\n", progress.ConciliatorId, err)
+	}
+}
+
+// releaseLock libera la solicitud para que se pueda volver a conciliar la misma fecha.
+func (provider *ApiProviderDatafast) releaseLock(hash string) {
+	if err := topology.Locks(provider.natsManager).Release(hash); err != nil {
+		utils.Error.Printf("[kiosco] %v\n", err)
 	}
 }
 func (provider *ApiProviderDatafast) SendErrorConciliator(conciliatorId, message string, metadata interface{}) {
@@ -189,7 +216,9 @@ func (provider *ApiProviderDatafast) SendErrorConciliator(conciliatorId, message
 		},
 		CreatedAt: time.Now(),
 	}
-	provider.natsManager.EventSender.SendMsgBytesJson("add.data.report", msg)
+	if err := reports_models.AddReportEvent.Publish(provider.natsManager.EventSender, conciliatorId, msg); err != nil {
+		utils.Error.Printf("[kiosco] no se pudo agregar al reporte de la conciliación %s: %v\n", conciliatorId, err)
+	}
 }
 func (provider *ApiProviderDatafast) SendInfoConciliator(conciliatorId, message string, metadata interface{}) {
 	msg := reports_models.ReportData{
@@ -201,9 +230,29 @@ func (provider *ApiProviderDatafast) SendInfoConciliator(conciliatorId, message
 		},
 		CreatedAt: time.Now(),
 	}
-	provider.natsManager.EventSender.SendMsgBytesJson("add.data.report", msg)
+	if err := reports_models.AddReportEvent.Publish(provider.natsManager.EventSender, conciliatorId, msg); err != nil {
+		utils.Error.Printf("[kiosco] no se pudo agregar al reporte de la conciliación %s: %v\n", conciliatorId, err)
+	}
 }
-func (provider *ApiProviderDatafast) processRestaurant(ipAddressRestaurant *IpAddressRestaurant, dateFormat, conciliatorId string) (uint32, uint32, uint32) {
+
+// processRestaurant consulta los pagos de un local y los envía a SIR, al salir publica el resultado del local para
+// la cobertura de la conciliación.
+func (provider *ApiProviderDatafast) processRestaurant(ipAddressRestaurant *IpAddressRestaurant, dateFormat, conciliatorId string) (inserted, ignored, updated, wrappers, failed uint32) {
+	outcome := reports_models.StoreOutcome{
+		ConciliatorId: conciliatorId,
+		Provider:      lib_mapper.ProviderKiosko,
+		StoreId:       ipAddressRestaurant.IdLocal,
+		MerchantId:    provider.cache.getMerchantId(ipAddressRestaurant.IdLocal),
+	}
+	defer func() {
+		// sin estado es un panic a mitad del proceso, el local no se pudo consultar completo
+		if outcome.Status == "" {
+			outcome.Status = reports_models.StoreUnreachable
+			outcome.Reason = "el proceso del local se interrumpió antes de terminar"
+		}
+		outcome.Inserted, outcome.Updated, outcome.Ignored = inserted, updated, ignored
+		provider.SendStoreOutcome(outcome)
+	}()
 	direccion := ipAddressRestaurant.Direccion
 	puerto := ipAddressRestaurant.Puerto
 	httpAddress := createHttpAddress(direccion, puerto)
@@ -212,10 +261,15 @@ func (provider *ApiProviderDatafast) processRestaurant(ipAddressRestaurant *IpAd
 		errMsg := fmt.Sprintf("error al obtener el token en el server: %s details: %v", httpAddress, err)
 		utils.Error.Println(errMsg)
 		provider.SendErrorConciliator(conciliatorId, errMsg, &ipAddressRestaurant)
-		return 0, 0, 0
+		outcome.Status, outcome.Reason = reports_models.StoreUnreachable, errMsg
+		if errors.Is(err, errLoginRejected) {
+			outcome.Status = reports_models.StoreAuthFailed
+		}
+		return 0, 0, 0, 0, 0
 	}
 	if utils.IsEmptyString(tokenAcceso) {
-		return 0, 0, 0
+		outcome.Status, outcome.Reason = reports_models.StoreAuthFailed, fmt.Sprintf("el login en el server %s no devolvió token", httpAddress)
+		return 0, 0, 0, 0, 0
 	}
 
 	route := "/api/reportes/ventas-switch?"
@@ -226,7 +280,8 @@ func (provider *ApiProviderDatafast) processRestaurant(ipAddressRestaurant *IpAd
 		errMsg := fmt.Sprintf("[kiosco][/api/reportes/ventas-switch] error al crear la petición: %v, server %s", err, httpAddress)
 		utils.Error.Println(errMsg)
 		provider.SendErrorConciliator(conciliatorId, errMsg, &ipAddressRestaurant)
-		return 0, 0, 0
+		outcome.Status, outcome.Reason = reports_models.StoreUnreachable, errMsg
+		return 0, 0, 0, 0, 0
 	}
 
 	req.Header.Set("Authorization", "Bearer "+tokenAcceso)
@@ -243,7 +298,8 @@ func (provider *ApiProviderDatafast) processRestaurant(ipAddressRestaurant *IpAd
 		errMsg := fmt.Sprintf("[kiosco] error conectando a la petición: %v, server %s", err, httpAddress)
 		utils.Error.Println(errMsg)
 		provider.SendErrorConciliator(conciliatorId, errMsg, &ipAddressRestaurant)
-		return 0, 0, 0
+		outcome.Status, outcome.Reason = reports_models.StoreUnreachable, errMsg
+		return 0, 0, 0, 0, 0
 	}
 	defer resp.Body.Close()
 
@@ -252,7 +308,11 @@ func (provider *ApiProviderDatafast) processRestaurant(ipAddressRestaurant *IpAd
 		errMsg := fmt.Sprintf("error al obtener transacciones en el server: %s StatusCode: %d, Body: %s", httpAddress, resp.StatusCode, string(errorBody))
 		utils.Error.Println(errMsg)
 		provider.SendErrorConciliator(conciliatorId, errMsg, &ipAddressRestaurant)
-		return 0, 0, 0
+		outcome.Status, outcome.Reason = reports_models.StoreUnreachable, errMsg
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			outcome.Status = reports_models.StoreAuthFailed
+		}
+		return 0, 0, 0, 0, 0
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -260,7 +320,8 @@ func (provider *ApiProviderDatafast) processRestaurant(ipAddressRestaurant *IpAd
 		errMsg := fmt.Sprintf("[kiosco][ReadAll] error al interpretar la respuesta de la petición: %v, server %s", err, httpAddress)
 		utils.Error.Println(errMsg)
 		provider.SendErrorConciliator(conciliatorId, errMsg, &ipAddressRestaurant)
-		return 0, 0, 0
+		outcome.Status, outcome.Reason = reports_models.StoreUnreachable, errMsg
+		return 0, 0, 0, 0, 0
 	}
 
 	var paymentResponse []models.PaymentData
@@ -268,7 +329,13 @@ func (provider *ApiProviderDatafast) processRestaurant(ipAddressRestaurant *IpAd
 		errMsg := fmt.Sprintf("[kiosco][Unmarshal] error al deserializar el contenido de la respuesta: %v, server %s", err, httpAddress)
 		utils.Error.Println(errMsg)
 		provider.SendErrorConciliator(conciliatorId, errMsg, &ipAddressRestaurant)
-		return 0, 0, 0
+		outcome.Status, outcome.Reason = reports_models.StoreUnreachable, errMsg
+		return 0, 0, 0, 0, 0
+	}
+	outcome.Received = len(paymentResponse)
+	if len(paymentResponse) == 0 {
+		outcome.Status = reports_models.StoreEmpty
+		return 0, 0, 0, 0, 0
 	}
 
 	paymentsNormalize := make([]lib_mapper.Payment, 0)
@@ -307,7 +374,7 @@ func (provider *ApiProviderDatafast) processRestaurant(ipAddressRestaurant *IpAd
 			Hash:          transformed.GetTransactionHash(),
 			StoreId:       ipAddressRestaurant.IdLocal,
 			ConciliatorId: conciliatorId,
-			Provider:      "KIOSKO",
+			Provider:      lib_mapper.ProviderKiosko,
 			CreatedAt:     createdAt,
 			Data: lib_mapper.PaymentData{
 				Input:  payment,
@@ -317,8 +384,12 @@ func (provider *ApiProviderDatafast) processRestaurant(ipAddressRestaurant *IpAd
 	}
 	utils.Warning.Printf("registros reales procesables %d", len(paymentsNormalize))
 	utils.Warning.Printf("registros no procesables %d", paymentsUnprocessable)
+	outcome.Unmapped = paymentsUnprocessable
+	if len(paymentsNormalize) == 0 {
+		outcome.Status, outcome.Reason = reports_models.StoreUnmapped, fmt.Sprintf("el idLocal %s no tiene merchantId en el catálogo", ipAddressRestaurant.IdLocal)
+		return 0, 0, 0, 0, 0
+	}
 	batches := batchProcessPayments(paymentsNormalize, 250)
-	var inserted, ignored, updated uint32
 	processed := 0
 	for i, batch := range batches {
 		batchSize := len(batch)
@@ -330,32 +401,39 @@ func (provider *ApiProviderDatafast) processRestaurant(ipAddressRestaurant *IpAd
 		}
 		// Enviar proceso a SIR con sus respectivas operations
 		findPaymentsHash, _ := provider.mongoRepository.FindPaymentsHash(uniqueIds)
-		for _, payment := range batch {
-			operation := "INSERT"
+		for j, payment := range batch {
+			confirmedHash := ""
+			inFlight := false
 			for _, paymentHash := range findPaymentsHash {
 				if strings.EqualFold(payment.UniqueId, paymentHash.UniqueId) {
-					if strings.EqualFold(payment.Hash, paymentHash.Hash) {
-						//output := payment.Data.Output
-						//utils.Warning.Printf("hashed duplicated %s, autorization %s, fecha %s, card %s", payment.Hash, output.NumeroAutorizacion, output.FechaTransaccion, output.NumeroTarjetaMask)
-						operation = "IGNORE"
-						ignored++
-						break
-					}
-					operation = "UPDATE"
-					updated++
+					confirmedHash = paymentHash.ConfirmedHash()
+					inFlight = paymentHash.InFlight()
 					break
 				}
 			}
-			if operation == "INSERT" {
-				inserted++
+			// se compara contra el hash confirmado por SIR, no contra el último guardado en Mongo
+			operation := lib_mapper.ResolveOperation(payment.Hash, confirmedHash)
+			if inFlight {
+				// el INSERT de una corrida anterior sigue pendiente, se deja a sir-writer o al reintento
+				operation = "IGNORE"
 			}
-
-			if operation == "IGNORE" {
+			switch operation {
+			case "INSERT":
+				inserted++
+			case "UPDATE":
+				updated++
+			case "IGNORE":
+				ignored++
 				continue
 			}
-
+			batch[j].SyncStatus = lib_mapper.SyncPending
+			// un documento previo al estado de sincronización tiene confirmado su hash sin sirHash, se guarda antes de
+			// pisar hash para que la próxima corrida no lo vuelva a enviar como INSERT
+			batch[j].SirHash = confirmedHash
 			StTransactionsData = append(StTransactionsData, sir_models.Transaction{
 				OperationType: operation,
+				UniqueId:      payment.UniqueId,
+				Hash:          payment.Hash,
 				Data:          payment.Data.Output,
 			})
 		}
@@ -366,19 +444,32 @@ func (provider *ApiProviderDatafast) processRestaurant(ipAddressRestaurant *IpAd
 		}
 		if len(StTransactionsData) > 0 {
 			uuid, _ := uuid2.NewV7()
-			batchAsBytes, _ := json.Marshal(sir_models.WrapperTransactions{
-				Id:           uuid.String(),
-				Transactions: StTransactionsData,
-			})
-			provider.natsManager.EventSender.SendMsgBytes("sir.writer.sttransaction", batchAsBytes)
+			transactionsWrapper := sir_models.WrapperTransactions{
+				Id:            uuid.String(),
+				ConciliatorId: conciliatorId,
+				Provider:      lib_mapper.ProviderKiosko,
+				Transactions:  StTransactionsData,
+			}
+			if err := sir_models.TransactionsEvent.PublishWithId(provider.natsManager.EventSender, transactionsWrapper.Id, transactionsWrapper.ConciliatorId, transactionsWrapper); err != nil {
+				errMsg := fmt.Sprintf("[server: %s] no se pudo publicar el wrapper %s con %d pagos, quedan pendientes para el reintento: %v", httpAddress, uuid.String(), len(StTransactionsData), err)
+				utils.Error.Println(errMsg)
+				provider.SendErrorConciliator(conciliatorId, errMsg, nil)
+				failed++
+			} else {
+				wrappers++
+			}
 		} else {
 			utils.Info.Println(fmt.Sprintf("[Datafast-Publish] no hay datos para modificar (Empty) (ya existe o no hay cambios) #%d\n", i+1))
 		}
 		utils.Info.Printf("[Kiosco-Insert-Mongo][server: %s] Procesado batch #%d", httpAddress, i+1)
 	}
-	return inserted, ignored, updated
+	outcome.Status = reports_models.StoreOk
+	return inserted, ignored, updated, wrappers, failed
 }
 
+// errLoginRejected es un login al que el server respondió pero rechazó, a diferencia de un server que no responde.
+var errLoginRejected = errors.New("login rechazado:")
+
 type ApiResponse struct {
 	Estado string `json:"estado"`
 	Codigo string `json:"codigo"`
@@ -431,7 +522,7 @@ func GenerateTokenApi(httpAddress string, email string, password string) (string
 		if err != nil {
 			return "", fmt.Errorf("[kiosco][ReadAll] error deserializando el body de la respuesta: %v", err)
 		}
-		return "", fmt.Errorf("StatusCode: %d, Body: %s\n", resp.StatusCode, string(errorBody))
+		return "", fmt.Errorf("%w StatusCode: %d, Body: %s\n", errLoginRejected, resp.StatusCode, string(errorBody))
 	}
 
 	// Leemos la respuesta del servidor
@@ -451,7 +542,7 @@ func GenerateTokenApi(httpAddress string, email string, password string) (string
 	if apiResponse.Estado == "OK" {
 		return apiResponse.Data.ApiToken, nil
 	} else {
-		return "", fmt.Errorf("error en la respuesta: %s", apiResponse.Msg)
+		return "", fmt.Errorf("%w error en la respuesta: %s", errLoginRejected, apiResponse.Msg)
 	}
 }
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"os"
 	"report-system/internal/config"
 	"report-system/internal/server"
 	"report-system/utils"
@@ -12,9 +13,29 @@ import (
 * Este microservicio está diseñado para ejecutarse como un CronJob dentro de un clúster de Kubernetes.
 * El servicio de DATAFAST se encarga de generar y proporcionar el reporte de las transacciones
 * 24 horas después de haber efectuado el corte del lote.
+*
+* Comandos:
+*   report-system                               consume los reportes y atiende la API
+*   report-system archive                       archiva los documentos vencidos según RETENTION_DAYS
+*   report-system restore <archivo o prefijo>...
+*                                               vuelve a cargar los archivos, por ejemplo fetch-kioscos/
  */
 func main() {
 	cfg := config.LoadConfig()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "archive":
+			if err := server.RunArchive(cfg); err != nil {
+				utils.Error.Fatalf("[archive] %v", err)
+			}
+			return
+		case "restore":
+			if err := server.RunRestore(cfg, os.Args[2:]); err != nil {
+				utils.Error.Fatalf("[restore] %v", err)
+			}
+			return
+		}
+	}
 	server.NewContainer(cfg)
-	utils.Info.Println("✅ Servicio inicializado")
+	utils.Info.Println("✅ Servicio finalizado")
 }
@@ -0,0 +1,154 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"report-system/internal/config"
+	"slices"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Store guarda los archivos de la retención, name es una ruta relativa con / (ej. fetch-kioscos/archivo.ndjson.gz).
+type Store interface {
+	Put(name string, content io.Reader, size int64) error
+	Get(name string) (io.ReadCloser, error)
+	// List devuelve los archivos que empiezan con prefix ordenados por nombre.
+	List(prefix string) ([]string, error)
+	// Location es la descripción del destino para los logs.
+	Location() string
+}
+
+// NewStore usa el bucket S3 compatible (MinIO en local) si cfg.S3Endpoint está configurado, si no la carpeta cfg.Dir.
+func NewStore(cfg config.ArchiveConfig) (Store, error) {
+	if cfg.S3Endpoint == "" {
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("no se pudo crear la carpeta de archivos %s: %w", cfg.Dir, err)
+		}
+		return &LocalStore{dir: cfg.Dir}, nil
+	}
+	client, err := minio.New(cfg.S3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+		Secure: cfg.S3UseSSL,
+		Region: cfg.S3Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo crear el cliente S3 de %s: %w", cfg.S3Endpoint, err)
+	}
+	exists, err := client.BucketExists(context.Background(), cfg.S3Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo consultar el bucket %s: %w", cfg.S3Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("el bucket %s no existe en %s", cfg.S3Bucket, cfg.S3Endpoint)
+	}
+	return &S3Store{client: client, bucket: cfg.S3Bucket, prefix: strings.Trim(cfg.S3Prefix, "/")}, nil
+}
+
+// LocalStore guarda los archivos en una carpeta local.
+type LocalStore struct {
+	dir string
+}
+
+// Put escribe en un temporal y lo renombra, un archivo a medio escribir no queda con el nombre final.
+func (store *LocalStore) Put(name string, content io.Reader, size int64) error {
+	path := filepath.Join(store.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := io.Copy(temp, content); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+func (store *LocalStore) Get(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(store.dir, filepath.FromSlash(name)))
+}
+
+func (store *LocalStore) List(prefix string) ([]string, error) {
+	names := make([]string, 0)
+	err := filepath.WalkDir(store.dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || strings.HasPrefix(entry.Name(), ".tmp-") {
+			return err
+		}
+		relative, err := filepath.Rel(store.dir, path)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(relative); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	slices.Sort(names)
+	return names, err
+}
+
+func (store *LocalStore) Location() string {
+	return store.dir
+}
+
+// S3Store guarda los archivos en un bucket S3 compatible, bajo prefix si está configurado.
+type S3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func (store *S3Store) Put(name string, content io.Reader, size int64) error {
+	_, err := store.client.PutObject(context.Background(), store.bucket, store.key(name), content, size,
+		minio.PutObjectOptions{ContentType: "application/gzip"})
+	return err
+}
+
+func (store *S3Store) Get(name string) (io.ReadCloser, error) {
+	object, err := store.client.GetObject(context.Background(), store.bucket, store.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject no consulta el bucket hasta la primera lectura, Stat informa aquí si el archivo no existe
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, err
+	}
+	return object, nil
+}
+
+func (store *S3Store) List(prefix string) ([]string, error) {
+	names := make([]string, 0)
+	objects := store.client.ListObjects(context.Background(), store.bucket, minio.ListObjectsOptions{Prefix: store.key(prefix), Recursive: true})
+	for object := range objects {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		names = append(names, strings.TrimPrefix(strings.TrimPrefix(object.Key, store.prefix), "/"))
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (store *S3Store) Location() string {
+	return fmt.Sprintf("s3://%s/%s", store.bucket, store.prefix)
+}
+
+func (store *S3Store) key(name string) string {
+	if store.prefix == "" {
+		return name
+	}
+	return store.prefix + "/" + name
+}
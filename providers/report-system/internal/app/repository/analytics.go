@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	lib_mapper "lib-shared/mapper"
+	"lib-shared/reports_models"
+	"report-system/internal/models"
+	"time"
+)
+
+// Colecciones de los rollups de analítica, el _id de cada documento es su clave:
+//   - analytics-payments: {provider, day, storeId, cardGroup} con count y amount de los pagos.
+//   - analytics-runs: {provider, day} con la cantidad de conciliaciones por estado, entradas con error y duraciones.
+const (
+	analyticsPaymentsCollection = "analytics-payments"
+	analyticsRunsCollection     = "analytics-runs"
+)
+
+// RefreshPaymentsRollup recalcula los rollups de pagos de un día del proveedor a partir de su colección fetch-*.
+// Los rollups nuevos reemplazan a los anteriores y después se borran los que ya no existen (un local que dejó de
+// tener pagos), así una consulta no ve el día vacío mientras se recalcula.
+func (receiver *MongoDataRepository) RefreshPaymentsRollup(provider, day string, refreshedAt time.Time) error {
+	name := lib_mapper.CollectionName(provider)
+	if name == "" {
+		return fmt.Errorf("el proveedor %s no guarda pagos en MongoDB", provider)
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"data.output.fecha_Transaccion": day}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"provider":  provider,
+				"day":       "$data.output.fecha_Transaccion",
+				"storeId":   "$storeId",
+				"cardGroup": "$data.output.id_Grupo_Tarjeta",
+			},
+			"count":  bson.M{"$sum": 1},
+			"amount": bson.M{"$sum": bson.M{"$convert": bson.M{"input": "$data.output.face_Value", "to": "double", "onError": 0, "onNull": 0}}},
+		}}},
+		{{Key: "$set", Value: bson.M{"refreshedAt": refreshedAt}}},
+		{{Key: "$merge", Value: bson.M{"into": analyticsPaymentsCollection, "whenMatched": "replace", "whenNotMatched": "insert"}}},
+	}
+	if err := receiver.runPipeline(receiver.database().Collection(name), pipeline); err != nil {
+		return fmt.Errorf("error al recalcular los pagos de %s del %s: %v", provider, day, err)
+	}
+	_, err := receiver.database().Collection(analyticsPaymentsCollection).DeleteMany(context.Background(), bson.M{
+		"_id.provider": provider,
+		"_id.day":      day,
+		"refreshedAt":  bson.M{"$lt": refreshedAt},
+	})
+	return err
+}
+
+// RefreshRunsRollup recalcula el rollup de las conciliaciones de un día del servicio, provider es la clave con
+// la que se guarda.
+func (receiver *MongoDataRepository) RefreshRunsRollup(service, provider, day string, refreshedAt time.Time) error {
+	countStatus := func(status reports_models.RunStatus) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", status}}, 1, 0}}}
+	}
+	// la duración solo la informa un proveedor que terminó
+	finished := bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$providerCompletedAt", nil}}, nil}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"request.service": service, "request.date": day}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": receiver.DataReportsCollection.Name(),
+			"let":  bson.M{"id": "$conciliatorId"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
+					bson.M{"$eq": bson.A{"$conciliatorId", "$$id"}},
+					bson.M{"$eq": bson.A{"$type", "ERROR"}},
+				}}}},
+				bson.M{"$count": "count"},
+			},
+			"as": "errors",
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":                 bson.M{"provider": provider, "day": day},
+			"runs":                bson.M{"$sum": 1},
+			"completed":           countStatus(reports_models.RunCompleted),
+			"completedWithErrors": countStatus(reports_models.RunCompletedWithErrors),
+			"failed":              countStatus(reports_models.RunFailed),
+			"timedOut":            countStatus(reports_models.RunTimedOut),
+			"cancelled":           countStatus(reports_models.RunCancelled),
+			"errorEntries":        bson.M{"$sum": bson.M{"$ifNull": bson.A{bson.M{"$first": "$errors.count"}, 0}}},
+			"elapsedTotal":        bson.M{"$sum": bson.M{"$cond": bson.A{finished, "$elapsedTime", 0}}},
+			"elapsedRuns":         bson.M{"$sum": bson.M{"$cond": bson.A{finished, 1, 0}}},
+		}}},
+		{{Key: "$set", Value: bson.M{"refreshedAt": refreshedAt}}},
+		{{Key: "$merge", Value: bson.M{"into": analyticsRunsCollection, "whenMatched": "replace", "whenNotMatched": "insert"}}},
+	}
+	if err := receiver.runPipeline(receiver.ReportCollection, pipeline); err != nil {
+		return fmt.Errorf("error al recalcular las conciliaciones de %s del %s: %v", service, day, err)
+	}
+	return nil
+}
+
+// PaymentsAnalytics suma los rollups de pagos por periodo y por las dimensiones de query.GroupBy.
+func (receiver *MongoDataRepository) PaymentsAnalytics(query models.AnalyticsQuery) ([]models.PaymentsAnalytics, error) {
+	group := bson.M{"period": periodExpression(query.Period)}
+	dimensions := map[string]string{"provider": "provider", "store": "storeId", "cardGroup": "cardGroup"}
+	for _, dimension := range query.GroupBy {
+		group[dimensions[dimension]] = "$_id." + dimensions[dimension]
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: rollupFilter(query)}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    group,
+			"count":  bson.M{"$sum": "$count"},
+			"amount": bson.M{"$sum": "$amount"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":       0,
+			"period":    "$_id.period",
+			"provider":  "$_id.provider",
+			"storeId":   "$_id.storeId",
+			"cardGroup": "$_id.cardGroup",
+			"count":     1,
+			"amount":    bson.M{"$round": bson.A{"$amount", 2}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "period", Value: 1}, {Key: "provider", Value: 1}, {Key: "storeId", Value: 1}, {Key: "cardGroup", Value: 1}}}},
+	}
+	analytics := make([]models.PaymentsAnalytics, 0)
+	if err := receiver.aggregate(receiver.database().Collection(analyticsPaymentsCollection), pipeline, &analytics); err != nil {
+		return nil, fmt.Errorf("error al consultar la analítica de pagos: %v", err)
+	}
+	return analytics, nil
+}
+
+// RunsAnalytics suma los rollups de conciliaciones por periodo y proveedor.
+func (receiver *MongoDataRepository) RunsAnalytics(query models.AnalyticsQuery) ([]models.RunsAnalytics, error) {
+	sum := func(field string) bson.M {
+		return bson.M{"$sum": "$" + field}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: rollupFilter(query)}},
+		{{Key: "$group", Value: bson.M{
+			"_id":                 bson.M{"period": periodExpression(query.Period), "provider": "$_id.provider"},
+			"runs":                sum("runs"),
+			"completed":           sum("completed"),
+			"completedWithErrors": sum("completedWithErrors"),
+			"failed":              sum("failed"),
+			"timedOut":            sum("timedOut"),
+			"cancelled":           sum("cancelled"),
+			"errorEntries":        sum("errorEntries"),
+			"elapsedTotal":        sum("elapsedTotal"),
+			"elapsedRuns":         sum("elapsedRuns"),
+		}}},
+		{{Key: "$set", Value: bson.M{"period": "$_id.period", "provider": "$_id.provider"}}},
+		{{Key: "$sort", Value: bson.D{{Key: "period", Value: 1}, {Key: "provider", Value: 1}}}},
+	}
+	analytics := make([]models.RunsAnalytics, 0)
+	if err := receiver.aggregate(receiver.database().Collection(analyticsRunsCollection), pipeline, &analytics); err != nil {
+		return nil, fmt.Errorf("error al consultar la analítica de conciliaciones: %v", err)
+	}
+	return analytics, nil
+}
+
+func rollupFilter(query models.AnalyticsQuery) bson.M {
+	filter := bson.M{"_id.day": bson.M{"$gte": query.From, "$lte": query.To}}
+	if query.Provider != "" {
+		filter["_id.provider"] = query.Provider
+	}
+	return filter
+}
+
+// periodExpression es el día del rollup o su mes (AAAA-MM).
+func periodExpression(period string) any {
+	if period == "month" {
+		return bson.M{"$substrBytes": bson.A{"$_id.day", 0, 7}}
+	}
+	return "$_id.day"
+}
+
+func (receiver *MongoDataRepository) database() *mongo.Database {
+	return receiver.ReportCollection.Database()
+}
+
+// runPipeline ejecuta una agregación que termina en $merge, no devuelve documentos.
+func (receiver *MongoDataRepository) runPipeline(collection *mongo.Collection, pipeline mongo.Pipeline) error {
+	cursor, err := collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.Close(context.Background())
+}
+
+func (receiver *MongoDataRepository) aggregate(collection *mongo.Collection, pipeline mongo.Pipeline, results any) error {
+	cursor, err := collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.All(context.Background(), results)
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"report-system/internal/models"
+)
+
+const anomaliesCollection = "anomalies"
+
+// StoreTotals suma los rollups de pagos del proveedor por local para cada uno de los días.
+func (receiver *MongoDataRepository) StoreTotals(provider string, days []string) ([]models.StoreTotals, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"_id.provider": provider, "_id.day": bson.M{"$in": days}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    bson.M{"day": "$_id.day", "storeId": "$_id.storeId"},
+			"count":  bson.M{"$sum": "$count"},
+			"amount": bson.M{"$sum": "$amount"},
+		}}},
+		{{Key: "$project", Value: bson.M{"_id": 0, "day": "$_id.day", "storeId": "$_id.storeId", "count": 1, "amount": 1}}},
+	}
+	totals := make([]models.StoreTotals, 0)
+	if err := receiver.aggregate(receiver.database().Collection(analyticsPaymentsCollection), pipeline, &totals); err != nil {
+		return nil, fmt.Errorf("error al sumar los pagos por local de %s: %v", provider, err)
+	}
+	return totals, nil
+}
+
+// SaveAnomaly guarda la anomalía una sola vez por conciliación, local y tipo, devuelve false si ya existía.
+func (receiver *MongoDataRepository) SaveAnomaly(anomaly models.Anomaly) (bool, error) {
+	result, err := receiver.database().Collection(anomaliesCollection).UpdateOne(context.Background(),
+		bson.M{"conciliatorId": anomaly.ConciliatorId, "storeId": anomaly.StoreId, "kind": anomaly.Kind},
+		bson.M{"$setOnInsert": anomaly},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return false, err
+	}
+	return result.UpsertedCount > 0, nil
+}
+
+// FindAnomalies devuelve las anomalías que cumplen los filtros, del día más reciente al más antiguo.
+func (receiver *MongoDataRepository) FindAnomalies(query models.AnomalyQuery) ([]models.Anomaly, error) {
+	filter := bson.M{}
+	if query.ConciliatorId != "" {
+		filter["conciliatorId"] = query.ConciliatorId
+	}
+	if query.Provider != "" {
+		filter["provider"] = query.Provider
+	}
+	if query.Kind != "" {
+		filter["kind"] = query.Kind
+	}
+	days := bson.M{}
+	if query.From != "" {
+		days["$gte"] = query.From
+	}
+	if query.To != "" {
+		days["$lte"] = query.To
+	}
+	if len(days) > 0 {
+		filter["day"] = days
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: "day", Value: -1}, {Key: "provider", Value: 1}, {Key: "storeId", Value: 1}})
+	cursor, err := receiver.database().Collection(anomaliesCollection).Find(context.Background(), filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("ha ocurrido un error al buscar las anomalías: %v", err)
+	}
+	defer cursor.Close(context.Background())
+	anomalies := make([]models.Anomaly, 0)
+	if err := cursor.All(context.Background(), &anomalies); err != nil {
+		return nil, fmt.Errorf("error al decodificar las anomalías: %v", err)
+	}
+	return anomalies, nil
+}
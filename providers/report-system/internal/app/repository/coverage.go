@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"report-system/internal/models"
+)
+
+const storeOutcomesCollection = "store-outcomes"
+
+// SaveStoreOutcome guarda el resultado de un local, una redelivery o un segundo envío del mismo local en la
+// conciliación lo reemplaza.
+func (receiver *MongoDataRepository) SaveStoreOutcome(coverage models.StoreCoverage) error {
+	_, err := receiver.database().Collection(storeOutcomesCollection).ReplaceOne(context.Background(),
+		bson.M{"conciliatorId": coverage.ConciliatorId, "provider": coverage.Provider, "storeId": coverage.StoreId},
+		coverage,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+// FindStoreOutcomes devuelve los resultados de los locales de la conciliación ordenados por local.
+func (receiver *MongoDataRepository) FindStoreOutcomes(conciliatorId string) ([]models.StoreCoverage, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "provider", Value: 1}, {Key: "storeId", Value: 1}})
+	cursor, err := receiver.database().Collection(storeOutcomesCollection).Find(context.Background(), bson.M{"conciliatorId": conciliatorId}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("ha ocurrido un error al buscar los locales de la conciliación %s: %v", conciliatorId, err)
+	}
+	defer cursor.Close(context.Background())
+	outcomes := make([]models.StoreCoverage, 0)
+	if err := cursor.All(context.Background(), &outcomes); err != nil {
+		return nil, fmt.Errorf("error al decodificar los locales de la conciliación %s: %v", conciliatorId, err)
+	}
+	return outcomes, nil
+}
+
+// LatestStoreOutcomes devuelve por local y día el resultado de la última conciliación que lo informó.
+func (receiver *MongoDataRepository) LatestStoreOutcomes(query models.CoverageQuery) ([]models.StoreCoverage, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"provider": query.Provider, "day": bson.M{"$gte": query.From, "$lte": query.To}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "at", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{"_id": bson.M{"storeId": "$storeId", "day": "$day"}, "outcome": bson.M{"$first": "$$ROOT"}}}},
+		{{Key: "$replaceWith", Value: "$outcome"}},
+		{{Key: "$sort", Value: bson.D{{Key: "storeId", Value: 1}, {Key: "day", Value: 1}}}},
+	}
+	outcomes := make([]models.StoreCoverage, 0)
+	if err := receiver.aggregate(receiver.database().Collection(storeOutcomesCollection), pipeline, &outcomes); err != nil {
+		return nil, fmt.Errorf("error al consultar la cobertura de %s: %v", query.Provider, err)
+	}
+	return outcomes, nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	lib_mapper "lib-shared/mapper"
+	"report-system/internal/models"
+)
+
+const duplicatesCollection = "cross-duplicates"
+
+// DuplicateCandidates devuelve los pagos del día cuya autorización aparece en más de un proveedor. Son
+// candidatos, la coincidencia completa se revisa con DuplicateKey.
+func (receiver *MongoDataRepository) DuplicateCandidates(day string) ([]models.PaymentData, error) {
+	providers := lib_mapper.Providers()
+	filter := bson.D{{Key: "$match", Value: bson.M{
+		"data.output.fecha_Transaccion":   day,
+		"data.output.numero_Autorizacion": bson.M{"$nin": bson.A{"", nil}},
+	}}}
+	project := bson.D{{Key: "$project", Value: bson.M{"data.input": 0, "runs": 0}}}
+	pipeline := mongo.Pipeline{filter, project}
+	for _, provider := range providers[1:] {
+		pipeline = append(pipeline, bson.D{{Key: "$unionWith", Value: bson.M{
+			"coll":     lib_mapper.CollectionName(provider),
+			"pipeline": bson.A{filter, project},
+		}}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":       bson.M{"$trim": bson.M{"input": "$data.output.numero_Autorizacion"}},
+			"providers": bson.M{"$addToSet": "$provider"},
+			"payments":  bson.M{"$push": "$$ROOT"},
+		}}},
+		bson.D{{Key: "$match", Value: bson.M{"providers.1": bson.M{"$exists": true}}}},
+		bson.D{{Key: "$unwind", Value: "$payments"}},
+		bson.D{{Key: "$replaceWith", Value: "$payments"}},
+	)
+	candidates := make([]models.PaymentData, 0)
+	collection := receiver.database().Collection(lib_mapper.CollectionName(providers[0]))
+	if err := receiver.aggregate(collection, pipeline, &candidates); err != nil {
+		return nil, fmt.Errorf("error al buscar pagos duplicados del %s: %v", day, err)
+	}
+	return candidates, nil
+}
+
+// SaveDuplicate guarda el duplicado por día y clave, los pagos se actualizan en cada detección y el resto queda
+// como se detectó la primera vez. Devuelve true si es nuevo.
+func (receiver *MongoDataRepository) SaveDuplicate(duplicate models.CrossDuplicate) (bool, error) {
+	result, err := receiver.database().Collection(duplicatesCollection).UpdateOne(context.Background(),
+		bson.M{"day": duplicate.Day, "key": duplicate.Key},
+		bson.M{
+			"$set": bson.M{
+				"providers": duplicate.Providers,
+				"payments":  duplicate.Payments,
+				"updatedAt": duplicate.UpdatedAt,
+			},
+			"$setOnInsert": bson.M{
+				"merchantId":    duplicate.MerchantId,
+				"authorization": duplicate.Authorization,
+				"reference":     duplicate.Reference,
+				"amount":        duplicate.Amount,
+				"conciliatorId": duplicate.ConciliatorId,
+				"detectedAt":    duplicate.DetectedAt,
+			},
+		},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return false, err
+	}
+	return result.UpsertedCount > 0, nil
+}
+
+// FindDuplicates devuelve los duplicados del rango de días, del más reciente al más antiguo.
+func (receiver *MongoDataRepository) FindDuplicates(query models.DuplicateQuery) ([]models.CrossDuplicate, error) {
+	filter := bson.M{"day": bson.M{"$gte": query.From, "$lte": query.To}}
+	if query.Provider != "" {
+		filter["providers"] = query.Provider
+	}
+	findOptions := options.Find().SetSort(bson.D{{Key: "day", Value: -1}, {Key: "merchantId", Value: 1}, {Key: "authorization", Value: 1}})
+	cursor, err := receiver.database().Collection(duplicatesCollection).Find(context.Background(), filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("ha ocurrido un error al buscar los pagos duplicados: %v", err)
+	}
+	defer cursor.Close(context.Background())
+	duplicates := make([]models.CrossDuplicate, 0)
+	if err := cursor.All(context.Background(), &duplicates); err != nil {
+		return nil, fmt.Errorf("error al decodificar los pagos duplicados: %v", err)
+	}
+	return duplicates, nil
+}
@@ -7,8 +7,12 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	lib_mapper "lib-shared/mapper"
 	"lib-shared/reports_models"
+	"regexp"
 	"report-system/internal/config"
+	"report-system/internal/models"
+	"time"
 )
 
 type MerchantPaymentHash struct {
@@ -17,15 +21,22 @@ type MerchantPaymentHash struct {
 }
 
 type MongoDataRepository struct {
-	Client                *mongo.Client
-	ReportCollection      *mongo.Collection
-	DataReportsCollection *mongo.Collection
+	Client                   *mongo.Client
+	ReportCollection         *mongo.Collection
+	DataReportsCollection    *mongo.Collection
+	SirWriteReportCollection *mongo.Collection
 }
 
 func NewMongoDataRepository(client *mongo.Client, cfg config.Config) *MongoDataRepository {
 	ReportCollection := client.Database(cfg.Mongo.Database).Collection("reports")
 	DataReportsCollection := client.Database(cfg.Mongo.Database).Collection("data-reports")
-	return &MongoDataRepository{Client: client, ReportCollection: ReportCollection, DataReportsCollection: DataReportsCollection}
+	SirWriteReportCollection := client.Database(cfg.Mongo.Database).Collection("sir-write-reports")
+	return &MongoDataRepository{
+		Client:                   client,
+		ReportCollection:         ReportCollection,
+		DataReportsCollection:    DataReportsCollection,
+		SirWriteReportCollection: SirWriteReportCollection,
+	}
 }
 func (receiver *MongoDataRepository) CreateReport(report reports_models.ReportConciliator) error {
 	_, err := receiver.ReportCollection.InsertOne(context.Background(), report)
@@ -51,12 +62,17 @@ func (receiver *MongoDataRepository) StartedReport(report reports_models.Started
 	}
 	return nil
 }
+
+// CompletedReport registra que el proveedor terminó, la conciliación se marca completada en TryCompleteReport
+// cuando sir-writer confirmó todos los wrappers enviados.
 func (receiver *MongoDataRepository) CompletedReport(report reports_models.CompletedReport) error {
 	_, err := receiver.ReportCollection.UpdateOne(context.Background(), bson.M{"conciliatorId": report.ConciliatorId},
 		bson.M{"$set": bson.M{
-			"completedAt": report.CompletedAt,
-			"elapsedTime": report.ElapsedTime,
-			"entries":     report.Entries,
+			"providerCompletedAt": report.CompletedAt,
+			"elapsedTime":         report.ElapsedTime,
+			"entries":             report.Entries,
+			"sir.wrappers":        report.Wrappers,
+			"sir.publishFailed":   report.PublishFailed,
 		}})
 	if err != nil {
 		return err
@@ -64,6 +80,175 @@ func (receiver *MongoDataRepository) CompletedReport(report reports_models.Compl
 	return nil
 }
 
+// SaveSirWriteReport guarda el resultado de un wrapper una sola vez, las redeliveries del mismo wrapper se ignoran.
+func (receiver *MongoDataRepository) SaveSirWriteReport(report reports_models.SirWriteReport) (bool, error) {
+	result, err := receiver.SirWriteReportCollection.UpdateOne(context.Background(),
+		bson.M{"wrapperId": report.WrapperId},
+		bson.M{"$setOnInsert": report},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return false, err
+	}
+	return result.UpsertedCount > 0, nil
+}
+
+// RefreshSirEntries recalcula los totales de SIR de la conciliación a partir de los resultados por wrapper.
+func (receiver *MongoDataRepository) RefreshSirEntries(conciliatorId string) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"conciliatorId": conciliatorId}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":             nil,
+			"appliedWrappers": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", reports_models.SirWriteApplied}}, 1, 0}}},
+			"failedWrappers":  bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$status", reports_models.SirWriteFailed}}, 1, 0}}},
+			"written":         bson.M{"$sum": bson.M{"$add": bson.A{"$inserted", "$updated", "$deleted"}}},
+			"failed":          bson.M{"$sum": "$failed"},
+			"quarantined":     bson.M{"$sum": "$quarantined"},
+		}}},
+	}
+	cursor, err := receiver.SirWriteReportCollection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return fmt.Errorf("error al agrupar los resultados de SIR: %v", err)
+	}
+	defer cursor.Close(context.Background())
+	var totals reports_models.SirEntriesReport
+	if cursor.Next(context.Background()) {
+		if err := cursor.Decode(&totals); err != nil {
+			return fmt.Errorf("error al decodificar los resultados de SIR: %v", err)
+		}
+	}
+	_, err = receiver.ReportCollection.UpdateOne(context.Background(), bson.M{"conciliatorId": conciliatorId},
+		bson.M{"$set": bson.M{
+			"sir.appliedWrappers": totals.AppliedWrappers,
+			"sir.failedWrappers":  totals.FailedWrappers,
+			"sir.written":         totals.Written,
+			"sir.failed":          totals.Failed,
+			"sir.quarantined":     totals.Quarantined,
+		}})
+	return err
+}
+
+// TryCompleteReport marca la conciliación como completada si el proveedor terminó y todos sus wrappers
+// ya tienen un resultado definitivo en SIR.
+func (receiver *MongoDataRepository) TryCompleteReport(conciliatorId string, transition reports_models.RunTransition) (bool, error) {
+	filter := bson.M{
+		"conciliatorId":       conciliatorId,
+		"completedAt":         nil,
+		"status":              bson.M{"$in": statusFrom(transition.Status)},
+		"providerCompletedAt": bson.M{"$ne": nil},
+		"$expr": bson.M{"$gte": bson.A{
+			bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$sir.appliedWrappers", 0}},
+				bson.M{"$ifNull": bson.A{"$sir.failedWrappers", 0}},
+			}},
+			bson.M{"$ifNull": bson.A{"$sir.wrappers", 0}},
+		}},
+	}
+	result, err := receiver.ReportCollection.UpdateOne(context.Background(), filter,
+		statusUpdate(transition, bson.M{"completedAt": transition.At}))
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// UpdateStatus pasa la conciliación al estado de transition si la transición está permitida desde el estado
+// actual, devuelve false si no lo está o si el reporte todavía no existe. set son campos que se guardan junto
+// con el estado.
+func (receiver *MongoDataRepository) UpdateStatus(conciliatorId string, transition reports_models.RunTransition, set bson.M) (bool, error) {
+	filter := bson.M{
+		"conciliatorId": conciliatorId,
+		"status":        bson.M{"$in": statusFrom(transition.Status)},
+	}
+	result, err := receiver.ReportCollection.UpdateOne(context.Background(), filter, statusUpdate(transition, set))
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// TimeOutStaleRuns marca como vencidas las conciliaciones creadas antes de before que nunca empezaron y las que
+// empezaron antes de before y no terminaron. Devuelve los ids que marcó, se actualizan de a uno para no incluir
+// una conciliación que terminó entre la búsqueda y la actualización.
+func (receiver *MongoDataRepository) TimeOutStaleRuns(before time.Time, transition reports_models.RunTransition) ([]string, error) {
+	filter := bson.M{
+		"completedAt": nil,
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$in": bson.A{reports_models.RunQueued, reports_models.RunDispatched}}, "createdAt": bson.M{"$lt": before}},
+			bson.M{"status": reports_models.RunRunning, "startedAt": bson.M{"$lt": before}},
+		},
+	}
+	cursor, err := receiver.ReportCollection.Find(context.Background(), filter,
+		options.Find().SetProjection(bson.M{"conciliatorId": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var stale []struct {
+		ConciliatorId string `bson:"conciliatorId"`
+	}
+	if err := cursor.All(context.Background(), &stale); err != nil {
+		return nil, err
+	}
+	timedOut := make([]string, 0, len(stale))
+	for _, report := range stale {
+		filter["conciliatorId"] = report.ConciliatorId
+		result, err := receiver.ReportCollection.UpdateOne(context.Background(), filter, statusUpdate(transition, nil))
+		if err != nil {
+			return timedOut, err
+		}
+		if result.ModifiedCount > 0 {
+			timedOut = append(timedOut, report.ConciliatorId)
+		}
+	}
+	return timedOut, nil
+}
+
+// HasErrorEntries indica si la conciliación tiene alguna entrada ERROR en su reporte.
+func (receiver *MongoDataRepository) HasErrorEntries(conciliatorId string) (bool, error) {
+	count, err := receiver.DataReportsCollection.CountDocuments(context.Background(),
+		bson.M{"conciliatorId": conciliatorId, "type": "ERROR"}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// statusFrom son los estados desde los que se puede pasar a next, un reporte creado antes de que existiera el
+// estado no tiene el campo y también se puede actualizar.
+func statusFrom(next reports_models.RunStatus) bson.A {
+	from := bson.A{nil}
+	for _, status := range reports_models.RunStatusFrom(next) {
+		from = append(from, status)
+	}
+	return from
+}
+
+func statusUpdate(transition reports_models.RunTransition, set bson.M) bson.M {
+	fields := bson.M{
+		"status":          transition.Status,
+		"statusReason":    transition.Reason,
+		"statusUpdatedAt": transition.At,
+	}
+	for key, value := range set {
+		fields[key] = value
+	}
+	return bson.M{
+		"$set":  fields,
+		"$push": bson.M{"statusHistory": transition},
+	}
+}
+
+// SaveRollback guarda en el reporte el último rollback aplicado (o fallido) sobre la conciliación y devuelve si
+// es nuevo, una redelivery del mismo RollbackId no modifica el reporte.
+func (receiver *MongoDataRepository) SaveRollback(report reports_models.SirRollbackReport) (bool, error) {
+	result, err := receiver.ReportCollection.UpdateOne(context.Background(),
+		bson.M{"conciliatorId": report.ConciliatorId, "rollback.rollbackId": bson.M{"$ne": report.RollbackId}},
+		bson.M{"$set": bson.M{"rollback": report}})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
 func (receiver *MongoDataRepository) FindById(id string) (*reports_models.ReportConciliator, error) {
 	var report *reports_models.ReportConciliator
 	err := receiver.ReportCollection.FindOne(context.Background(), bson.M{"conciliatorId": id}).Decode(&report)
@@ -105,3 +290,133 @@ func (receiver *MongoDataRepository) FindDataById(id string) ([]reports_models.R
 
 	return reports, nil
 }
+
+// FindPaymentRuns devuelve los pagos del proveedor que guardó alguna de las conciliaciones, solo con su
+// uniqueId, local y corridas.
+func (receiver *MongoDataRepository) FindPaymentRuns(provider string, conciliatorIds ...string) ([]lib_mapper.Payment, error) {
+	name := lib_mapper.CollectionName(provider)
+	if name == "" {
+		return nil, fmt.Errorf("el proveedor %s no guarda pagos en MongoDB", provider)
+	}
+	collection := receiver.database().Collection(name)
+	projection := bson.M{"uniqueId": 1, "storeId": 1, "runs": 1}
+	cursor, err := collection.Find(context.Background(), bson.M{"runs.conciliatorId": bson.M{"$in": conciliatorIds}},
+		options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, fmt.Errorf("ha ocurrido un error al buscar los pagos de %s: %v", provider, err)
+	}
+	defer cursor.Close(context.Background())
+	payments := make([]lib_mapper.Payment, 0)
+	if err := cursor.All(context.Background(), &payments); err != nil {
+		return nil, fmt.Errorf("error al decodificar los pagos de %s: %v", provider, err)
+	}
+	return payments, nil
+}
+
+// SearchPayments busca en las colecciones fetch-* de los proveedores (todas si search.Provider está vacío) y
+// devuelve la página pedida, de la transacción más reciente a la más antigua, y el total de pagos encontrados.
+func (receiver *MongoDataRepository) SearchPayments(search models.PaymentSearch, skip, limit int) ([]models.PaymentData, int, error) {
+	providers := lib_mapper.Providers()
+	if search.Provider != "" {
+		providers = []string{search.Provider}
+	}
+	// cada colección se filtra por separado y $unionWith junta los resultados antes de ordenar y paginar
+	filter := bson.D{
+		{Key: "$match", Value: paymentsFilter(search)},
+	}
+	project := bson.D{
+		{Key: "$project", Value: bson.M{"runs": 0}},
+	}
+	pipeline := mongo.Pipeline{filter, project}
+	for _, provider := range providers[1:] {
+		pipeline = append(pipeline, bson.D{{Key: "$unionWith", Value: bson.M{
+			"coll":     lib_mapper.CollectionName(provider),
+			"pipeline": bson.A{filter, project},
+		}}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$sort", Value: bson.D{
+			{Key: "data.output.fecha_Transaccion", Value: -1},
+			{Key: "data.output.hora_Transaccion", Value: -1},
+			{Key: "uniqueId", Value: 1},
+		}}},
+		bson.D{{Key: "$facet", Value: bson.M{
+			"total": bson.A{bson.M{"$count": "count"}},
+			"data":  bson.A{bson.M{"$skip": skip}, bson.M{"$limit": limit}},
+		}}},
+	)
+	collection := receiver.database().Collection(lib_mapper.CollectionName(providers[0]))
+	cursor, err := collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ha ocurrido un error al buscar los pagos: %v", err)
+	}
+	defer cursor.Close(context.Background())
+	var result struct {
+		Total []struct {
+			Count int `bson:"count"`
+		} `bson:"total"`
+		Data []models.PaymentData `bson:"data"`
+	}
+	if cursor.Next(context.Background()) {
+		if err := cursor.Decode(&result); err != nil {
+			return nil, 0, fmt.Errorf("error al decodificar los pagos: %v", err)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error durante la iteración de los pagos: %v", err)
+	}
+	total := 0
+	if len(result.Total) > 0 {
+		total = result.Total[0].Count
+	}
+	return result.Data, total, nil
+}
+
+// paymentsFilter arma el filtro de la búsqueda sobre los campos de Data.Output, face_Value es texto y se
+// convierte a número para comparar el monto.
+func paymentsFilter(search models.PaymentSearch) bson.M {
+	filter := bson.M{}
+	equals := map[string]string{
+		"uniqueId":                        search.UniqueId,
+		"storeId":                         search.StoreId,
+		"data.output.merchantId":          search.MerchantId,
+		"data.output.numero_Autorizacion": search.Authorization,
+		"data.output.numero_Referencia":   search.Reference,
+	}
+	for field, value := range equals {
+		if value != "" {
+			filter[field] = value
+		}
+	}
+	if search.CardSuffix != "" {
+		filter["data.output.numero_Tarjeta_Mask"] = bson.M{"$regex": regexp.QuoteMeta(search.CardSuffix) + "$"}
+	}
+	dates := bson.M{}
+	if search.DateFrom != "" {
+		dates["$gte"] = search.DateFrom
+	}
+	if search.DateTo != "" {
+		dates["$lte"] = search.DateTo
+	}
+	if len(dates) > 0 {
+		filter["data.output.fecha_Transaccion"] = dates
+	}
+	amount := bson.M{"$convert": bson.M{"input": "$data.output.face_Value", "to": "double", "onError": nil, "onNull": nil}}
+	amounts := bson.A{}
+	if search.MinAmount != nil {
+		amounts = append(amounts, bson.M{"$gte": bson.A{amount, *search.MinAmount}})
+	}
+	if search.MaxAmount != nil {
+		amounts = append(amounts, bson.M{"$lte": bson.A{amount, *search.MaxAmount}})
+	}
+	if len(amounts) > 0 {
+		// null es menor que cualquier número, un face_Value que no es número se descarta aparte
+		amounts = append(amounts, bson.M{"$ne": bson.A{amount, nil}})
+		filter["$expr"] = bson.M{"$and": amounts}
+	}
+	return filter
+}
+
+func (receiver *MongoDataRepository) Close() {
+	receiver.Client.Disconnect(context.Background())
+}
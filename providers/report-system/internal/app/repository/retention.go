@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	lib_mapper "lib-shared/mapper"
+	"time"
+)
+
+// RetentionCollections son las colecciones que pueden vencer: las fetch-* de cada proveedor y data-reports.
+// Todas guardan la fecha del documento en createdAt, en las fetch-* es la de la última conciliación que guardó
+// el pago.
+func (receiver *MongoDataRepository) RetentionCollections() []string {
+	collections := make([]string, 0)
+	for _, provider := range lib_mapper.Providers() {
+		collections = append(collections, lib_mapper.CollectionName(provider))
+	}
+	return append(collections, receiver.DataReportsCollection.Name())
+}
+
+// archivedFields son los campos que se quitan de los pagos de las fetch-* al archivarlos. El resto del
+// documento queda como stub porque uniqueId, hash, sirHash y syncStatus son lo único que dice qué tiene SIR, sin
+// ellos una nueva conciliación del día enviaría INSERT por pagos ya escritos.
+var archivedFields = []string{"data.input", "runs"}
+
+// keepsStubs indica si la colección es de pagos, donde al archivar queda un stub en lugar de borrar.
+func (receiver *MongoDataRepository) keepsStubs(collection string) bool {
+	return collection != receiver.DataReportsCollection.Name()
+}
+
+// expiredFilter son los documentos con createdAt anterior a before, un documento restaurado no vence hasta
+// que pasen los mismos días desde su restauración. En las fetch-* un stub ya archivado no vuelve a vencer.
+func (receiver *MongoDataRepository) expiredFilter(collection string, before time.Time) bson.M {
+	filter := bson.M{
+		"createdAt": bson.M{"$lt": before},
+		"$or": bson.A{
+			bson.M{"restoredAt": bson.M{"$exists": false}},
+			bson.M{"restoredAt": bson.M{"$lt": before}},
+		},
+	}
+	if receiver.keepsStubs(collection) {
+		filter["data.input"] = bson.M{"$exists": true}
+	}
+	return filter
+}
+
+// ExpiredDocuments devuelve hasta limit documentos vencidos de la colección, ordenados por _id.
+func (receiver *MongoDataRepository) ExpiredDocuments(collection string, before time.Time, limit int) ([]bson.Raw, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := receiver.database().Collection(collection).Find(context.Background(), receiver.expiredFilter(collection, before), findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("error al buscar los documentos vencidos de %s: %v", collection, err)
+	}
+	defer cursor.Close(context.Background())
+	documents := make([]bson.Raw, 0)
+	for cursor.Next(context.Background()) {
+		documents = append(documents, append(bson.Raw{}, cursor.Current...))
+	}
+	return documents, cursor.Err()
+}
+
+// PurgeExpired quita de Mongo los documentos archivados que siguen vencidos: en data-reports los borra y en las
+// fetch-* les quita archivedFields. Uno que una conciliación volvió a guardar mientras se archivaba no se toca.
+func (receiver *MongoDataRepository) PurgeExpired(collection string, ids []any, before time.Time) (int64, error) {
+	filter := receiver.expiredFilter(collection, before)
+	filter["_id"] = bson.M{"$in": ids}
+	if receiver.keepsStubs(collection) {
+		unset := bson.M{}
+		for _, field := range archivedFields {
+			unset[field] = ""
+		}
+		result, err := receiver.database().Collection(collection).UpdateMany(context.Background(), filter, bson.M{"$unset": unset})
+		if err != nil {
+			return 0, fmt.Errorf("error al reducir los pagos vencidos de %s: %v", collection, err)
+		}
+		return result.ModifiedCount, nil
+	}
+	result, err := receiver.database().Collection(collection).DeleteMany(context.Background(), filter)
+	if err != nil {
+		return 0, fmt.Errorf("error al borrar los documentos vencidos de %s: %v", collection, err)
+	}
+	return result.DeletedCount, nil
+}
+
+// RestoreDocuments vuelve a guardar los documentos archivados por su _id con restoredAt, restaurar el mismo
+// archivo dos veces no los duplica. En las fetch-* solo se completan los stubs con archivedFields, el estado de
+// sincronización del stub es más nuevo que el archivado, y un pago que se volvió a guardar no se toca.
+func (receiver *MongoDataRepository) RestoreDocuments(collection string, documents []bson.D, restoredAt time.Time) error {
+	models := make([]mongo.WriteModel, 0, len(documents))
+	for _, document := range documents {
+		var id any
+		restored := make(bson.D, 0, len(document)+1)
+		archived := bson.M{"restoredAt": restoredAt}
+		for _, element := range document {
+			switch element.Key {
+			case "_id":
+				id = element.Value
+				continue
+			case "restoredAt":
+				continue
+			case "data":
+				if data, ok := element.Value.(bson.D); ok {
+					for _, field := range data {
+						if field.Key == "input" {
+							archived["data.input"] = field.Value
+						}
+					}
+				}
+			case "runs":
+				archived["runs"] = element.Value
+			}
+			restored = append(restored, element)
+		}
+		if id == nil {
+			return fmt.Errorf("un documento archivado de %s no tiene _id", collection)
+		}
+		restored = append(restored, bson.E{Key: "restoredAt", Value: restoredAt})
+		if !receiver.keepsStubs(collection) {
+			models = append(models, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": id}).SetReplacement(restored).SetUpsert(true))
+			continue
+		}
+		// si el documento ya no existe se inserta completo, si es un stub se le devuelven los campos archivados
+		models = append(models,
+			mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": id}).SetUpdate(bson.M{"$setOnInsert": restored}).SetUpsert(true),
+			mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": id, "data.input": bson.M{"$exists": false}}).SetUpdate(bson.M{"$set": archived}))
+	}
+	if len(models) == 0 {
+		return nil
+	}
+	_, err := receiver.database().Collection(collection).BulkWrite(context.Background(), models, options.BulkWrite().SetOrdered(true))
+	return err
+}
@@ -2,25 +2,71 @@ package config
 
 import (
 	"github.com/joho/godotenv"
+	"lib-shared/infrastructure/messaging_nats"
 	"log"
 	"os"
 	"report-system/utils"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	HttpServer string
 	Mongo      MongoConfig
-	Nats       NatsConfig
+	Nats       messaging_nats.Connection
 	TimeZone   string
+	Watchdog   WatchdogConfig
+	Anomalies  AnomaliesConfig
+	Retention  RetentionConfig
+}
+
+// WatchdogConfig es cada cuánto se buscan conciliaciones colgadas y cuánto puede tardar una antes de marcarla
+// como vencida.
+type WatchdogConfig struct {
+	Interval   time.Duration
+	RunTimeout time.Duration
+}
+
+// AnomaliesConfig es la detección de anomalías por local: se compara el día contra el mismo día de la semana de
+// las últimas Weeks semanas, con al menos MinHistory semanas con pagos. Un local es anómalo si su cantidad o monto
+// queda por debajo de Ratio o por encima de 1/Ratio de la mediana, los locales con menos de MinCount pagos de
+// mediana no se evalúan.
+type AnomaliesConfig struct {
+	Weeks      int
+	MinHistory int
+	Ratio      float64
+	MinCount   int
+}
+
+// RetentionConfig son los días que se guardan los documentos de cada colección (fetch-* y data-reports), una
+// colección sin días no vence. Los documentos vencidos se archivan en Archive de a BatchSize antes de quitarlos
+// de Mongo. Con Interval la retención se ejecuta en el servicio, sin él solo con el comando archive.
+type RetentionConfig struct {
+	Interval  time.Duration
+	Days      map[string]int
+	BatchSize int
+	Archive   ArchiveConfig
+}
+
+// ArchiveConfig es el destino de los archivos: un bucket S3 compatible (MinIO en local) si S3Endpoint está
+// configurado, si no la carpeta Dir.
+type ArchiveConfig struct {
+	Dir         string
+	S3Endpoint  string
+	S3Bucket    string
+	S3Prefix    string
+	S3AccessKey string
+	S3SecretKey string
+	S3Region    string
+	S3UseSSL    bool
 }
 
 type MongoConfig struct {
 	URI      string
 	Database string
 }
-type NatsConfig struct {
-	URI string
-}
+
 type SqlServerSir struct {
 	JDBC string
 }
@@ -40,10 +86,33 @@ func LoadConfig() Config {
 			URI:      getEnv("MONGO_URI", "no_configurado"),
 			Database: getEnv("MONGO_DATABASE", "no_configurado"),
 		},
-		Nats: NatsConfig{
-			URI: getEnv("NATS_URI", "no_configurado"),
-		},
+		Nats:     messaging_nats.ConnectionFromEnv(),
 		TimeZone: getEnv("TIMEZONE", "no_configurado"),
+		Watchdog: WatchdogConfig{
+			Interval:   getEnvDuration("WATCHDOG_INTERVAL", time.Minute),
+			RunTimeout: getEnvDuration("RUN_TIMEOUT", 2*time.Hour),
+		},
+		Anomalies: AnomaliesConfig{
+			Weeks:      getEnvInt("ANOMALY_WEEKS", 4),
+			MinHistory: getEnvInt("ANOMALY_MIN_HISTORY", 2),
+			Ratio:      getEnvFloat("ANOMALY_RATIO", 0.5),
+			MinCount:   getEnvInt("ANOMALY_MIN_COUNT", 10),
+		},
+		Retention: RetentionConfig{
+			Interval:  getEnvDuration("RETENTION_INTERVAL", 0),
+			Days:      getEnvDays("RETENTION_DAYS"),
+			BatchSize: getEnvInt("RETENTION_BATCH_SIZE", 1000),
+			Archive: ArchiveConfig{
+				Dir:         getEnv("ARCHIVE_DIR", "archive"),
+				S3Endpoint:  getEnv("ARCHIVE_S3_ENDPOINT", ""),
+				S3Bucket:    getEnv("ARCHIVE_S3_BUCKET", ""),
+				S3Prefix:    getEnv("ARCHIVE_S3_PREFIX", ""),
+				S3AccessKey: getEnv("ARCHIVE_S3_ACCESS_KEY", ""),
+				S3SecretKey: getEnv("ARCHIVE_S3_SECRET_KEY", ""),
+				S3Region:    getEnv("ARCHIVE_S3_REGION", ""),
+				S3UseSSL:    getEnvBool("ARCHIVE_S3_USE_SSL", true),
+			},
+		},
 	}
 }
 
@@ -54,3 +123,55 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt obtiene una variable de entorno numérica o usa el valor por defecto si no existe o no es un número.
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvFloat obtiene una variable de entorno decimal o usa el valor por defecto si no existe o no es un número.
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(getEnv(key, ""), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvDuration obtiene una duración (2h, 30m) o usa el valor por defecto si no existe o no es válida.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvBool obtiene una variable de entorno booleana o usa el valor por defecto si no existe o no es válida.
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvDays lee los días por colección con el formato coleccion=dias,coleccion=dias, se ignoran las entradas
+// que no tienen un número de días mayor a cero.
+func getEnvDays(key string) map[string]int {
+	days := make(map[string]int)
+	for _, entry := range strings.Split(getEnv(key, ""), ",") {
+		collection, value, found := strings.Cut(entry, "=")
+		if !found {
+			continue
+		}
+		if parsed, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && parsed > 0 {
+			days[strings.TrimSpace(collection)] = parsed
+		}
+	}
+	return days
+}
@@ -0,0 +1,39 @@
+package models
+
+// AnalyticsQuery son los filtros de los endpoints de analítica. Period es day o month, GroupBy son las
+// dimensiones de los pagos (provider, store, cardGroup) y From/To son días AAAA-MM-DD inclusive.
+type AnalyticsQuery struct {
+	Period   string
+	GroupBy  []string
+	Provider string
+	From     string
+	To       string
+}
+
+// PaymentsAnalytics es una fila de la analítica de pagos, las dimensiones que no se agrupan quedan vacías.
+type PaymentsAnalytics struct {
+	Period    string  `json:"period"              bson:"period"`
+	Provider  string  `json:"provider,omitempty"  bson:"provider"`
+	StoreId   string  `json:"storeId,omitempty"   bson:"storeId"`
+	CardGroup string  `json:"cardGroup,omitempty" bson:"cardGroup"`
+	Count     int     `json:"count"               bson:"count"`
+	Amount    float64 `json:"amount"              bson:"amount"`
+}
+
+// RunsAnalytics es una fila de la analítica de conciliaciones por proveedor. ErrorRate es la proporción de
+// conciliaciones que no terminaron limpias (con errores, fallidas o vencidas).
+type RunsAnalytics struct {
+	Period              string  `json:"period"              bson:"period"`
+	Provider            string  `json:"provider"            bson:"provider"`
+	Runs                int     `json:"runs"                bson:"runs"`
+	Completed           int     `json:"completed"           bson:"completed"`
+	CompletedWithErrors int     `json:"completedWithErrors" bson:"completedWithErrors"`
+	Failed              int     `json:"failed"              bson:"failed"`
+	TimedOut            int     `json:"timedOut"            bson:"timedOut"`
+	Cancelled           int     `json:"cancelled"           bson:"cancelled"`
+	ErrorEntries        int     `json:"errorEntries"        bson:"errorEntries"`
+	ErrorRate           float64 `json:"errorRate"           bson:"-"`
+	AvgElapsedSeconds   float64 `json:"avgElapsedSeconds"   bson:"-"`
+	ElapsedTotal        int     `json:"-"                   bson:"elapsedTotal"`
+	ElapsedRuns         int     `json:"-"                   bson:"elapsedRuns"`
+}
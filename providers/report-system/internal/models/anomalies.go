@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Tipos de anomalía de un local.
+const (
+	// AnomalyMissingStore es un local con pagos en su historial que no tiene ninguno en el día, suele ser el
+	// servidor del kiosco caído.
+	AnomalyMissingStore = "MISSING_STORE"
+	AnomalyLowCount     = "LOW_COUNT"
+	AnomalyHighCount    = "HIGH_COUNT"
+	AnomalyLowAmount    = "LOW_AMOUNT"
+	AnomalyHighAmount   = "HIGH_AMOUNT"
+)
+
+// StoreTotals es la cantidad y el monto de los pagos de un local en un día, sumando sus grupos de tarjeta.
+type StoreTotals struct {
+	Day     string  `bson:"day"`
+	StoreId string  `bson:"storeId"`
+	Count   int     `bson:"count"`
+	Amount  float64 `bson:"amount"`
+}
+
+// Anomaly es un local cuyo día se aleja de su historial, Expected* son las medianas del mismo día de la semana
+// en las History semanas anteriores con pagos.
+type Anomaly struct {
+	ConciliatorId  string    `json:"conciliatorId"  bson:"conciliatorId"`
+	Provider       string    `json:"provider"       bson:"provider"`
+	Day            string    `json:"day"            bson:"day"`
+	StoreId        string    `json:"storeId"        bson:"storeId"`
+	Kind           string    `json:"kind"           bson:"kind"`
+	Count          int       `json:"count"          bson:"count"`
+	Amount         float64   `json:"amount"         bson:"amount"`
+	ExpectedCount  float64   `json:"expectedCount"  bson:"expectedCount"`
+	ExpectedAmount float64   `json:"expectedAmount" bson:"expectedAmount"`
+	History        int       `json:"history"        bson:"history"`
+	CreatedAt      time.Time `json:"createdAt"      bson:"createdAt"`
+}
+
+// AnomalyQuery son los filtros del endpoint de anomalías, los vacíos no filtran.
+type AnomalyQuery struct {
+	ConciliatorId string
+	Provider      string
+	Kind          string
+	From          string
+	To            string
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"lib-shared/reports_models"
+	"lib-shared/sir_models"
+)
+
+// RunComparison es la diferencia entre dos conciliaciones de la misma solicitud: qué tiene Target que no tenía
+// Base, qué dejó de tener y qué pagos cambiaron.
+type RunComparison struct {
+	Base     string                 `json:"base"`
+	Target   string                 `json:"target"`
+	Request  reports_models.Request `json:"request"`
+	Payments PaymentsComparison     `json:"payments"`
+	Errors   ErrorsComparison       `json:"errors"`
+}
+
+type PaymentsComparison struct {
+	Added     []PaymentSnapshot `json:"added"`
+	Removed   []PaymentSnapshot `json:"removed"`
+	Changed   []PaymentChange   `json:"changed"`
+	Unchanged int               `json:"unchanged"`
+}
+
+// PaymentSnapshot es un pago como lo obtuvo una de las dos conciliaciones.
+type PaymentSnapshot struct {
+	UniqueId string                    `json:"uniqueId"`
+	StoreId  string                    `json:"storeId"`
+	Output   sir_models.StTransactions `json:"output"`
+}
+
+type PaymentChange struct {
+	UniqueId string                 `json:"uniqueId"`
+	StoreId  string                 `json:"storeId"`
+	Fields   []sir_models.FieldDiff `json:"fields"`
+}
+
+// ErrorsComparison compara los mensajes de las entradas ERROR de los reportes, un mensaje repetido cuenta
+// cada vez.
+type ErrorsComparison struct {
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Unchanged int      `json:"unchanged"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import "lib-shared/reports_models"
+
+// StoreCoverage es el resultado de un local guardado en store-outcomes, Day es la fecha de la solicitud de su
+// conciliación.
+type StoreCoverage struct {
+	reports_models.StoreOutcome `bson:",inline"`
+	Day                         string `json:"day" bson:"day"`
+}
+
+// RunCoverage es la cobertura de una conciliación: el resultado de cada local y cuántos locales hay por estado.
+type RunCoverage struct {
+	ConciliatorId string                             `json:"conciliatorId"`
+	Provider      string                             `json:"provider"`
+	Day           string                             `json:"day"`
+	Summary       map[reports_models.StoreStatus]int `json:"summary"`
+	Stores        []StoreCoverage                    `json:"stores"`
+}
+
+// CoverageQuery son los filtros de la cobertura por rango, From/To son días AAAA-MM-DD inclusive.
+type CoverageQuery struct {
+	Provider string
+	From     string
+	To       string
+}
+
+// CoverageMatrix es la cobertura de un proveedor en un rango de días, una fila por local y una columna por día.
+// De cada día se toma la última conciliación que informó el local.
+type CoverageMatrix struct {
+	Provider string                                        `json:"provider"`
+	From     string                                        `json:"from"`
+	To       string                                        `json:"to"`
+	Days     []string                                      `json:"days"`
+	Summary  map[string]map[reports_models.StoreStatus]int `json:"summary"`
+	Stores   []StoreCoverageRow                            `json:"stores"`
+}
+
+// StoreCoverageRow es la fila de un local, Cells va alineado con CoverageMatrix.Days y es null el día en que
+// ninguna conciliación informó el local.
+type StoreCoverageRow struct {
+	StoreId    string                             `json:"storeId"`
+	MerchantId string                             `json:"merchantId,omitempty"`
+	Summary    map[reports_models.StoreStatus]int `json:"summary"`
+	Cells      []*CoverageCell                    `json:"cells"`
+}
+
+type CoverageCell struct {
+	Status        reports_models.StoreStatus `json:"status"`
+	ConciliatorId string                     `json:"conciliatorId"`
+	Received      int                        `json:"received"`
+	Reason        string                     `json:"reason,omitempty"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// CrossDuplicate es un pago que aparece en más de una colección fetch-* con la misma DuplicateKey (fecha,
+// merchantId, autorización, referencia y monto), por ejemplo el reporte del switch del kiosco y Datafast.
+// ConciliatorId es la conciliación que lo detectó primero.
+type CrossDuplicate struct {
+	Day           string             `json:"day"           bson:"day"`
+	Key           string             `json:"key"           bson:"key"`
+	MerchantId    string             `json:"merchantId"    bson:"merchantId"`
+	Authorization string             `json:"authorization" bson:"authorization"`
+	Reference     string             `json:"reference"     bson:"reference"`
+	Amount        string             `json:"amount"        bson:"amount"`
+	Providers     []string           `json:"providers"     bson:"providers"`
+	Payments      []DuplicatePayment `json:"payments"      bson:"payments"`
+	ConciliatorId string             `json:"conciliatorId" bson:"conciliatorId"`
+	DetectedAt    time.Time          `json:"detectedAt"    bson:"detectedAt"`
+	UpdatedAt     time.Time          `json:"updatedAt"     bson:"updatedAt"`
+}
+
+// DuplicatePayment es uno de los pagos duplicados, Written indica si ya está escrito en SIR.
+type DuplicatePayment struct {
+	Provider      string `json:"provider"      bson:"provider"`
+	UniqueId      string `json:"uniqueId"      bson:"uniqueId"`
+	StoreId       string `json:"storeId"       bson:"storeId"`
+	ConciliatorId string `json:"conciliatorId" bson:"conciliatorId"`
+	Time          string `json:"time"          bson:"time"`
+	SyncStatus    string `json:"syncStatus"    bson:"syncStatus"`
+	Written       bool   `json:"written"       bson:"written"`
+}
+
+// DuplicateQuery son los filtros de los pagos duplicados, los vacíos no filtran salvo el rango de días.
+type DuplicateQuery struct {
+	Provider string
+	From     string
+	To       string
+}
@@ -1,15 +1,45 @@
 package models
 
+import (
+	"lib-shared/sir_models"
+	"time"
+)
+
+// PaymentSearch son los filtros de la búsqueda de pagos, los vacíos no filtran. Las fechas son AAAA-MM-DD y se
+// comparan con la fecha de la transacción, los montos con face_Value.
+type PaymentSearch struct {
+	Provider      string   `json:"provider"`
+	UniqueId      string   `json:"uniqueId"`
+	Authorization string   `json:"authorization"`
+	Reference     string   `json:"reference"`
+	MerchantId    string   `json:"merchantId"`
+	StoreId       string   `json:"storeId"`
+	CardSuffix    string   `json:"cardSuffix"`
+	MinAmount     *float64 `json:"minAmount"`
+	MaxAmount     *float64 `json:"maxAmount"`
+	DateFrom      string   `json:"dateFrom"`
+	DateTo        string   `json:"dateTo"`
+	Page          int      `json:"page"`
+	PageSize      int      `json:"pageSize"`
+}
+
+// PaymentData es un pago de una colección fetch-*: lo que devolvió el proveedor (Input), lo que se envía a SIR
+// (Output), la última conciliación que lo guardó y su estado de sincronización con SIR.
 type PaymentData struct {
-	ReferenceId     string `json:"referenceId"             bson:"referenceId"`
-	Amount          string `json:"amount"                  bson:"amount"`
-	CreatedAt       string `json:"createdAt"               bson:"errorCode"`
-	TransactionHour string `json:"transactionHour"         bson:"transactionHour"`
-	TransferNumber  string `json:"transferNumber"          bson:"transferNumber"`
-	Store           struct {
-		Id   int    `json:"id"                      bson:"id"`
-		Name string `json:"name"                    bson:"name"`
-	} `json:"store"         bson:"store"`
+	UniqueId      string    `json:"uniqueId"      bson:"uniqueId"`
+	Hash          string    `json:"hash"          bson:"hash"`
+	Provider      string    `json:"provider"      bson:"provider"`
+	StoreId       string    `json:"storeId"       bson:"storeId"`
+	ConciliatorId string    `json:"conciliatorId" bson:"conciliatorId"`
+	CreatedAt     time.Time `json:"createdAt"     bson:"createdAt"`
+	Data          struct {
+		Input  map[string]interface{}    `json:"input"  bson:"input"`
+		Output sir_models.StTransactions `json:"output" bson:"output"`
+	} `json:"data" bson:"data"`
+	SyncStatus string     `json:"syncStatus" bson:"syncStatus"`
+	SirHash    string     `json:"sirHash"    bson:"sirHash"`
+	SyncError  string     `json:"syncError,omitempty" bson:"syncError"`
+	SyncedAt   *time.Time `json:"syncedAt"   bson:"syncedAt"`
 }
 
 type PaymentResponse struct {
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v3"
+	"report-system/internal/models"
+	"strings"
+)
+
+type RefreshAnalyticsResponse struct {
+	Days    int    `json:"days"`
+	Message string `json:"message"`
+}
+
+// analyticsQuery lee los filtros de analítica de la query: period, groupBy (separado por comas), provider,
+// from y to.
+func analyticsQuery(c fiber.Ctx) models.AnalyticsQuery {
+	query := models.AnalyticsQuery{
+		Period:   c.Query("period"),
+		Provider: c.Query("provider"),
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+	}
+	for _, dimension := range strings.Split(c.Query("groupBy"), ",") {
+		if dimension = strings.TrimSpace(dimension); dimension != "" {
+			query.GroupBy = append(query.GroupBy, dimension)
+		}
+	}
+	return query
+}
+
+// handlerPaymentsAnalytics devuelve la cantidad y el monto de los pagos por día o mes, agrupados por proveedor,
+// local y/o grupo de tarjeta.
+func handlerPaymentsAnalytics(c fiber.Ctx) error {
+	analytics, err := reportService.PaymentsAnalytics(analyticsQuery(c))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("Error al obtener la analítica de pagos: %v", err),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(analytics)
+}
+
+// handlerRunsAnalytics devuelve las conciliaciones por día o mes y proveedor, con su tasa de error y duración.
+func handlerRunsAnalytics(c fiber.Ctx) error {
+	analytics, err := reportService.RunsAnalytics(analyticsQuery(c))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("Error al obtener la analítica de conciliaciones: %v", err),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(analytics)
+}
+
+// handlerRefreshAnalytics recalcula los rollups de un rango de días, los de cada conciliación se recalculan solos
+// cuando termina.
+func handlerRefreshAnalytics(c fiber.Ctx) error {
+	days, err := reportService.RefreshAnalytics(analyticsQuery(c))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("Error al recalcular la analítica: %v", err),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(RefreshAnalyticsResponse{
+		Days:    days,
+		Message: fmt.Sprintf("Se recalcularon los rollups de %d días", days),
+	})
+}
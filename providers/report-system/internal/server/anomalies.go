@@ -0,0 +1,25 @@
+package server
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v3"
+	"report-system/internal/models"
+)
+
+// handlerAnomalies devuelve las anomalías por local detectadas al terminar las conciliaciones, filtradas por
+// conciliatorId, provider, kind y rango de días from/to.
+func handlerAnomalies(c fiber.Ctx) error {
+	anomalies, err := reportService.FindAnomalies(models.AnomalyQuery{
+		ConciliatorId: c.Query("conciliatorId"),
+		Provider:      c.Query("provider"),
+		Kind:          c.Query("kind"),
+		From:          c.Query("from"),
+		To:            c.Query("to"),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("Error al obtener las anomalías: %v", err),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(anomalies)
+}
@@ -1,25 +1,28 @@
 package server
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/gofiber/fiber/v3"
-	"github.com/nats-io/nats.go/jetstream"
 	"lib-shared/infrastructure/messaging_nats"
 	"lib-shared/reports_models"
+	"lib-shared/topology"
 	utils2 "lib-shared/utils"
 	"os"
+	"os/signal"
+	"report-system/internal/app/archive"
 	db "report-system/internal/app/databases"
 	"report-system/internal/app/repository"
 	"report-system/internal/config"
 	"report-system/internal/service"
 	"report-system/utils"
 	"strings"
+	"syscall"
 	"time"
 )
 
-var exit = make(chan os.Signal, 1)
-var StreamName = "conciliador-tarjetas-report"
+// tiempo que se espera a los reportes y peticiones en proceso al recibir SIGTERM
+const shutdownTimeout = 20 * time.Second
 
 type ErrorResponse struct {
 	Error string `json:"error"`
@@ -31,92 +34,139 @@ type SuccessResponse struct {
 	Message string `json:"message"`
 }
 
-var (
-	BucketServicesProgress = "CONCILIATORS_PROGRESS"
-)
 var mongoDataRepository *repository.MongoDataRepository
 var cfgGlobal config.Config
 var natsManager *messaging_nats.NatsStarter
+var reportService *service.ReportService
 
+// NewContainer consume los reportes y atiende la API hasta recibir SIGINT o SIGTERM, y vuelve cuando las
+// peticiones y mensajes en proceso terminaron y las conexiones quedaron cerradas.
 func NewContainer(cfg config.Config) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	cfgGlobal = cfg
+	streamCtx = ctx
 	mongoClient, err := db.NewMongoClient(cfg.Mongo.URI)
 	if err != nil {
 		utils.Error.Panicf("Error creando el cliente de MongoDB: %v", err)
 	}
 	mongoDataRepository = repository.NewMongoDataRepository(mongoClient, cfg)
 	// Conectar a NATS
-	natsManager = messaging_nats.NewStartNats(cfg.Nats.URI, &messaging_nats.OptsNats{
-		NameStream: StreamName,
-		Subjects:   []string{"*.data.report"},
-		MaxAge:     24 * time.Hour,
-	})
+	natsManager, err = messaging_nats.NewStartNats(cfg.Nats, &messaging_nats.OptsNats{Topology: &topology.Conciliador})
+	if err != nil {
+		utils.Error.Fatalf("Error conectando a NATS: %v", err)
+	}
 	reportProvider := service.NewApiProvider(mongoDataRepository, natsManager, cfg)
-	err = natsManager.EventListener.Execute(StreamName, exit, 1, "new.data.report", "NEW_REPORTS", func(msg jetstream.Msg) {
-		var report reports_models.ReportConciliator
-		err := json.Unmarshal(msg.Data(), &report)
-		if err != nil {
-			msg.Ack()
-			utils.Error.Printf("Error decoding the report data: %v\n", err)
-			return
-		}
-		reportProvider.CreateReport(report)
-		msg.Ack()
-	})
+	reportService = reportProvider
+	err = reports_models.NewReportEvent.Consume(ctx, natsManager.EventListener, topology.Consumer(topology.NewReports), payload(reportProvider.CreateReport))
 	if err != nil {
 		utils.Error.Panic("Error al creando el nats", err)
 	}
-	err = natsManager.EventListener.Execute(StreamName, exit, 1, "add.data.report", "ADD_REPORTS", func(msg jetstream.Msg) {
-		var addReport reports_models.ReportData
-		err := json.Unmarshal(msg.Data(), &addReport)
-		if err != nil {
-			msg.Ack()
-			utils.Error.Printf("Error decoding the report data: %v\n", err)
-			return
-		}
-		reportProvider.AddToReport(addReport)
-		msg.Ack()
-	})
+	err = reports_models.AddReportEvent.Consume(ctx, natsManager.EventListener, topology.Consumer(topology.AddReports), payload(reportProvider.AddToReport))
 	if err != nil {
 		utils.Error.Panic("Error al creando el nats", err)
 	}
-	err = natsManager.EventListener.Execute(StreamName, exit, 1, "started.data.report", "STARTED_REPORT", func(msg jetstream.Msg) {
-		var started reports_models.StartedReport
-		err := json.Unmarshal(msg.Data(), &started)
-		if err != nil {
-			msg.Ack()
-			utils.Error.Printf("Error decoding the report data: %v\n", err)
-			return
-		}
-		reportProvider.StartedReport(started)
-		msg.Ack()
-	})
+	err = reports_models.StartedReportEvent.Consume(ctx, natsManager.EventListener, topology.Consumer(topology.StartedReport), payload(reportProvider.StartedReport))
 	if err != nil {
 		utils.Error.Panic("Error al creando el nats", err)
 	}
-	err = natsManager.EventListener.Execute(StreamName, exit, 1, "completed.data.report", "COMPLETED_REPORT", func(msg jetstream.Msg) {
-		var completed reports_models.CompletedReport
-		err := json.Unmarshal(msg.Data(), &completed)
-		if err != nil {
-			msg.Ack()
-			utils.Error.Printf("Error decoding the report data: %v\n", err)
-			return
-		}
-		reportProvider.CompletedReport(completed)
-		msg.Ack()
-	})
+	err = reports_models.CompletedReportEvent.Consume(ctx, natsManager.EventListener, topology.Consumer(topology.CompletedReport), payload(reportProvider.CompletedReport))
+	if err != nil {
+		utils.Error.Panic("Error al creando el nats", err)
+	}
+	err = reports_models.SirWriteReportEvent.Consume(ctx, natsManager.EventListener, topology.Consumer(topology.SirReports), payload(reportProvider.SirWriteReport))
+	if err != nil {
+		utils.Error.Panic("Error al creando el nats", err)
+	}
+	err = reports_models.SirRollbackReportEvent.Consume(ctx, natsManager.EventListener, topology.Consumer(topology.RollbackReports), payload(reportProvider.RollbackReport))
+	if err != nil {
+		utils.Error.Panic("Error al creando el nats", err)
+	}
+	err = reports_models.RunStatusReportEvent.Consume(ctx, natsManager.EventListener, topology.Consumer(topology.RunStatusReports), payload(reportProvider.RunStatusReport))
+	if err != nil {
+		utils.Error.Panic("Error al creando el nats", err)
+	}
+	err = reports_models.StoreOutcomeEvent.Consume(ctx, natsManager.EventListener, topology.Consumer(topology.StoreReports), payload(reportProvider.StoreOutcome))
 	if err != nil {
 		utils.Error.Panic("Error al creando el nats", err)
 	}
+	go runWatchdog(ctx, reportProvider, cfg.Watchdog)
+	if cfg.Retention.Interval > 0 {
+		store, err := archive.NewStore(cfg.Retention.Archive)
+		if err != nil {
+			utils.Error.Printf("[retention] no se programa la retención: %v\n", err)
+		} else {
+			go runRetention(ctx, reportProvider, store, cfg.Retention.Interval)
+		}
+	}
 	app := fiber.New()
 	group := app.Group("/api/payment-conciliator")
 	group.Get("/details/:id", handlerDetailOperation)
-	group.Post("/payments/:id", handlerTemp)
+	group.Get("/details/:id/stream", handlerDetailStream)
+	group.Get("/compare/:base/:target", handlerCompareRuns)
+	group.Post("/payments/search", handlerSearchPayments)
+	group.Get("/payments/:id", handlerPayment)
+	group.Get("/analytics/payments", handlerPaymentsAnalytics)
+	group.Get("/analytics/runs", handlerRunsAnalytics)
+	group.Post("/analytics/refresh", handlerRefreshAnalytics)
+	group.Get("/anomalies", handlerAnomalies)
+	group.Get("/coverage", handlerCoverageMatrix)
+	group.Get("/coverage/:id", handlerRunCoverage)
+	group.Get("/duplicates", handlerDuplicates)
+	group.Post("/duplicates/scan", handlerScanDuplicates)
+	go func() {
+		<-ctx.Done()
+		utils.Warning.Println("[shutdown] señal recibida, se detiene el servidor http y los listeners")
+		if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+			utils.Error.Printf("[shutdown] error al detener el servidor http: %v\n", err)
+		}
+	}()
 	utils.Info.Println("Servidor en http://" + cfg.HttpServer)
-	app.Listen(cfg.HttpServer)
+	if err := app.Listen(cfg.HttpServer); err != nil {
+		utils.Error.Printf("error en el servidor http: %v\n", err)
+		stop()
+	}
+	<-ctx.Done()
+	if err := natsManager.Shutdown(shutdownTimeout); err != nil {
+		utils.Error.Printf("[shutdown] %v\n", err)
+	}
+	mongoDataRepository.Close()
 }
-func handlerTemp(c fiber.Ctx) error {
-	return nil
+
+// runWatchdog marca como vencidas las conciliaciones colgadas cada cfg.Interval hasta que se cancele ctx. Con
+// varias réplicas todas lo ejecutan, la actualización solo toca las que siguen sin terminar.
+func runWatchdog(ctx context.Context, reportProvider *service.ReportService, cfg config.WatchdogConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := reportProvider.TimeOutStaleRuns(cfg.RunTimeout); err != nil {
+				utils.Error.Printf("[watchdog] %v\n", err)
+			}
+		}
+	}
+}
+
+// handlerCompareRuns compara dos conciliaciones de la misma solicitud, target contra base, para ver si una
+// nueva ejecución trajo pagos tardíos del proveedor.
+func handlerCompareRuns(c fiber.Ctx) error {
+	base := c.Params("base", "")
+	target := c.Params("target", "")
+	if utils2.IsEmptyString(base) || utils2.IsEmptyString(target) {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: "Debes especificar los ids de las dos conciliaciones",
+		})
+	}
+	comparison, err := reportService.CompareRuns(base, target)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("Error al comparar las conciliaciones: %v", err),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(comparison)
 }
 func handlerDetailOperation(c fiber.Ctx) error {
 	id := c.Params("id", "")
@@ -145,12 +195,23 @@ func handlerDetailOperation(c fiber.Ctx) error {
 	if dataReports == nil {
 		dataReports = make([]reports_models.ReportDataBson, 0)
 	}
-	request := report.Request
 	completed := report.GetCompletedAtFormatted(cfgGlobal.TimeZone)
+	var current *reports_models.Progress
 	if strings.EqualFold(completed, "No ha finalizado") {
-		hash := request.Hash()
-		progress, _ := natsManager.GetValueBucket(BucketServicesProgress, hash)
-		completed = "En progreso: " + progress + "%"
+		if report.Status == reports_models.RunTimedOut {
+			completed = "Vencida sin terminar"
+		} else if report.ProviderCompletedAt != nil && report.Sir != nil {
+			completed = fmt.Sprintf("Escribiendo en SIR: %d/%d wrappers", report.Sir.AppliedWrappers+report.Sir.FailedWrappers, report.Sir.Wrappers)
+		} else {
+			progress, found, err := topology.Progress(natsManager).Get(report.ConciliatorId)
+			if err != nil {
+				utils.Error.Printf("[details] error al leer el progreso de %s: %v\n", id, err)
+			}
+			completed = "En progreso"
+			if found {
+				current = &progress
+			}
+		}
 	}
 	entries := &reports_models.ReportEntriesJsonResponse{
 		Inserted: 0,
@@ -167,10 +228,24 @@ func handlerDetailOperation(c fiber.Ctx) error {
 		CreatedAt:     report.GetCreatedAtFormatted(cfgGlobal.TimeZone),
 		StartedAt:     report.GetStartedAtFormatted(cfgGlobal.TimeZone),
 		CompletedAt:   completed,
+		Status:        report.Status,
+		StatusReason:  report.StatusReason,
+		StatusHistory: report.StatusHistory,
 		ElapsedTime:   report.GetElapsedTimeFormatted(),
 		Entries:       entries,
+		Sir:           report.Sir,
+		Rollback:      report.Rollback,
+		Progress:      current,
 		Request:       report.Request,
 		ReportData:    dataReports,
 	}
 	return c.Status(fiber.StatusOK).JSON(reportResponse)
 }
+
+// payload adapta un método del servicio al handler de Consume, el evento ya llega decodificado y con una
+// versión soportada.
+func payload[T any](handle func(T) error) func(messaging_nats.Envelope[T]) error {
+	return func(envelope messaging_nats.Envelope[T]) error {
+		return handle(envelope.Data)
+	}
+}
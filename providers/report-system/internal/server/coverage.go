@@ -0,0 +1,41 @@
+package server
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v3"
+	utils2 "lib-shared/utils"
+	"report-system/internal/models"
+)
+
+// handlerRunCoverage devuelve el resultado de cada local de la conciliación: ok, unreachable, auth_failed,
+// unmapped o empty.
+func handlerRunCoverage(c fiber.Ctx) error {
+	id := c.Params("id", "")
+	if utils2.IsEmptyString(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: "Debes especificar el id de la conciliación",
+		})
+	}
+	coverage, err := reportService.RunCoverage(id)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("Error al obtener la cobertura de la conciliación: %v", err),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(coverage)
+}
+
+// handlerCoverageMatrix devuelve la matriz de locales por día de un proveedor entre from y to.
+func handlerCoverageMatrix(c fiber.Ctx) error {
+	matrix, err := reportService.CoverageMatrix(models.CoverageQuery{
+		Provider: c.Query("provider"),
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("Error al obtener la cobertura: %v", err),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(matrix)
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v3"
+	"report-system/internal/models"
+)
+
+type ScanDuplicatesResponse struct {
+	Created int    `json:"created"`
+	Message string `json:"message"`
+}
+
+func duplicateQuery(c fiber.Ctx) models.DuplicateQuery {
+	return models.DuplicateQuery{
+		Provider: c.Query("provider"),
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+	}
+}
+
+// handlerDuplicates devuelve los pagos que están en más de un proveedor, filtrados por provider y rango de
+// días from/to.
+func handlerDuplicates(c fiber.Ctx) error {
+	duplicates, err := reportService.FindDuplicates(duplicateQuery(c))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("Error al obtener los pagos duplicados: %v", err),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(duplicates)
+}
+
+// handlerScanDuplicates busca los pagos duplicados de los días from/to sin esperar a una conciliación.
+func handlerScanDuplicates(c fiber.Ctx) error {
+	created, err := reportService.ScanDuplicates(duplicateQuery(c))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("Error al buscar los pagos duplicados: %v", err),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(ScanDuplicatesResponse{
+		Created: created,
+		Message: fmt.Sprintf("Se encontraron %d pagos duplicados nuevos", created),
+	})
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v3"
+	utils2 "lib-shared/utils"
+	"report-system/internal/models"
+)
+
+// handlerSearchPayments busca pagos en las colecciones fetch-* de todos los proveedores con los filtros del body.
+func handlerSearchPayments(c fiber.Ctx) error {
+	var search models.PaymentSearch
+	if err := c.Bind().Body(&search); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("El body de la búsqueda no es válido: %v", err),
+		})
+	}
+	return searchPayments(c, search)
+}
+
+// handlerPayment devuelve el pago con el uniqueId de la ruta, en cualquiera de los proveedores.
+func handlerPayment(c fiber.Ctx) error {
+	id := c.Params("id", "")
+	if utils2.IsEmptyString(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: "Debes especificar el uniqueId del pago",
+		})
+	}
+	return searchPayments(c, models.PaymentSearch{UniqueId: id})
+}
+
+func searchPayments(c fiber.Ctx, search models.PaymentSearch) error {
+	response, err := reportService.SearchPayments(search)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("Error al buscar los pagos: %v", err),
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"report-system/internal/app/archive"
+	db "report-system/internal/app/databases"
+	"report-system/internal/app/repository"
+	"report-system/internal/config"
+	"report-system/internal/service"
+	"report-system/utils"
+	"time"
+)
+
+// runRetention archiva los documentos vencidos cada interval hasta que se cancele ctx. Con varias
+// réplicas un lote puede quedar archivado dos veces, restaurarlo reemplaza por _id así que no se duplica.
+func runRetention(ctx context.Context, reportProvider *service.ReportService, store archive.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := reportProvider.ApplyRetention(store); err != nil {
+				utils.Error.Printf("[retention] %v\n", err)
+			}
+		}
+	}
+}
+
+// RunArchive aplica la retención una vez, para ejecutarla como CronJob en lugar de con RETENTION_INTERVAL.
+func RunArchive(cfg config.Config) error {
+	reportProvider, store, closeRepository, err := newRetention(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeRepository()
+	archived, err := reportProvider.ApplyRetention(store)
+	for collection, count := range archived {
+		utils.Info.Printf("[archive] %s: %d documentos archivados\n", collection, count)
+	}
+	return err
+}
+
+// RunRestore vuelve a cargar en Mongo los archivos cuyo nombre empieza con alguno de names.
+func RunRestore(cfg config.Config, names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("debes indicar los archivos o prefijos a restaurar, por ejemplo fetch-kioscos/")
+	}
+	reportProvider, store, closeRepository, err := newRetention(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeRepository()
+	restored, err := reportProvider.Restore(store, names)
+	utils.Info.Printf("[restore] %d documentos restaurados desde %s\n", restored, store.Location())
+	return err
+}
+
+func newRetention(cfg config.Config) (*service.ReportService, archive.Store, func(), error) {
+	store, err := archive.NewStore(cfg.Retention.Archive)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	mongoClient, err := db.NewMongoClient(cfg.Mongo.URI)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error creando el cliente de MongoDB: %v", err)
+	}
+	mongoRepository := repository.NewMongoDataRepository(mongoClient, cfg)
+	return service.NewApiProvider(mongoRepository, nil, cfg), store, mongoRepository.Close, nil
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v3"
+	"lib-shared/infrastructure/messaging_nats"
+	"lib-shared/reports_models"
+	"lib-shared/topology"
+	utils2 "lib-shared/utils"
+	"report-system/utils"
+	"time"
+)
+
+// cada cuánto se envía un comentario SSE si no hubo eventos, así los proxies no cierran la conexión inactiva
+const streamKeepAlive = 15 * time.Second
+
+// eventos de /details/:id/stream: progress, entry y status mientras el proveedor trabaja, completed al final o
+// status si la conciliación termina sin completarse
+const (
+	streamEventProgress  = "progress"
+	streamEventEntry     = "entry"
+	streamEventStatus    = "status"
+	streamEventCompleted = "completed"
+)
+
+type streamEvent struct {
+	name string
+	data any
+	// last cierra el stream después de enviar el evento
+	last bool
+}
+
+// streamCtx se cancela con SIGTERM para cerrar los streams abiertos, si no el servidor espera a que terminen.
+var streamCtx = context.Background()
+
+// handlerDetailStream envía como Server-Sent Events el progreso de la conciliación y los registros del reporte a
+// medida que llegan, y termina con el evento completed del proveedor.
+func handlerDetailStream(c fiber.Ctx) error {
+	id := c.Params("id", "")
+	if utils2.IsEmptyString(id) {
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: "Debes especificar el id de la transacción",
+		})
+	}
+	ctx, cancel := context.WithCancel(streamCtx)
+	events := make(chan streamEvent, 64)
+	push := func(event streamEvent) {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}
+	// primero las suscripciones y después el reporte, así no se pierde un completed que llegue en el medio
+	nc := natsManager.ManagerDataNats.GetClient()
+	entries, err := reports_models.AddReportEvent.Subscribe(nc, id, func(envelope messaging_nats.Envelope[reports_models.ReportData]) {
+		push(streamEvent{name: streamEventEntry, data: envelope.Data})
+	})
+	if err != nil {
+		cancel()
+		return c.Status(fiber.StatusServiceUnavailable).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("Error al suscribirse a los registros del reporte: %v", err),
+		})
+	}
+	completed, err := reports_models.CompletedReportEvent.Subscribe(nc, id, func(envelope messaging_nats.Envelope[reports_models.CompletedReport]) {
+		push(streamEvent{name: streamEventCompleted, data: envelope.Data, last: true})
+	})
+	if err != nil {
+		entries.Unsubscribe()
+		cancel()
+		return c.Status(fiber.StatusServiceUnavailable).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("Error al suscribirse a la finalización del reporte: %v", err),
+		})
+	}
+	status, err := reports_models.RunStatusReportEvent.Subscribe(nc, id, func(envelope messaging_nats.Envelope[reports_models.RunStatusReport]) {
+		// un proveedor que falla no envía completed, el stream termina con su estado
+		push(streamEvent{name: streamEventStatus, data: envelope.Data, last: envelope.Data.Status.Terminal()})
+	})
+	if err != nil {
+		entries.Unsubscribe()
+		completed.Unsubscribe()
+		cancel()
+		return c.Status(fiber.StatusServiceUnavailable).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("Error al suscribirse al estado del reporte: %v", err),
+		})
+	}
+	release := func() {
+		entries.Unsubscribe()
+		completed.Unsubscribe()
+		status.Unsubscribe()
+		cancel()
+	}
+	report, err := mongoDataRepository.FindById(id)
+	if err != nil || report == nil {
+		release()
+		return c.Status(fiber.StatusBadRequest).JSON(&ErrorResponse{
+			Error: fmt.Sprintf("No se encontró ningun detalle para este reporte: %v", err),
+		})
+	}
+	if report.ProviderCompletedAt != nil {
+		push(streamEvent{name: streamEventCompleted, data: completedFromReport(report), last: true})
+	} else if report.Status.Terminal() {
+		push(streamEvent{name: streamEventStatus, data: statusFromReport(report), last: true})
+	} else {
+		progress, err := topology.Progress(natsManager).Watch(ctx, id)
+		if err != nil {
+			utils.Error.Printf("[details-stream] no se puede observar el progreso de %s: %v\n", id, err)
+		} else {
+			go func() {
+				for value := range progress {
+					push(streamEvent{name: streamEventProgress, data: value})
+				}
+			}()
+		}
+	}
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		defer release()
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				if err := w.Flush(); err != nil {
+					return
+				}
+			case event := <-events:
+				if err := writeStreamEvent(w, event); err != nil {
+					// el cliente cerró la conexión
+					return
+				}
+				if event.last {
+					return
+				}
+			}
+		}
+	})
+}
+
+func writeStreamEvent(w *bufio.Writer, event streamEvent) error {
+	data, err := json.Marshal(event.data)
+	if err != nil {
+		utils.Error.Printf("[details-stream] no se puede serializar el evento %s: %v\n", event.name, err)
+		return nil
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, data)
+	return w.Flush()
+}
+
+// completedFromReport es el evento completed de una conciliación cuyo proveedor ya había terminado al abrir el stream.
+func completedFromReport(report *reports_models.ReportConciliator) reports_models.CompletedReport {
+	completed := reports_models.CompletedReport{
+		ConciliatorId: report.ConciliatorId,
+		CompletedAt:   *report.ProviderCompletedAt,
+		ElapsedTime:   uint32(report.ElapsedTime),
+	}
+	if report.Entries != nil {
+		completed.Entries = reports_models.EntriesCompletedReport{
+			Inserted: report.Entries.Inserted,
+			Updated:  report.Entries.Updated,
+			Ignored:  report.Entries.Ignored,
+		}
+	}
+	if report.Sir != nil {
+		completed.Wrappers = report.Sir.Wrappers
+		completed.PublishFailed = report.Sir.PublishFailed
+	}
+	return completed
+}
+
+// statusFromReport es el evento status de una conciliación que ya había terminado sin completarse al abrir el stream.
+func statusFromReport(report *reports_models.ReportConciliator) reports_models.RunStatusReport {
+	statusReport := reports_models.RunStatusReport{
+		ConciliatorId: report.ConciliatorId,
+		Status:        report.Status,
+		Reason:        report.StatusReason,
+	}
+	if report.StatusUpdatedAt != nil {
+		statusReport.At = *report.StatusUpdatedAt
+	}
+	return statusReport
+}
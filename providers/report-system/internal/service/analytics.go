@@ -0,0 +1,164 @@
+package service
+
+import (
+	"fmt"
+	lib_mapper "lib-shared/mapper"
+	"lib-shared/utils"
+	"math"
+	"report-system/internal/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// rango por defecto de las consultas de analítica si no se indica from
+	defaultAnalyticsDays = 30
+	// máximo de días que se recalculan en una sola petición de refresh
+	maxRefreshDays = 92
+)
+
+var analyticsDimensions = []string{"provider", "store", "cardGroup"}
+
+// refreshAnalytics recalcula los rollups del día y proveedor de la conciliación y busca anomalías por local y
+// pagos duplicados entre proveedores, se llama cuando la conciliación termina. Si falla solo se registra, el
+// siguiente refresh del mismo día lo corrige.
+func (provider *ReportService) refreshAnalytics(conciliatorId string) {
+	report, err := provider.mongoRepository.FindById(conciliatorId)
+	if err != nil || report == nil {
+		utils.Error.Printf("[analytics] no se encontró la conciliación %s para recalcular los rollups: %v\n", conciliatorId, err)
+		return
+	}
+	if err := provider.refreshDay(report.Request.Service, report.Request.Date, time.Now()); err != nil {
+		utils.Error.Printf("[analytics] %v\n", err)
+		return
+	}
+	// una conciliación fallida no trae pagos, todos sus locales saldrían como faltantes
+	if report.ProviderCompletedAt != nil {
+		provider.detectAnomalies(report)
+		provider.detectDuplicates(report)
+	}
+}
+
+// refreshDay recalcula los rollups de un servicio para un día, los pagos solo si el servicio los guarda en MongoDB.
+func (provider *ReportService) refreshDay(service, day string, refreshedAt time.Time) error {
+	service = strings.ToUpper(strings.TrimSpace(service))
+	paymentsProvider := lib_mapper.ProviderForService(service)
+	key := paymentsProvider
+	if key == "" {
+		key = service
+	}
+	if err := provider.mongoRepository.RefreshRunsRollup(service, key, day, refreshedAt); err != nil {
+		return err
+	}
+	if paymentsProvider == "" {
+		return nil
+	}
+	return provider.mongoRepository.RefreshPaymentsRollup(paymentsProvider, day, refreshedAt)
+}
+
+// RefreshAnalytics recalcula los rollups de los días de query para su proveedor o para todos, sirve para cargar
+// los días conciliados antes de que existieran los rollups.
+func (provider *ReportService) RefreshAnalytics(query models.AnalyticsQuery) (int, error) {
+	if err := normalizeAnalyticsQuery(&query); err != nil {
+		return 0, err
+	}
+	from, _ := time.Parse("2006-01-02", query.From)
+	to, _ := time.Parse("2006-01-02", query.To)
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxRefreshDays {
+		return 0, fmt.Errorf("se pueden recalcular hasta %d días por petición, se pidieron %d", maxRefreshDays, days)
+	}
+	providers := lib_mapper.Providers()
+	if query.Provider != "" {
+		providers = []string{query.Provider}
+	}
+	refreshedAt := time.Now()
+	refreshed := 0
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		for _, paymentsProvider := range providers {
+			service := lib_mapper.ServiceForProvider(paymentsProvider)
+			if service == "" {
+				// el proveedor no se concilia desde api-central, solo tiene rollups de pagos
+				if err := provider.mongoRepository.RefreshPaymentsRollup(paymentsProvider, day.Format("2006-01-02"), refreshedAt); err != nil {
+					return refreshed, err
+				}
+				continue
+			}
+			if err := provider.refreshDay(service, day.Format("2006-01-02"), refreshedAt); err != nil {
+				return refreshed, err
+			}
+		}
+		refreshed++
+	}
+	utils.Info.Printf("[analytics] rollups recalculados del %s al %s\n", query.From, query.To)
+	return refreshed, nil
+}
+
+func (provider *ReportService) PaymentsAnalytics(query models.AnalyticsQuery) ([]models.PaymentsAnalytics, error) {
+	if err := normalizeAnalyticsQuery(&query); err != nil {
+		return nil, err
+	}
+	return provider.mongoRepository.PaymentsAnalytics(query)
+}
+
+// RunsAnalytics devuelve las conciliaciones por periodo y proveedor con su tasa de error y duración promedio.
+func (provider *ReportService) RunsAnalytics(query models.AnalyticsQuery) ([]models.RunsAnalytics, error) {
+	if err := normalizeAnalyticsQuery(&query); err != nil {
+		return nil, err
+	}
+	analytics, err := provider.mongoRepository.RunsAnalytics(query)
+	if err != nil {
+		return nil, err
+	}
+	for i, row := range analytics {
+		if row.Runs > 0 {
+			withErrors := row.CompletedWithErrors + row.Failed + row.TimedOut
+			analytics[i].ErrorRate = math.Round(float64(withErrors)/float64(row.Runs)*10000) / 10000
+		}
+		if row.ElapsedRuns > 0 {
+			analytics[i].AvgElapsedSeconds = math.Round(float64(row.ElapsedTotal)/float64(row.ElapsedRuns)*100) / 100
+		}
+	}
+	return analytics, nil
+}
+
+// normalizeAnalyticsQuery valida los filtros y completa los valores por defecto: periodo day, agrupado por
+// proveedor y los últimos defaultAnalyticsDays días.
+func normalizeAnalyticsQuery(query *models.AnalyticsQuery) error {
+	query.Period = strings.ToLower(strings.TrimSpace(query.Period))
+	if query.Period == "" {
+		query.Period = "day"
+	}
+	if query.Period != "day" && query.Period != "month" {
+		return fmt.Errorf("period debe ser day o month")
+	}
+	if len(query.GroupBy) == 0 {
+		query.GroupBy = []string{"provider"}
+	}
+	for _, dimension := range query.GroupBy {
+		if !slices.Contains(analyticsDimensions, dimension) {
+			return fmt.Errorf("groupBy %s desconocido, usa %v", dimension, analyticsDimensions)
+		}
+	}
+	query.Provider = strings.ToUpper(strings.TrimSpace(query.Provider))
+	if query.Provider != "" && lib_mapper.CollectionName(query.Provider) == "" {
+		return fmt.Errorf("proveedor %s desconocido, usa uno de %v", query.Provider, lib_mapper.Providers())
+	}
+	if query.To == "" {
+		query.To = time.Now().Format("2006-01-02")
+	}
+	to, err := time.Parse("2006-01-02", query.To)
+	if err != nil {
+		return fmt.Errorf("la fecha %s no tiene el formato AAAA-MM-DD", query.To)
+	}
+	if query.From == "" {
+		query.From = to.AddDate(0, 0, -defaultAnalyticsDays).Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", query.From); err != nil {
+		return fmt.Errorf("la fecha %s no tiene el formato AAAA-MM-DD", query.From)
+	}
+	if query.From > query.To {
+		return fmt.Errorf("from %s es posterior a to %s", query.From, query.To)
+	}
+	return nil
+}
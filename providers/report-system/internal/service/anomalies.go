@@ -0,0 +1,182 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	lib_mapper "lib-shared/mapper"
+	"lib-shared/reports_models"
+	"lib-shared/utils"
+	"report-system/internal/config"
+	"report-system/internal/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+// detectAnomalies compara cada local del día de la conciliación contra el mismo día de la semana de las semanas
+// anteriores y agrega al reporte una entrada WARNING por cada anomalía nueva. Usa los rollups de pagos, que ya
+// se recalcularon para el día.
+func (provider *ReportService) detectAnomalies(report *reports_models.ReportConciliator) {
+	paymentsProvider := lib_mapper.ProviderForService(report.Request.Service)
+	if paymentsProvider == "" {
+		return
+	}
+	day, err := time.Parse("2006-01-02", report.Request.Date)
+	if err != nil {
+		utils.Error.Printf("[anomalies] la fecha %s de la conciliación %s no es válida: %v\n", report.Request.Date, report.ConciliatorId, err)
+		return
+	}
+	days := []string{report.Request.Date}
+	for week := 1; week <= provider.cfg.Anomalies.Weeks; week++ {
+		days = append(days, day.AddDate(0, 0, -7*week).Format("2006-01-02"))
+	}
+	totals, err := provider.mongoRepository.StoreTotals(paymentsProvider, days)
+	if err != nil {
+		utils.Error.Printf("[anomalies] %v\n", err)
+		return
+	}
+	current := make(map[string]models.StoreTotals)
+	history := make(map[string][]models.StoreTotals)
+	for _, total := range totals {
+		if total.Day == report.Request.Date {
+			current[total.StoreId] = total
+		} else {
+			history[total.StoreId] = append(history[total.StoreId], total)
+		}
+	}
+	anomalies := storeAnomalies(current, history, provider.cfg.Anomalies)
+	created := 0
+	for _, anomaly := range anomalies {
+		anomaly.ConciliatorId = report.ConciliatorId
+		anomaly.Provider = paymentsProvider
+		anomaly.Day = report.Request.Date
+		anomaly.CreatedAt = time.Now()
+		inserted, err := provider.mongoRepository.SaveAnomaly(anomaly)
+		if err != nil {
+			utils.Error.Printf("[anomalies] no se pudo guardar la anomalía %s del local %s: %v\n", anomaly.Kind, anomaly.StoreId, err)
+			continue
+		}
+		if !inserted {
+			continue
+		}
+		created++
+		provider.addEntry(reports_models.ReportData{
+			ConciliatorId: report.ConciliatorId,
+			Type:          "WARNING",
+			Message:       anomalyMessage(anomaly),
+			Metadata: reports_models.Metadata{
+				Content: anomaly,
+			},
+			CreatedAt: anomaly.CreatedAt,
+		})
+	}
+	if created > 0 {
+		utils.Warning.Printf("[anomalies] %d anomalías en los locales de %s del %s\n", created, paymentsProvider, report.Request.Date)
+	}
+}
+
+// storeAnomalies evalúa los locales con al menos cfg.MinHistory semanas con pagos y una mediana de al menos
+// cfg.MinCount pagos. Un local que no aparece en el historial es nuevo y no se evalúa.
+func storeAnomalies(current map[string]models.StoreTotals, history map[string][]models.StoreTotals, cfg config.AnomaliesConfig) []models.Anomaly {
+	anomalies := make([]models.Anomaly, 0)
+	for storeId, past := range history {
+		if len(past) < max(cfg.MinHistory, 1) {
+			continue
+		}
+		counts := make([]float64, 0, len(past))
+		amounts := make([]float64, 0, len(past))
+		for _, total := range past {
+			counts = append(counts, float64(total.Count))
+			amounts = append(amounts, total.Amount)
+		}
+		expectedCount := median(counts)
+		expectedAmount := median(amounts)
+		if expectedCount < float64(cfg.MinCount) {
+			continue
+		}
+		anomaly := models.Anomaly{
+			StoreId:        storeId,
+			ExpectedCount:  expectedCount,
+			ExpectedAmount: expectedAmount,
+			History:        len(past),
+		}
+		today, found := current[storeId]
+		if !found {
+			anomaly.Kind = models.AnomalyMissingStore
+			anomalies = append(anomalies, anomaly)
+			continue
+		}
+		anomaly.Count = today.Count
+		anomaly.Amount = today.Amount
+		if kind := outlier(float64(today.Count), expectedCount, cfg.Ratio, models.AnomalyLowCount, models.AnomalyHighCount); kind != "" {
+			anomaly.Kind = kind
+			anomalies = append(anomalies, anomaly)
+		}
+		if kind := outlier(today.Amount, expectedAmount, cfg.Ratio, models.AnomalyLowAmount, models.AnomalyHighAmount); kind != "" {
+			anomaly.Kind = kind
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+	slices.SortFunc(anomalies, func(a, b models.Anomaly) int {
+		return cmp.Or(cmp.Compare(a.StoreId, b.StoreId), cmp.Compare(a.Kind, b.Kind))
+	})
+	return anomalies
+}
+
+// outlier devuelve low si value queda por debajo de ratio veces lo esperado, high si queda por encima de
+// 1/ratio veces, o vacío.
+func outlier(value, expected, ratio float64, low, high string) string {
+	if ratio <= 0 || ratio >= 1 {
+		return ""
+	}
+	switch {
+	case value < expected*ratio:
+		return low
+	case value > expected/ratio:
+		return high
+	}
+	return ""
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+func anomalyMessage(anomaly models.Anomaly) string {
+	weeks := fmt.Sprintf("el mismo día de la semana en %d semanas anteriores", anomaly.History)
+	switch anomaly.Kind {
+	case models.AnomalyMissingStore:
+		return fmt.Sprintf("El local %s no tiene pagos el %s y %s tuvo una mediana de %.0f, revisar si su servidor está caído",
+			anomaly.StoreId, anomaly.Day, weeks, anomaly.ExpectedCount)
+	case models.AnomalyLowCount, models.AnomalyHighCount:
+		return fmt.Sprintf("El local %s tiene %d pagos el %s, %s tuvo una mediana de %.0f",
+			anomaly.StoreId, anomaly.Count, anomaly.Day, weeks, anomaly.ExpectedCount)
+	default:
+		return fmt.Sprintf("El local %s tiene un monto de %.2f el %s, %s tuvo una mediana de %.2f",
+			anomaly.StoreId, anomaly.Amount, anomaly.Day, weeks, anomaly.ExpectedAmount)
+	}
+}
+
+// FindAnomalies devuelve las anomalías detectadas que cumplen los filtros.
+func (provider *ReportService) FindAnomalies(query models.AnomalyQuery) ([]models.Anomaly, error) {
+	query.Provider = strings.ToUpper(strings.TrimSpace(query.Provider))
+	query.Kind = strings.ToUpper(strings.TrimSpace(query.Kind))
+	for _, date := range []string{query.From, query.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return nil, fmt.Errorf("la fecha %s no tiene el formato AAAA-MM-DD", date)
+		}
+	}
+	return provider.mongoRepository.FindAnomalies(query)
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"report-system/internal/config"
+	"report-system/internal/models"
+	"testing"
+)
+
+var testAnomaliesConfig = config.AnomaliesConfig{Weeks: 4, MinHistory: 3, Ratio: 0.5, MinCount: 10}
+
+func weeks(values ...[2]float64) []models.StoreTotals {
+	totals := make([]models.StoreTotals, 0, len(values))
+	for _, value := range values {
+		totals = append(totals, models.StoreTotals{Count: int(value[0]), Amount: value[1]})
+	}
+	return totals
+}
+
+func anomalyKinds(anomalies []models.Anomaly) []string {
+	kinds := make([]string, 0, len(anomalies))
+	for _, anomaly := range anomalies {
+		kinds = append(kinds, anomaly.StoreId+":"+anomaly.Kind)
+	}
+	return kinds
+}
+
+func TestStoreAnomalies(t *testing.T) {
+	history := map[string][]models.StoreTotals{
+		"K001": weeks([2]float64{100, 1000}, [2]float64{110, 1100}, [2]float64{90, 900}),
+		"K002": weeks([2]float64{100, 1000}, [2]float64{100, 1000}, [2]float64{100, 1000}),
+		"K003": weeks([2]float64{100, 1000}, [2]float64{100, 1000}, [2]float64{100, 1000}),
+		"K004": weeks([2]float64{100, 1000}, [2]float64{100, 1000}, [2]float64{100, 1000}),
+		// sin historial suficiente
+		"K005": weeks([2]float64{100, 1000}, [2]float64{100, 1000}),
+		// muy pocos pagos para evaluar
+		"K006": weeks([2]float64{5, 50}, [2]float64{4, 40}, [2]float64{6, 60}),
+	}
+	current := map[string]models.StoreTotals{
+		"K001": {StoreId: "K001", Count: 95, Amount: 980},
+		"K002": {StoreId: "K002", Count: 40, Amount: 400},
+		"K004": {StoreId: "K004", Count: 100, Amount: 2500},
+		"K006": {StoreId: "K006", Count: 0, Amount: 0},
+		// local nuevo, no tiene historial
+		"K007": {StoreId: "K007", Count: 1, Amount: 1},
+	}
+	anomalies := storeAnomalies(current, history, testAnomaliesConfig)
+	expected := []string{
+		"K002:" + models.AnomalyLowAmount,
+		"K002:" + models.AnomalyLowCount,
+		"K003:" + models.AnomalyMissingStore,
+		"K004:" + models.AnomalyHighAmount,
+	}
+	got := anomalyKinds(anomalies)
+	if len(got) != len(expected) {
+		t.Fatalf("se esperaban %v, se obtuvo %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("se esperaban %v, se obtuvo %v", expected, got)
+		}
+	}
+	missing := anomalies[2]
+	if missing.ExpectedCount != 100 || missing.History != 3 || missing.Count != 0 {
+		t.Fatalf("la anomalía del local sin pagos no guarda lo esperado: %+v", missing)
+	}
+}
+
+func TestStoreAnomaliesUsesMedian(t *testing.T) {
+	// una semana atípica no mueve la mediana
+	history := map[string][]models.StoreTotals{
+		"K001": weeks([2]float64{100, 1000}, [2]float64{1000, 10000}, [2]float64{100, 1000}, [2]float64{90, 900}),
+	}
+	current := map[string]models.StoreTotals{"K001": {StoreId: "K001", Count: 100, Amount: 1000}}
+	if anomalies := storeAnomalies(current, history, testAnomaliesConfig); len(anomalies) != 0 {
+		t.Fatalf("el día está en la mediana y no es una anomalía: %v", anomalyKinds(anomalies))
+	}
+}
+
+func TestStoreAnomaliesInvalidRatio(t *testing.T) {
+	history := map[string][]models.StoreTotals{
+		"K001": weeks([2]float64{100, 1000}, [2]float64{100, 1000}, [2]float64{100, 1000}),
+	}
+	current := map[string]models.StoreTotals{"K001": {StoreId: "K001", Count: 1, Amount: 1}}
+	cfg := testAnomaliesConfig
+	cfg.Ratio = 0
+	// sin un ratio válido solo se informan los locales sin pagos
+	if anomalies := storeAnomalies(current, history, cfg); len(anomalies) != 0 {
+		t.Fatalf("con ratio 0 no se comparan los totales: %v", anomalyKinds(anomalies))
+	}
+}
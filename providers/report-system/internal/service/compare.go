@@ -0,0 +1,168 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	lib_mapper "lib-shared/mapper"
+	"lib-shared/reports_models"
+	"report-system/internal/models"
+	"slices"
+)
+
+// CompareRuns compara la conciliación target contra base, las dos tienen que ser de la misma solicitud (servicio
+// y fecha). Los pagos salen de las corridas guardadas en la colección fetch-* del proveedor, una conciliación que
+// ya no está entre las últimas lib_mapper.MaxPaymentRuns de sus pagos no se puede comparar.
+func (provider *ReportService) CompareRuns(base, target string) (*models.RunComparison, error) {
+	baseReport, err := provider.findReport(base)
+	if err != nil {
+		return nil, err
+	}
+	targetReport, err := provider.findReport(target)
+	if err != nil {
+		return nil, err
+	}
+	if baseReport.Request.Hash() != targetReport.Request.Hash() {
+		return nil, fmt.Errorf("las conciliaciones no son de la misma solicitud: %s %s y %s %s",
+			baseReport.Request.Service, baseReport.Request.Date, targetReport.Request.Service, targetReport.Request.Date)
+	}
+	paymentsProvider := lib_mapper.ProviderForService(baseReport.Request.Service)
+	if paymentsProvider == "" {
+		return nil, fmt.Errorf("el servicio %s no guarda pagos para comparar", baseReport.Request.Service)
+	}
+	payments, err := provider.mongoRepository.FindPaymentRuns(paymentsProvider, base, target)
+	if err != nil {
+		return nil, err
+	}
+	for _, report := range []*reports_models.ReportConciliator{baseReport, targetReport} {
+		if err := checkPaymentRuns(report, payments); err != nil {
+			return nil, err
+		}
+	}
+	comparison := &models.RunComparison{
+		Base:     base,
+		Target:   target,
+		Request:  baseReport.Request,
+		Payments: comparePayments(payments, base, target),
+	}
+	baseErrors, err := provider.errorMessages(base)
+	if err != nil {
+		return nil, err
+	}
+	targetErrors, err := provider.errorMessages(target)
+	if err != nil {
+		return nil, err
+	}
+	comparison.Errors = compareErrors(baseErrors, targetErrors)
+	return comparison, nil
+}
+
+func (provider *ReportService) findReport(conciliatorId string) (*reports_models.ReportConciliator, error) {
+	report, err := provider.mongoRepository.FindById(conciliatorId)
+	if err != nil {
+		return nil, err
+	}
+	if report == nil {
+		return nil, fmt.Errorf("no existe la conciliación %s", conciliatorId)
+	}
+	return report, nil
+}
+
+// errorMessages son los mensajes de las entradas ERROR del reporte de la conciliación.
+func (provider *ReportService) errorMessages(conciliatorId string) ([]string, error) {
+	dataReports, err := provider.mongoRepository.FindDataById(conciliatorId)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]string, 0)
+	for _, dataReport := range dataReports {
+		if dataReport.Type == "ERROR" {
+			messages = append(messages, dataReport.Message)
+		}
+	}
+	return messages, nil
+}
+
+// checkPaymentRuns evita informar todos los pagos como agregados o eliminados cuando la conciliación procesó
+// pagos pero ninguno tiene su corrida guardada.
+func checkPaymentRuns(report *reports_models.ReportConciliator, payments []lib_mapper.Payment) error {
+	if report.Entries == nil || report.Entries.Inserted+report.Entries.Updated+report.Entries.Ignored == 0 {
+		return nil
+	}
+	for _, payment := range payments {
+		if _, found := lastRun(payment.Runs, report.ConciliatorId); found {
+			return nil
+		}
+	}
+	return fmt.Errorf("la conciliación %s no tiene pagos guardados para comparar, es anterior a la comparación de conciliaciones o ya no está entre las últimas %d de sus pagos",
+		report.ConciliatorId, lib_mapper.MaxPaymentRuns)
+}
+
+func comparePayments(payments []lib_mapper.Payment, base, target string) models.PaymentsComparison {
+	comparison := models.PaymentsComparison{
+		Added:   make([]models.PaymentSnapshot, 0),
+		Removed: make([]models.PaymentSnapshot, 0),
+		Changed: make([]models.PaymentChange, 0),
+	}
+	for _, payment := range payments {
+		baseRun, inBase := lastRun(payment.Runs, base)
+		targetRun, inTarget := lastRun(payment.Runs, target)
+		switch {
+		case inBase && inTarget:
+			fields := baseRun.Output.Diff(targetRun.Output)
+			if len(fields) == 0 {
+				comparison.Unchanged++
+				continue
+			}
+			comparison.Changed = append(comparison.Changed, models.PaymentChange{UniqueId: payment.UniqueId, StoreId: payment.StoreId, Fields: fields})
+		case inTarget:
+			comparison.Added = append(comparison.Added, models.PaymentSnapshot{UniqueId: payment.UniqueId, StoreId: payment.StoreId, Output: targetRun.Output})
+		case inBase:
+			comparison.Removed = append(comparison.Removed, models.PaymentSnapshot{UniqueId: payment.UniqueId, StoreId: payment.StoreId, Output: baseRun.Output})
+		}
+	}
+	bySnapshot := func(a, b models.PaymentSnapshot) int {
+		return cmp.Or(cmp.Compare(a.StoreId, b.StoreId), cmp.Compare(a.UniqueId, b.UniqueId))
+	}
+	slices.SortFunc(comparison.Added, bySnapshot)
+	slices.SortFunc(comparison.Removed, bySnapshot)
+	slices.SortFunc(comparison.Changed, func(a, b models.PaymentChange) int {
+		return cmp.Or(cmp.Compare(a.StoreId, b.StoreId), cmp.Compare(a.UniqueId, b.UniqueId))
+	})
+	return comparison
+}
+
+// lastRun es la última corrida de la conciliación, una redelivery del mismo batch la agrega dos veces.
+func lastRun(runs []lib_mapper.PaymentRun, conciliatorId string) (lib_mapper.PaymentRun, bool) {
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].ConciliatorId == conciliatorId {
+			return runs[i], true
+		}
+	}
+	return lib_mapper.PaymentRun{}, false
+}
+
+func compareErrors(base, target []string) models.ErrorsComparison {
+	comparison := models.ErrorsComparison{
+		Added:   make([]string, 0),
+		Removed: make([]string, 0),
+	}
+	pending := make(map[string]int)
+	for _, message := range base {
+		pending[message]++
+	}
+	for _, message := range target {
+		if pending[message] > 0 {
+			pending[message]--
+			comparison.Unchanged++
+			continue
+		}
+		comparison.Added = append(comparison.Added, message)
+	}
+	for _, message := range base {
+		if pending[message] > 0 {
+			pending[message]--
+			comparison.Removed = append(comparison.Removed, message)
+		}
+	}
+	return comparison
+}
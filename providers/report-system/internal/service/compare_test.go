@@ -0,0 +1,30 @@
+package service
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompareErrors(t *testing.T) {
+	base := []string{"local K001 sin respuesta", "pago duplicado", "pago duplicado", "token vencido"}
+	target := []string{"pago duplicado", "local K002 sin respuesta", "token vencido", "token vencido"}
+	comparison := compareErrors(base, target)
+	// los mensajes repetidos se cuentan por ocurrencia
+	if comparison.Unchanged != 2 {
+		t.Fatalf("se esperaban 2 errores sin cambios, hay %d", comparison.Unchanged)
+	}
+	if !slices.Equal(comparison.Added, []string{"local K002 sin respuesta", "token vencido"}) {
+		t.Fatalf("errores agregados inesperados: %v", comparison.Added)
+	}
+	if !slices.Equal(comparison.Removed, []string{"local K001 sin respuesta", "pago duplicado"}) {
+		t.Fatalf("errores quitados inesperados: %v", comparison.Removed)
+	}
+}
+
+func TestCompareErrorsEmpty(t *testing.T) {
+	comparison := compareErrors(nil, nil)
+	// se serializan como arreglos vacíos, no null
+	if comparison.Added == nil || comparison.Removed == nil || comparison.Unchanged != 0 {
+		t.Fatalf("la comparación vacía no es la esperada: %+v", comparison)
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"fmt"
+	lib_mapper "lib-shared/mapper"
+	"lib-shared/reports_models"
+	"report-system/internal/models"
+	"time"
+)
+
+// máximo de días de la matriz de cobertura por rango
+const maxCoverageDays = 92
+
+// StoreOutcome guarda el resultado de un local con el día de su conciliación. Si el reporte todavía no existe
+// devuelve error para que se vuelva a entregar.
+func (provider *ReportService) StoreOutcome(outcome reports_models.StoreOutcome) error {
+	report, err := provider.mongoRepository.FindById(outcome.ConciliatorId)
+	if err != nil {
+		return err
+	}
+	if report == nil {
+		return fmt.Errorf("el reporte %s todavía no existe para guardar el local %s", outcome.ConciliatorId, outcome.StoreId)
+	}
+	coverage := models.StoreCoverage{StoreOutcome: outcome, Day: report.Request.Date}
+	if err := provider.mongoRepository.SaveStoreOutcome(coverage); err != nil {
+		return fmt.Errorf("save store outcome error: %w", err)
+	}
+	return nil
+}
+
+// RunCoverage devuelve el resultado de cada local de la conciliación.
+func (provider *ReportService) RunCoverage(conciliatorId string) (*models.RunCoverage, error) {
+	report, err := provider.findReport(conciliatorId)
+	if err != nil {
+		return nil, err
+	}
+	stores, err := provider.mongoRepository.FindStoreOutcomes(conciliatorId)
+	if err != nil {
+		return nil, err
+	}
+	coverage := &models.RunCoverage{
+		ConciliatorId: conciliatorId,
+		Provider:      lib_mapper.ProviderForService(report.Request.Service),
+		Day:           report.Request.Date,
+		Summary:       make(map[reports_models.StoreStatus]int),
+		Stores:        stores,
+	}
+	for _, store := range stores {
+		coverage.Summary[store.Status]++
+	}
+	return coverage, nil
+}
+
+// CoverageMatrix arma la matriz de locales por día del proveedor en el rango de query.
+func (provider *ReportService) CoverageMatrix(query models.CoverageQuery) (*models.CoverageMatrix, error) {
+	analyticsQuery := models.AnalyticsQuery{Provider: query.Provider, From: query.From, To: query.To}
+	if err := normalizeAnalyticsQuery(&analyticsQuery); err != nil {
+		return nil, err
+	}
+	if analyticsQuery.Provider == "" {
+		return nil, fmt.Errorf("debes especificar el proveedor")
+	}
+	query = models.CoverageQuery{Provider: analyticsQuery.Provider, From: analyticsQuery.From, To: analyticsQuery.To}
+	from, _ := time.Parse("2006-01-02", query.From)
+	to, _ := time.Parse("2006-01-02", query.To)
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxCoverageDays {
+		return nil, fmt.Errorf("la cobertura se puede consultar hasta %d días, se pidieron %d", maxCoverageDays, days)
+	}
+	matrix := &models.CoverageMatrix{
+		Provider: query.Provider,
+		From:     query.From,
+		To:       query.To,
+		Days:     make([]string, 0),
+		Summary:  make(map[string]map[reports_models.StoreStatus]int),
+		Stores:   make([]models.StoreCoverageRow, 0),
+	}
+	columns := make(map[string]int)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		columns[day.Format("2006-01-02")] = len(matrix.Days)
+		matrix.Days = append(matrix.Days, day.Format("2006-01-02"))
+		matrix.Summary[day.Format("2006-01-02")] = make(map[reports_models.StoreStatus]int)
+	}
+	outcomes, err := provider.mongoRepository.LatestStoreOutcomes(query)
+	if err != nil {
+		return nil, err
+	}
+	// los resultados vienen ordenados por local, cada local es una fila
+	for _, outcome := range outcomes {
+		last := len(matrix.Stores) - 1
+		if last < 0 || matrix.Stores[last].StoreId != outcome.StoreId {
+			matrix.Stores = append(matrix.Stores, models.StoreCoverageRow{
+				StoreId: outcome.StoreId,
+				Summary: make(map[reports_models.StoreStatus]int),
+				Cells:   make([]*models.CoverageCell, len(matrix.Days)),
+			})
+			last++
+		}
+		row := &matrix.Stores[last]
+		if outcome.MerchantId != "" {
+			row.MerchantId = outcome.MerchantId
+		}
+		row.Summary[outcome.Status]++
+		row.Cells[columns[outcome.Day]] = &models.CoverageCell{
+			Status:        outcome.Status,
+			ConciliatorId: outcome.ConciliatorId,
+			Received:      outcome.Received,
+			Reason:        outcome.Reason,
+		}
+		matrix.Summary[outcome.Day][outcome.Status]++
+	}
+	return matrix, nil
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	lib_mapper "lib-shared/mapper"
+	"lib-shared/reports_models"
+	"lib-shared/utils"
+	"report-system/internal/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+// detectDuplicates busca los pagos del día de la conciliación que están en más de un proveedor y agrega al
+// reporte una entrada WARNING por cada duplicado nuevo en el que participa el proveedor de la conciliación.
+func (provider *ReportService) detectDuplicates(report *reports_models.ReportConciliator) {
+	paymentsProvider := lib_mapper.ProviderForService(report.Request.Service)
+	if paymentsProvider == "" {
+		return
+	}
+	created, err := provider.scanDuplicates(report.Request.Date, report.ConciliatorId, time.Now())
+	if err != nil {
+		utils.Error.Printf("[duplicates] %v\n", err)
+		return
+	}
+	reported := 0
+	for _, duplicate := range created {
+		if !slices.Contains(duplicate.Providers, paymentsProvider) {
+			continue
+		}
+		reported++
+		provider.addEntry(reports_models.ReportData{
+			ConciliatorId: report.ConciliatorId,
+			Type:          "WARNING",
+			Message:       duplicateMessage(duplicate),
+			Metadata: reports_models.Metadata{
+				Content: duplicate,
+			},
+			CreatedAt: duplicate.DetectedAt,
+		})
+	}
+	if reported > 0 {
+		utils.Warning.Printf("[duplicates] %d pagos de %s del %s están en otro proveedor\n", reported, paymentsProvider, report.Request.Date)
+	}
+}
+
+// ScanDuplicates busca los pagos duplicados entre proveedores de los días de query, sirve para los días
+// conciliados antes de la detección. Devuelve la cantidad de duplicados nuevos.
+func (provider *ReportService) ScanDuplicates(query models.DuplicateQuery) (int, error) {
+	if err := normalizeDuplicateQuery(&query); err != nil {
+		return 0, err
+	}
+	from, _ := time.Parse("2006-01-02", query.From)
+	to, _ := time.Parse("2006-01-02", query.To)
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxRefreshDays {
+		return 0, fmt.Errorf("se pueden revisar hasta %d días por petición, se pidieron %d", maxRefreshDays, days)
+	}
+	at := time.Now()
+	created := 0
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		duplicates, err := provider.scanDuplicates(day.Format("2006-01-02"), "", at)
+		if err != nil {
+			return created, err
+		}
+		created += len(duplicates)
+	}
+	utils.Info.Printf("[duplicates] %d pagos duplicados nuevos del %s al %s\n", created, query.From, query.To)
+	return created, nil
+}
+
+func (provider *ReportService) FindDuplicates(query models.DuplicateQuery) ([]models.CrossDuplicate, error) {
+	if err := normalizeDuplicateQuery(&query); err != nil {
+		return nil, err
+	}
+	return provider.mongoRepository.FindDuplicates(query)
+}
+
+// scanDuplicates guarda los duplicados del día y devuelve los que no estaban guardados.
+func (provider *ReportService) scanDuplicates(day, conciliatorId string, at time.Time) ([]models.CrossDuplicate, error) {
+	candidates, err := provider.mongoRepository.DuplicateCandidates(day)
+	if err != nil {
+		return nil, err
+	}
+	created := make([]models.CrossDuplicate, 0)
+	for _, duplicate := range crossDuplicates(candidates) {
+		duplicate.Day = day
+		duplicate.ConciliatorId = conciliatorId
+		duplicate.DetectedAt = at
+		duplicate.UpdatedAt = at
+		inserted, err := provider.mongoRepository.SaveDuplicate(duplicate)
+		if err != nil {
+			return created, fmt.Errorf("no se pudo guardar el pago duplicado %s del %s: %v", duplicate.Key, day, err)
+		}
+		if inserted {
+			created = append(created, duplicate)
+		}
+	}
+	return created, nil
+}
+
+// crossDuplicates agrupa los candidatos por DuplicateKey y deja las claves con pagos de más de un proveedor.
+// Dos pagos del mismo proveedor con la misma clave no son un duplicado entre proveedores.
+func crossDuplicates(candidates []models.PaymentData) []models.CrossDuplicate {
+	byKey := make(map[string]*models.CrossDuplicate)
+	for _, candidate := range candidates {
+		key := candidate.Data.Output.DuplicateKey()
+		if key == "" {
+			continue
+		}
+		duplicate, found := byKey[key]
+		if !found {
+			// la clave ya tiene los campos normalizados: fecha|merchantId|autorización|referencia|monto
+			parts := strings.Split(key, "|")
+			duplicate = &models.CrossDuplicate{
+				Key:           key,
+				MerchantId:    parts[1],
+				Authorization: parts[2],
+				Reference:     parts[3],
+				Amount:        parts[4],
+				Providers:     make([]string, 0),
+				Payments:      make([]models.DuplicatePayment, 0),
+			}
+			byKey[key] = duplicate
+		}
+		if !slices.Contains(duplicate.Providers, candidate.Provider) {
+			duplicate.Providers = append(duplicate.Providers, candidate.Provider)
+		}
+		duplicate.Payments = append(duplicate.Payments, models.DuplicatePayment{
+			Provider:      candidate.Provider,
+			UniqueId:      candidate.UniqueId,
+			StoreId:       candidate.StoreId,
+			ConciliatorId: candidate.ConciliatorId,
+			Time:          candidate.Data.Output.HoraTransaccion,
+			SyncStatus:    candidate.SyncStatus,
+			Written:       lib_mapper.ConfirmedHash(candidate.Hash, candidate.SirHash, candidate.SyncStatus) != "",
+		})
+	}
+	duplicates := make([]models.CrossDuplicate, 0)
+	for _, duplicate := range byKey {
+		if len(duplicate.Providers) < 2 {
+			continue
+		}
+		slices.Sort(duplicate.Providers)
+		slices.SortFunc(duplicate.Payments, func(a, b models.DuplicatePayment) int {
+			return cmp.Or(cmp.Compare(a.Provider, b.Provider), cmp.Compare(a.UniqueId, b.UniqueId))
+		})
+		duplicates = append(duplicates, *duplicate)
+	}
+	slices.SortFunc(duplicates, func(a, b models.CrossDuplicate) int {
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return duplicates
+}
+
+func duplicateMessage(duplicate models.CrossDuplicate) string {
+	written := make([]string, 0)
+	for _, payment := range duplicate.Payments {
+		if payment.Written {
+			written = append(written, payment.Provider)
+		}
+	}
+	message := fmt.Sprintf("el pago con autorización %s, referencia %s y monto %s del merchantId %s está en %s",
+		duplicate.Authorization, duplicate.Reference, duplicate.Amount, duplicate.MerchantId, strings.Join(duplicate.Providers, " y "))
+	if len(written) > 1 {
+		message += fmt.Sprintf(", escrito en SIR por %s", strings.Join(written, " y "))
+	}
+	return message
+}
+
+// normalizeDuplicateQuery valida el proveedor y completa el rango de días como la analítica.
+func normalizeDuplicateQuery(query *models.DuplicateQuery) error {
+	analyticsQuery := models.AnalyticsQuery{Provider: query.Provider, From: query.From, To: query.To}
+	if err := normalizeAnalyticsQuery(&analyticsQuery); err != nil {
+		return err
+	}
+	*query = models.DuplicateQuery{Provider: analyticsQuery.Provider, From: analyticsQuery.From, To: analyticsQuery.To}
+	return nil
+}
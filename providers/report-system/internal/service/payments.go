@@ -0,0 +1,81 @@
+package service
+
+import (
+	"fmt"
+	lib_mapper "lib-shared/mapper"
+	"regexp"
+	"report-system/internal/models"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPaymentsPageSize = 50
+	maxPaymentsPageSize     = 200
+)
+
+var cardSuffixRegex = regexp.MustCompile(`^[0-9]{1,4}$`)
+
+// SearchPayments valida los filtros y devuelve la página de pagos que los cumplen en las colecciones fetch-*.
+func (provider *ReportService) SearchPayments(search models.PaymentSearch) (*models.PaymentResponse, error) {
+	if err := normalizePaymentSearch(&search); err != nil {
+		return nil, err
+	}
+	payments, total, err := provider.mongoRepository.SearchPayments(search, (search.Page-1)*search.PageSize, search.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	if payments == nil {
+		payments = make([]models.PaymentData, 0)
+	}
+	for i := range payments {
+		// los pagos guardados antes del estado de sincronización ya estaban escritos en SIR con su hash
+		if payments[i].SyncStatus == "" {
+			payments[i].SirHash = lib_mapper.ConfirmedHash(payments[i].Hash, payments[i].SirHash, payments[i].SyncStatus)
+			payments[i].SyncStatus = lib_mapper.SyncWritten
+		}
+	}
+	pages := (total + search.PageSize - 1) / search.PageSize
+	return &models.PaymentResponse{
+		TotalData:   total,
+		Pages:       int64(pages),
+		CurrentPage: search.Page,
+		Data:        &payments,
+	}, nil
+}
+
+func normalizePaymentSearch(search *models.PaymentSearch) error {
+	search.Provider = strings.ToUpper(strings.TrimSpace(search.Provider))
+	if search.Provider != "" && lib_mapper.CollectionName(search.Provider) == "" {
+		return fmt.Errorf("proveedor %s desconocido, usa uno de %v", search.Provider, lib_mapper.Providers())
+	}
+	search.UniqueId = strings.TrimSpace(search.UniqueId)
+	search.Authorization = strings.TrimSpace(search.Authorization)
+	search.Reference = strings.TrimSpace(search.Reference)
+	search.MerchantId = strings.TrimSpace(search.MerchantId)
+	search.StoreId = strings.TrimSpace(search.StoreId)
+	search.CardSuffix = strings.TrimSpace(search.CardSuffix)
+	if search.CardSuffix != "" && !cardSuffixRegex.MatchString(search.CardSuffix) {
+		return fmt.Errorf("cardSuffix debe tener entre 1 y 4 dígitos")
+	}
+	for _, date := range []string{search.DateFrom, search.DateTo} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("la fecha %s no tiene el formato AAAA-MM-DD", date)
+		}
+	}
+	if search.DateFrom != "" && search.DateTo != "" && search.DateFrom > search.DateTo {
+		return fmt.Errorf("dateFrom %s es posterior a dateTo %s", search.DateFrom, search.DateTo)
+	}
+	if search.MinAmount != nil && search.MaxAmount != nil && *search.MinAmount > *search.MaxAmount {
+		return fmt.Errorf("minAmount %.2f es mayor que maxAmount %.2f", *search.MinAmount, *search.MaxAmount)
+	}
+	search.Page = max(search.Page, 1)
+	if search.PageSize <= 0 {
+		search.PageSize = defaultPaymentsPageSize
+	}
+	search.PageSize = min(search.PageSize, maxPaymentsPageSize)
+	return nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"io"
+	"lib-shared/utils"
+	"report-system/internal/app/archive"
+	"slices"
+	"strings"
+	"time"
+)
+
+// documentos que se restauran por escritura en Mongo
+const restoreBatchSize = 500
+
+// ApplyRetention archiva los documentos vencidos de cada colección con días de retención y los quita de Mongo,
+// en las fetch-* queda un stub de cada pago. Una colección que falla no detiene a las demás, devuelve los
+// documentos archivados por colección y el primer error.
+func (provider *ReportService) ApplyRetention(store archive.Store) (map[string]int, error) {
+	archived := make(map[string]int)
+	retention := provider.cfg.Retention
+	collections := make([]string, 0, len(retention.Days))
+	for collection := range retention.Days {
+		collections = append(collections, collection)
+	}
+	slices.Sort(collections)
+	var firstErr error
+	for _, collection := range collections {
+		if !slices.Contains(provider.mongoRepository.RetentionCollections(), collection) {
+			utils.Error.Printf("[retention] la colección %s no admite retención, usa una de %v\n", collection, provider.mongoRepository.RetentionCollections())
+			continue
+		}
+		count, err := provider.archiveCollection(store, collection, retention.Days[collection])
+		archived[collection] = count
+		if err != nil {
+			utils.Error.Printf("[retention] %v\n", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return archived, firstErr
+}
+
+// archiveCollection archiva los documentos con más de days días en archivos de a BatchSize documentos y los
+// quita de Mongo solo después de guardar su archivo.
+func (provider *ReportService) archiveCollection(store archive.Store, collection string, days int) (int, error) {
+	now := time.Now()
+	before := now.AddDate(0, 0, -days)
+	archived := 0
+	for batch := 1; ; batch++ {
+		documents, err := provider.mongoRepository.ExpiredDocuments(collection, before, provider.cfg.Retention.BatchSize)
+		if err != nil {
+			return archived, err
+		}
+		if len(documents) == 0 {
+			break
+		}
+		content, ids, err := encodeArchive(documents)
+		if err != nil {
+			return archived, fmt.Errorf("error al generar el archivo de %s: %v", collection, err)
+		}
+		name := fmt.Sprintf("%s/%s-%s-%04d.ndjson.gz", collection, collection, now.Format("20060102T150405"), batch)
+		if err := store.Put(name, bytes.NewReader(content), int64(len(content))); err != nil {
+			return archived, fmt.Errorf("error al guardar el archivo %s en %s: %v", name, store.Location(), err)
+		}
+		purged, err := provider.mongoRepository.PurgeExpired(collection, ids, before)
+		if err != nil {
+			return archived, err
+		}
+		archived += len(documents)
+		utils.Info.Printf("[retention] %s: %d documentos archivados en %s, %d quitados de Mongo\n", collection, len(documents), name, purged)
+		if len(documents) < provider.cfg.Retention.BatchSize {
+			break
+		}
+	}
+	if archived > 0 {
+		utils.Info.Printf("[retention] %s: %d documentos anteriores al %s archivados en %s\n", collection, archived, before.Format("2006-01-02"), store.Location())
+	}
+	return archived, nil
+}
+
+// encodeArchive escribe los documentos como NDJSON en Extended JSON canónico (conserva fechas, ObjectId y
+// números al restaurar) comprimido con gzip, y devuelve sus _id.
+func encodeArchive(documents []bson.Raw) ([]byte, []any, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	ids := make([]any, 0, len(documents))
+	for _, document := range documents {
+		var id struct {
+			Id any `bson:"_id"`
+		}
+		if err := bson.Unmarshal(document, &id); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id.Id)
+		line, err := bson.MarshalExtJSON(document, true, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := writer.Write(append(line, '\n')); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, nil, err
+	}
+	return buffer.Bytes(), ids, nil
+}
+
+// Restore vuelve a cargar los archivos cuyo nombre empieza con alguno de prefixes, la colección es la carpeta
+// del archivo. Devuelve la cantidad de documentos restaurados.
+func (provider *ReportService) Restore(store archive.Store, prefixes []string) (int, error) {
+	restored := 0
+	for _, prefix := range prefixes {
+		names, err := store.List(prefix)
+		if err != nil {
+			return restored, fmt.Errorf("error al listar los archivos %s en %s: %v", prefix, store.Location(), err)
+		}
+		if len(names) == 0 {
+			return restored, fmt.Errorf("no hay archivos que empiecen con %s en %s", prefix, store.Location())
+		}
+		for _, name := range names {
+			count, err := provider.restoreFile(store, name)
+			restored += count
+			if err != nil {
+				return restored, err
+			}
+			utils.Info.Printf("[restore] %s: %d documentos restaurados\n", name, count)
+		}
+	}
+	return restored, nil
+}
+
+func (provider *ReportService) restoreFile(store archive.Store, name string) (int, error) {
+	collection, _, found := strings.Cut(name, "/")
+	if !found || !slices.Contains(provider.mongoRepository.RetentionCollections(), collection) {
+		return 0, fmt.Errorf("el archivo %s no está en la carpeta de una colección con retención", name)
+	}
+	file, err := store.Get(name)
+	if err != nil {
+		return 0, fmt.Errorf("error al leer el archivo %s: %v", name, err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return 0, fmt.Errorf("el archivo %s no es gzip: %v", name, err)
+	}
+	defer reader.Close()
+	lines := bufio.NewReader(reader)
+	restoredAt := time.Now()
+	documents := make([]bson.D, 0, restoreBatchSize)
+	restored := 0
+	flush := func() error {
+		if err := provider.mongoRepository.RestoreDocuments(collection, documents, restoredAt); err != nil {
+			return fmt.Errorf("error al restaurar %s en %s: %v", name, collection, err)
+		}
+		restored += len(documents)
+		documents = documents[:0]
+		return nil
+	}
+	for {
+		line, err := lines.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var document bson.D
+			if err := bson.UnmarshalExtJSON(line, true, &document); err != nil {
+				return restored, fmt.Errorf("documento inválido en %s: %v", name, err)
+			}
+			documents = append(documents, document)
+			if len(documents) == restoreBatchSize {
+				if err := flush(); err != nil {
+					return restored, err
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return restored, fmt.Errorf("error al leer el archivo %s: %v", name, err)
+		}
+	}
+	return restored, flush()
+}
@@ -1,11 +1,14 @@
 package service
 
 import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
 	"lib-shared/infrastructure/messaging_nats"
 	"lib-shared/reports_models"
 	"lib-shared/utils"
 	"report-system/internal/app/repository"
 	"report-system/internal/config"
+	"time"
 )
 
 type ReportService struct {
@@ -23,31 +26,244 @@ func NewApiProvider(mongoRepository *repository.MongoDataRepository, natsManager
 	}
 }
 
-func (provider *ReportService) CreateReport(report reports_models.ReportConciliator) {
-	// Obtener datos de configuración
-	err := provider.mongoRepository.CreateReport(report)
+// Los métodos devuelven el error de Mongo para que el listener vuelva a entregar el mensaje, todas las
+// escrituras son idempotentes o se hacen una sola vez por mensaje.
+
+func (provider *ReportService) CreateReport(report reports_models.ReportConciliator) error {
+	if report.Status == "" {
+		report.Status = reports_models.RunQueued
+	}
+	// el historial nunca queda en null, si no Mongo no puede agregarle transiciones
+	if len(report.StatusHistory) == 0 {
+		report.StatusHistory = []reports_models.RunTransition{{Status: report.Status, Reason: report.StatusReason, At: report.CreatedAt}}
+		report.StatusUpdatedAt = &report.CreatedAt
+	}
+	if err := provider.mongoRepository.CreateReport(report); err != nil {
+		return fmt.Errorf("save report error: %w", err)
+	}
+	return nil
+}
+func (provider *ReportService) AddToReport(dataReport reports_models.ReportData) error {
+	if err := provider.mongoRepository.AddToReport(dataReport); err != nil {
+		return fmt.Errorf("save data at report error: %w", err)
+	}
+	return nil
+}
+func (provider *ReportService) StartedReport(dataReport reports_models.StartedReport) error {
+	if err := provider.mongoRepository.StartedReport(dataReport); err != nil {
+		return fmt.Errorf("save data at report error: %w", err)
+	}
+	running := reports_models.RunTransition{Status: reports_models.RunRunning, At: dataReport.StartedTime}
+	if _, err := provider.mongoRepository.UpdateStatus(dataReport.ConciliatorId, running, nil); err != nil {
+		return fmt.Errorf("update status error: %w", err)
+	}
+	return nil
+}
+
+// RunStatusReport aplica un cambio de estado informado por api-central o un proveedor. Si el reporte todavía no
+// existe (el evento llegó antes que new.data.report) devuelve error para que se vuelva a entregar, una transición
+// no permitida solo se registra.
+func (provider *ReportService) RunStatusReport(statusReport reports_models.RunStatusReport) error {
+	set := bson.M{}
+	if statusReport.Status.Terminal() {
+		set["completedAt"] = statusReport.At
+	}
+	updated, err := provider.mongoRepository.UpdateStatus(statusReport.ConciliatorId, statusReport.Transition(), set)
 	if err != nil {
-		utils.Info.Println("save report error", err)
+		return fmt.Errorf("update status error: %w", err)
+	}
+	if updated {
+		utils.Info.Printf("[report] conciliación %s en estado %s %s\n", statusReport.ConciliatorId, statusReport.Status, statusReport.Reason)
+		if statusReport.Status.Terminal() {
+			provider.refreshAnalytics(statusReport.ConciliatorId)
+		}
+		return nil
 	}
+	report, err := provider.mongoRepository.FindById(statusReport.ConciliatorId)
+	if err != nil {
+		return err
+	}
+	if report == nil {
+		return fmt.Errorf("el reporte %s todavía no existe para pasar a %s", statusReport.ConciliatorId, statusReport.Status)
+	}
+	// el watchdog publica el vencimiento que ya guardó para avisar al stream de detalles
+	if report.Status == statusReport.Status {
+		return nil
+	}
+	utils.Warning.Printf("[report] la conciliación %s no puede pasar de %s a %s\n", statusReport.ConciliatorId, report.Status, statusReport.Status)
+	return nil
 }
-func (provider *ReportService) AddToReport(dataReport reports_models.ReportData) {
-	// Obtener datos de configuración
-	err := provider.mongoRepository.AddToReport(dataReport)
+func (provider *ReportService) CompletedReport(dataReport reports_models.CompletedReport) error {
+	if err := provider.mongoRepository.CompletedReport(dataReport); err != nil {
+		return fmt.Errorf("save data at report error: %w", err)
+	}
+	completed, err := provider.tryComplete(dataReport.ConciliatorId)
 	if err != nil {
-		utils.Info.Println("save data at report error", err)
+		return err
 	}
+	// los pagos del proveedor ya están en su colección fetch-*, si la conciliación terminó ya se recalculó
+	if !completed {
+		provider.refreshAnalytics(dataReport.ConciliatorId)
+	}
+	return nil
 }
-func (provider *ReportService) StartedReport(dataReport reports_models.StartedReport) {
-	// Obtener datos de configuración
-	err := provider.mongoRepository.StartedReport(dataReport)
+
+// SirWriteReport acumula el resultado real de SIR para un wrapper de la conciliación. En una redelivery el
+// resultado ya está guardado y no se repiten las entradas, pero se vuelven a calcular los totales por si la
+// entrega anterior falló después de guardarlo.
+func (provider *ReportService) SirWriteReport(writeReport reports_models.SirWriteReport) error {
+	inserted, err := provider.mongoRepository.SaveSirWriteReport(writeReport)
 	if err != nil {
-		utils.Info.Println("save data at report error", err)
+		return fmt.Errorf("save sir write report error: %w", err)
+	}
+	if !inserted {
+		utils.Warning.Printf("[sir-report] el resultado del wrapper %s ya fue registrado\n", writeReport.WrapperId)
 	}
+	if inserted && writeReport.Status == reports_models.SirWriteFailed {
+		provider.addEntry(reports_models.ReportData{
+			ConciliatorId: writeReport.ConciliatorId,
+			Type:          "ERROR",
+			Message:       fmt.Sprintf("SIR rechazó el wrapper %s, %d filas no se escribieron", writeReport.WrapperId, writeReport.Failed),
+			Metadata: reports_models.Metadata{
+				Content: writeReport.Errors,
+			},
+			CreatedAt: writeReport.CreatedAt,
+		})
+	}
+	if inserted && writeReport.Quarantined > 0 {
+		provider.addEntry(reports_models.ReportData{
+			ConciliatorId: writeReport.ConciliatorId,
+			Type:          "ERROR",
+			Message:       fmt.Sprintf("%d filas del wrapper %s quedaron en cuarentena por no pasar la validación de SIR", writeReport.Quarantined, writeReport.WrapperId),
+			Metadata: reports_models.Metadata{
+				Content: writeReport.Quarantine,
+			},
+			CreatedAt: writeReport.CreatedAt,
+		})
+	}
+	if err := provider.mongoRepository.RefreshSirEntries(writeReport.ConciliatorId); err != nil {
+		return fmt.Errorf("refresh sir entries error: %w", err)
+	}
+	_, err = provider.tryComplete(writeReport.ConciliatorId)
+	return err
 }
-func (provider *ReportService) CompletedReport(dataReport reports_models.CompletedReport) {
-	// Obtener datos de configuración
-	err := provider.mongoRepository.CompletedReport(dataReport)
+
+// RollbackReport registra en la conciliación el resultado del rollback que aplicó sir-writer.
+func (provider *ReportService) RollbackReport(rollbackReport reports_models.SirRollbackReport) error {
+	saved, err := provider.mongoRepository.SaveRollback(rollbackReport)
+	if err != nil {
+		return fmt.Errorf("save rollback report error: %w", err)
+	}
+	if !saved {
+		utils.Warning.Printf("[sir-report] el rollback %s ya fue registrado\n", rollbackReport.RollbackId)
+		return nil
+	}
+	dataReport := reports_models.ReportData{
+		ConciliatorId: rollbackReport.ConciliatorId,
+		Type:          "INFO",
+		Message: fmt.Sprintf("Rollback %s aplicado en SIR: %d cambios revertidos, %d filas eliminadas, %d filas restauradas",
+			rollbackReport.RollbackId, rollbackReport.Reverted, rollbackReport.Deleted, rollbackReport.Restored),
+		Metadata: reports_models.Metadata{
+			Content: rollbackReport,
+		},
+		CreatedAt: rollbackReport.CreatedAt,
+	}
+	if rollbackReport.Status == reports_models.SirWriteFailed {
+		dataReport.Type = "ERROR"
+		dataReport.Message = fmt.Sprintf("El rollback %s falló, SIR no fue modificado: %s", rollbackReport.RollbackId, rollbackReport.Error)
+	}
+	provider.addEntry(dataReport)
+	return nil
+}
+
+// addEntry agrega una entrada derivada de otro mensaje, si falla solo se registra porque la redelivery no la
+// vuelve a generar.
+func (provider *ReportService) addEntry(dataReport reports_models.ReportData) {
+	if err := provider.AddToReport(dataReport); err != nil {
+		utils.Error.Println(err)
+	}
+}
+
+// tryComplete marca la conciliación como completada si ya puede y recalcula los rollups de analítica, devuelve
+// si la completó.
+func (provider *ReportService) tryComplete(conciliatorId string) (bool, error) {
+	report, err := provider.mongoRepository.FindById(conciliatorId)
+	if err != nil {
+		return false, err
+	}
+	if report == nil || report.CompletedAt != nil || report.ProviderCompletedAt == nil {
+		return false, nil
+	}
+	transition, err := provider.completionStatus(report)
+	if err != nil {
+		return false, fmt.Errorf("complete report error: %w", err)
+	}
+	completed, err := provider.mongoRepository.TryCompleteReport(conciliatorId, transition)
+	if err != nil {
+		return false, fmt.Errorf("complete report error: %w", err)
+	}
+	if completed {
+		utils.Info.Printf("[report] conciliación %s completada en estado %s\n", conciliatorId, transition.Status)
+		provider.refreshAnalytics(conciliatorId)
+	}
+	return completed, nil
+}
+
+// completionStatus es completed salvo que SIR haya rechazado wrappers o filas, el proveedor no haya podido
+// publicar wrappers o el reporte tenga entradas con error.
+func (provider *ReportService) completionStatus(report *reports_models.ReportConciliator) (reports_models.RunTransition, error) {
+	transition := reports_models.RunTransition{Status: reports_models.RunCompleted, At: time.Now()}
+	if sir := report.Sir; sir != nil {
+		switch {
+		case sir.FailedWrappers > 0:
+			transition.Reason = fmt.Sprintf("SIR rechazó %d de %d wrappers", sir.FailedWrappers, sir.Wrappers)
+		case sir.PublishFailed > 0:
+			transition.Reason = fmt.Sprintf("%d wrappers no se pudieron publicar", sir.PublishFailed)
+		case sir.Quarantined > 0:
+			transition.Reason = fmt.Sprintf("%d filas quedaron en cuarentena", sir.Quarantined)
+		}
+	}
+	if transition.Reason == "" {
+		hasErrors, err := provider.mongoRepository.HasErrorEntries(report.ConciliatorId)
+		if err != nil {
+			return transition, err
+		}
+		if hasErrors {
+			transition.Reason = "el reporte tiene registros con error"
+		}
+	}
+	if transition.Reason != "" {
+		transition.Status = reports_models.RunCompletedWithErrors
+	}
+	return transition, nil
+}
+
+// TimeOutStaleRuns marca como vencidas las conciliaciones que no empezaron o no terminaron dentro de timeout y
+// publica el nuevo estado de cada una para que el stream de detalles termine.
+func (provider *ReportService) TimeOutStaleRuns(timeout time.Duration) error {
+	now := time.Now()
+	transition := reports_models.RunTransition{
+		Status: reports_models.RunTimedOut,
+		Reason: fmt.Sprintf("sin terminar después de %s", timeout),
+		At:     now,
+	}
+	timedOut, err := provider.mongoRepository.TimeOutStaleRuns(now.Add(-timeout), transition)
+	if len(timedOut) > 0 {
+		utils.Warning.Printf("[watchdog] %d conciliaciones marcadas como vencidas\n", len(timedOut))
+	}
+	for _, conciliatorId := range timedOut {
+		statusReport := reports_models.RunStatusReport{
+			ConciliatorId: conciliatorId,
+			Status:        transition.Status,
+			Reason:        transition.Reason,
+			At:            transition.At,
+		}
+		if err := reports_models.RunStatusReportEvent.Publish(provider.natsManager.EventSender, conciliatorId, statusReport); err != nil {
+			utils.Error.Printf("[watchdog] no se pudo publicar el vencimiento de %s: %v\n", conciliatorId, err)
+		}
+	}
 	if err != nil {
-		utils.Info.Println("save data at report error", err)
+		return fmt.Errorf("timeout stale runs error: %w", err)
 	}
+	return nil
 }
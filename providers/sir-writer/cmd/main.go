@@ -1,9 +1,14 @@
 package main
 
 import (
+	"flag"
+	lib_mapper "lib-shared/mapper"
+	"os"
 	"sir-writer/internal/config"
 	"sir-writer/internal/server"
 	"sir-writer/utils"
+	"strings"
+	"time"
 )
 
 /*
@@ -12,9 +17,30 @@ import (
 * Este microservicio está diseñado para ejecutarse como un CronJob dentro de un clúster de Kubernetes.
 * El servicio de DATAFAST se encarga de generar y proporcionar el reporte de las transacciones
 * 24 horas después de haber efectuado el corte del lote.
+*
+* Comandos:
+*   sir-writer                                  consume sir.writer.* y escribe en SIR
+*   sir-writer retry [-provider KIOSKO] [-older-than 30m]
+*                                               reenvía los pagos FAILED y los PENDING cuyo wrapper ya expiró
  */
 func main() {
 	cfg := config.LoadConfig()
+	if len(os.Args) > 1 && os.Args[1] == "retry" {
+		runRetry(cfg, os.Args[2:])
+		return
+	}
 	server.NewContainer(cfg)
-	utils.Info.Println("✅ Servicio inicializado")
+	utils.Info.Println("✅ Servicio finalizado")
+}
+
+func runRetry(cfg config.Config, args []string) {
+	retryFlags := flag.NewFlagSet("retry", flag.ExitOnError)
+	providerFlag := retryFlags.String("provider", "", "proveedor a reintentar (KIOSKO, DATAFAST, DEUNA-PICHI), vacío para todos")
+	olderThan := retryFlags.Duration("older-than", 30*time.Minute, "solo pagos fallidos guardados hace más de este tiempo")
+	retryFlags.Parse(args)
+	providers := lib_mapper.Providers()
+	if !utils.IsEmptyString(*providerFlag) {
+		providers = []string{strings.ToUpper(strings.TrimSpace(*providerFlag))}
+	}
+	server.RunRetry(cfg, providers, *olderThan)
 }
@@ -2,35 +2,258 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	lib_mapper "lib-shared/mapper"
+	"lib-shared/sir_models"
+	"lib-shared/sir_validation"
 	"sir-writer/internal/config"
+	"time"
 )
 
 type MongoDataRepository struct {
-	Client             *mongo.Client
-	DatafastCollection *mongo.Collection
+	Client   *mongo.Client
+	Database *mongo.Database
 }
 
 func NewMongoDataRepository(client *mongo.Client, cfg config.Config) *MongoDataRepository {
-	DatafastCollection := client.Database(cfg.Mongo.Database).Collection("fetch-kioscos")
-	return &MongoDataRepository{Client: client, DatafastCollection: DatafastCollection}
+	return &MongoDataRepository{Client: client, Database: client.Database(cfg.Mongo.Database)}
 }
-func (receiver *MongoDataRepository) SaveBulkModel(payments []lib_mapper.Payment) error {
+
+// paymentsCollection devuelve la colección fetch-* donde el proveedor guarda sus pagos.
+func (receiver *MongoDataRepository) paymentsCollection(provider string) (*mongo.Collection, error) {
+	name := lib_mapper.CollectionName(provider)
+	if name == "" {
+		return nil, fmt.Errorf("proveedor desconocido '%s'", provider)
+	}
+	return receiver.Database.Collection(name), nil
+}
+
+// MarkWritten registra en cada pago el hash que quedó confirmado en SIR. El estado solo pasa a WRITTEN si el
+// documento no fue reemplazado por una corrida más reciente con otro hash (esa sigue pendiente).
+func (receiver *MongoDataRepository) MarkWritten(provider string, transactions []sir_models.TransactionRef) error {
+	collection, err := receiver.paymentsCollection(provider)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
 	models := make([]mongo.WriteModel, 0)
-	for _, payment := range payments {
+	for _, transaction := range transactions {
+		if transaction.UniqueId == "" {
+			continue
+		}
+		sirHash := transaction.Hash
+		if transaction.OperationType == "DELETE" {
+			sirHash = ""
+		}
+		models = append(models, mongo.
+			NewUpdateOneModel().
+			SetFilter(bson.M{"uniqueId": transaction.UniqueId}).
+			SetUpdate(bson.A{
+				bson.M{"$set": bson.M{
+					"sirHash":  sirHash,
+					"syncedAt": now,
+					"syncStatus": bson.M{"$cond": bson.A{
+						bson.M{"$eq": bson.A{"$hash", transaction.Hash}},
+						lib_mapper.SyncWritten,
+						"$syncStatus",
+					}},
+				}},
+				bson.M{"$unset": "syncError"},
+			}))
+	}
+	return receiver.bulkWrite(collection, models)
+}
+
+// MarkFailed marca como FAILED los pagos del wrapper descartado, siempre que sigan con el mismo hash.
+func (receiver *MongoDataRepository) MarkFailed(provider string, transactions []sir_models.TransactionRef, syncError string) error {
+	collection, err := receiver.paymentsCollection(provider)
+	if err != nil {
+		return err
+	}
+	models := make([]mongo.WriteModel, 0)
+	for _, transaction := range transactions {
+		if transaction.UniqueId == "" {
+			continue
+		}
+		models = append(models, mongo.
+			NewUpdateOneModel().
+			SetFilter(bson.M{"uniqueId": transaction.UniqueId, "hash": transaction.Hash}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"syncStatus": lib_mapper.SyncFailed,
+				"syncError":  syncError,
+			}}))
+	}
+	return receiver.bulkWrite(collection, models)
+}
+
+// SaveQuarantine guarda las filas que no pasaron la validación en sir-quarantine, una por wrapper y pago
+// para que las redeliveries no las dupliquen.
+func (receiver *MongoDataRepository) SaveQuarantine(rows []sir_validation.QuarantinedRow) error {
+	collection := receiver.Database.Collection("sir-quarantine")
+	models := make([]mongo.WriteModel, 0, len(rows))
+	for _, row := range rows {
+		models = append(models, mongo.
+			NewUpdateOneModel().
+			SetFilter(bson.M{"wrapperId": row.WrapperId, "uniqueId": row.UniqueId}).
+			SetUpdate(bson.M{"$setOnInsert": row}).
+			SetUpsert(true))
+	}
+	return receiver.bulkWrite(collection, models)
+}
+
+// MarkQuarantined deja en QUARANTINED los pagos que no se escribieron por la validación, siempre que sigan
+// con el mismo hash. sirHash no cambia, así la próxima corrida con el dato corregido se vuelve a enviar.
+func (receiver *MongoDataRepository) MarkQuarantined(provider string, rows []sir_validation.QuarantinedRow) error {
+	collection, err := receiver.paymentsCollection(provider)
+	if err != nil {
+		return err
+	}
+	models := make([]mongo.WriteModel, 0, len(rows))
+	for _, row := range rows {
+		if row.UniqueId == "" {
+			continue
+		}
 		models = append(models, mongo.
 			NewUpdateOneModel().
-			SetFilter(bson.D{{"uniqueId", payment.UniqueId}}).
-			SetUpdate(bson.M{"$set": payment}).SetUpsert(true))
+			SetFilter(bson.M{"uniqueId": row.UniqueId, "hash": row.Hash}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"syncStatus": lib_mapper.SyncQuarantined,
+				"syncError":  sir_validation.Summary(row.Violations),
+			}}))
 	}
-	opts := options.BulkWrite().SetOrdered(true)
-	// Runs a bulk write operation for the specified write operations
-	_, err := receiver.DatafastCollection.BulkWrite(context.Background(), models, opts)
+	return receiver.bulkWrite(collection, models)
+}
+
+// MarkRolledBack deja en ROLLED_BACK los pagos revertidos en SIR, con el hash de la fila que quedó en SIR
+// (vacío si se eliminó) para que la próxima corrida vuelva a decidir INSERT o UPDATE.
+func (receiver *MongoDataRepository) MarkRolledBack(provider string, sirHashes map[string]string) error {
+	collection, err := receiver.paymentsCollection(provider)
 	if err != nil {
 		return err
 	}
-	return nil
+	now := time.Now()
+	models := make([]mongo.WriteModel, 0, len(sirHashes))
+	for uniqueId, sirHash := range sirHashes {
+		models = append(models, mongo.
+			NewUpdateOneModel().
+			SetFilter(bson.M{"uniqueId": uniqueId}).
+			SetUpdate(bson.M{
+				"$set": bson.M{
+					"sirHash":    sirHash,
+					"syncStatus": lib_mapper.SyncRolledBack,
+					"syncedAt":   now,
+				},
+				"$unset": bson.M{"syncError": ""},
+			}))
+	}
+	return receiver.bulkWrite(collection, models)
+}
+
+// MarkPending vuelve a dejar en PENDING los pagos que se reenvían a sir-writer.
+func (receiver *MongoDataRepository) MarkPending(provider string, uniqueIds []string) error {
+	collection, err := receiver.paymentsCollection(provider)
+	if err != nil {
+		return err
+	}
+	_, err = collection.UpdateMany(context.Background(),
+		bson.M{"uniqueId": bson.M{"$in": uniqueIds}},
+		bson.M{"$set": bson.M{"syncStatus": lib_mapper.SyncPending, "pendingAt": time.Now()}})
+	return err
+}
+
+// FindUnsynced devuelve los pagos FAILED guardados antes de failedBefore y los PENDING desde antes de
+// pendingBefore. Un PENDING queda pendiente desde que el proveedor lo guardó (createdAt) o desde el último
+// reintento (pendingAt).
+func (receiver *MongoDataRepository) FindUnsynced(provider string, failedBefore, pendingBefore time.Time) ([]lib_mapper.Payment, error) {
+	collection, err := receiver.paymentsCollection(provider)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"syncStatus": lib_mapper.SyncFailed, "createdAt": bson.M{"$lt": failedBefore}},
+			bson.M{
+				"syncStatus": lib_mapper.SyncPending,
+				"createdAt":  bson.M{"$lt": pendingBefore},
+				"$or": bson.A{
+					bson.M{"pendingAt": bson.M{"$exists": false}},
+					bson.M{"pendingAt": bson.M{"$lt": pendingBefore}},
+				},
+			},
+		},
+	}
+	cursor, err := collection.Find(context.Background(), filter, options.Find().SetSort(bson.M{"conciliatorId": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+	payments := make([]lib_mapper.Payment, 0)
+	for cursor.Next(context.Background()) {
+		var payment lib_mapper.Payment
+		if err := cursor.Decode(&payment); err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, cursor.Err()
+}
+
+// FindWrittenDuplicates busca en las colecciones fetch-* de los demás proveedores los pagos ya escritos en SIR
+// (con hash confirmado) que tienen la misma fecha y autorización que alguna de transactions. Son candidatos, la
+// coincidencia completa se revisa con DuplicateKey.
+func (receiver *MongoDataRepository) FindWrittenDuplicates(provider string, transactions []sir_models.StTransactions) ([]lib_mapper.Payment, error) {
+	dates := make([]string, 0)
+	authorizations := make([]string, 0)
+	for _, transaction := range transactions {
+		if transaction.DuplicateKey() == "" {
+			continue
+		}
+		dates = append(dates, transaction.FechaTransaccion)
+		authorizations = append(authorizations, transaction.NumeroAutorizacion)
+	}
+	payments := make([]lib_mapper.Payment, 0)
+	if len(authorizations) == 0 {
+		return payments, nil
+	}
+	filter := bson.M{
+		"data.output.fecha_Transaccion":   bson.M{"$in": dates},
+		"data.output.numero_Autorizacion": bson.M{"$in": authorizations},
+		// escrito en SIR: con sirHash o previo al estado de sincronización, como en lib_mapper.ConfirmedHash
+		"$or": bson.A{
+			bson.M{"sirHash": bson.M{"$nin": bson.A{"", nil}}},
+			bson.M{"syncStatus": bson.M{"$in": bson.A{"", nil}}},
+		},
+	}
+	findOptions := options.Find().SetProjection(bson.M{"data.input": 0, "runs": 0})
+	for _, other := range lib_mapper.Providers() {
+		if other == provider {
+			continue
+		}
+		cursor, err := receiver.Database.Collection(lib_mapper.CollectionName(other)).Find(context.Background(), filter, findOptions)
+		if err != nil {
+			return nil, fmt.Errorf("error al buscar pagos duplicados en %s: %w", other, err)
+		}
+		found := make([]lib_mapper.Payment, 0)
+		if err := cursor.All(context.Background(), &found); err != nil {
+			return nil, fmt.Errorf("error al leer pagos duplicados de %s: %w", other, err)
+		}
+		payments = append(payments, found...)
+	}
+	return payments, nil
+}
+
+func (receiver *MongoDataRepository) bulkWrite(collection *mongo.Collection, models []mongo.WriteModel) error {
+	if len(models) == 0 {
+		return nil
+	}
+	opts := options.BulkWrite().SetOrdered(false)
+	_, err := collection.BulkWrite(context.Background(), models, opts)
+	return err
+}
+
+func (receiver *MongoDataRepository) Close() {
+	receiver.Client.Disconnect(context.Background())
 }
@@ -2,15 +2,18 @@ package config
 
 import (
 	"github.com/joho/godotenv"
+	"lib-shared/infrastructure/messaging_nats"
 	"log"
 	"os"
 	"sir-writer/utils"
+	"strconv"
 )
 
 type Config struct {
 	Mongo        MongoConfig
-	Nats         NatsConfig
+	Nats         messaging_nats.Connection
 	SqlServerSir SqlServerSir
+	Duplicates   DuplicatesConfig
 	TimeZone     string
 }
 
@@ -18,11 +21,18 @@ type MongoConfig struct {
 	URI      string
 	Database string
 }
-type NatsConfig struct {
-	URI string
-}
+
 type SqlServerSir struct {
 	JDBC string
+	// Driver de la base SIR: sqlserver (por defecto) o sqlite para correr en local con fixtures
+	Driver   string
+	Fixtures string
+}
+
+// DuplicatesConfig controla los pagos que llegan por más de un proveedor (kiosco y Datafast con la misma
+// autorización). Con Prevent un INSERT cuyo pago ya escribió otro proveedor en SIR queda en cuarentena.
+type DuplicatesConfig struct {
+	Prevent bool
 }
 
 func LoadConfig() Config {
@@ -39,11 +49,14 @@ func LoadConfig() Config {
 			URI:      getEnv("MONGO_URI", "no_configurado"),
 			Database: getEnv("MONGO_DATABASE", "no_configurado"),
 		},
-		Nats: NatsConfig{
-			URI: getEnv("NATS_URI", "no_configurado"),
-		},
+		Nats: messaging_nats.ConnectionFromEnv(),
 		SqlServerSir: SqlServerSir{
-			JDBC: getEnv("SIR_DATABASE", "no_configurado"),
+			JDBC:     getEnv("SIR_DATABASE", "no_configurado"),
+			Driver:   getEnv("SIR_DRIVER", "sqlserver"),
+			Fixtures: getEnv("SIR_FIXTURES", ""),
+		},
+		Duplicates: DuplicatesConfig{
+			Prevent: getEnvBool("PREVENT_CROSS_PROVIDER_DUPLICATES", false),
 		},
 		TimeZone: getEnv("TIMEZONE", "no_configurado"),
 	}
@@ -56,3 +69,12 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvBool obtiene una variable de entorno booleana o usa el valor por defecto si no existe o no es válida.
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -1,53 +1,168 @@
 package server
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/nats-io/nats.go/jetstream"
 	"lib-shared/infrastructure/messaging_nats"
 	"lib-shared/sir_models"
+	"lib-shared/sir_repository"
+	"lib-shared/topology"
 	"os"
+	"os/signal"
 	db "sir-writer/internal/app/databases"
 	"sir-writer/internal/app/repository"
 	"sir-writer/internal/config"
 	"sir-writer/internal/service"
 	"sir-writer/utils"
+	"syscall"
 	"time"
 )
 
-var exit = make(chan os.Signal, 1)
+// tiempo que se espera a los wrappers en proceso al recibir SIGTERM, debe ser menor al terminationGracePeriod
+const shutdownTimeout = 20 * time.Second
 
+// NewContainer consume sir.writer.* hasta recibir SIGINT o SIGTERM, y vuelve cuando los wrappers en proceso
+// terminaron (o se devolvieron con NAK) y las conexiones quedaron cerradas.
 func NewContainer(cfg config.Config) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	mongoClient, err := db.NewMongoClient(cfg.Mongo.URI)
 	if err != nil {
 		utils.Error.Panic("Error creando el cliente de MongoDB: %v", err)
 	}
 	mongoDataRepository := repository.NewMongoDataRepository(mongoClient, cfg)
 	// Conectar a NATS
-	natsManager := messaging_nats.NewStartNats(cfg.Nats.URI, &messaging_nats.OptsNats{
-		NameStream: "conciliador-tarjetas",
-		Subjects:   []string{"sir.writer.sttransaction", "sir.writer.ventasapp"},
-		MaxAge:     3 * (24 * time.Hour),
+	natsManager, err := messaging_nats.NewStartNats(cfg.Nats, &messaging_nats.OptsNats{Topology: &topology.Conciliador})
+	if err != nil {
+		utils.Error.Fatalf("Error conectando a NATS: %v", err)
+	}
+	sirRepository, err := sir_repository.NewSirRepository(sir_repository.Options{
+		Driver:      cfg.SqlServerSir.Driver,
+		DSN:         cfg.SqlServerSir.JDBC,
+		FixturesDir: cfg.SqlServerSir.Fixtures,
 	})
-	cache := service.NewDataCacheRestaurant(cfg)
+	if err != nil {
+		utils.Error.Panicf("Error conectando a la base SIR: %v", err)
+	}
+	if err := sirRepository.EnsureSchema(); err != nil {
+		utils.Error.Panicf("Error creando las tablas del conciliador en SIR: %v", err)
+	}
+	cache := service.NewDataCacheRestaurant(sirRepository)
 	cache.LoadRestaurantAndGrupo()
-	provider := service.NewApiProvider(mongoDataRepository, natsManager, cfg, cache)
-	err = natsManager.EventListener.Execute("conciliador-tarjetas", exit, 1, "sir.writer.sttransaction", "SIR_WRITER", func(msg jetstream.Msg) {
-		var StTransactionsWrapper sir_models.WrapperTransactions
-		err := json.Unmarshal(msg.Data(), &StTransactionsWrapper)
-		if err != nil {
-			utils.Error.Println("error al deserializar mensaje", err)
-			msg.Ack()
-			return
-		}
-		go func(msg jetstream.Msg) {
-			provider.SavePaymentsTransactions(StTransactionsWrapper, msg)
-			msg.Ack()
-		}(msg)
-
+	provider := service.NewApiProvider(mongoDataRepository, sirRepository, natsManager, cfg, cache)
+	transactions := topology.Consumer(topology.SirWriter)
+	err = sir_models.TransactionsEvent.Consume(ctx, natsManager.EventListener, transactions, func(event messaging_nats.Envelope[sir_models.WrapperTransactions]) error {
+		return handleWrapper(provider, transactions.Policy, event.Msg, event.Data, func() (*service.WriteResult, error) {
+			return provider.SavePaymentsTransactions(event.Data, event.Msg)
+		})
 	})
 	if err != nil {
 		utils.Error.Panicf("Error al inicializar Listener conciliador-tarjetas - sir.writer.sttransaction: %v", err)
 		return
 	}
-	select {}
+	ventasApp := topology.Consumer(topology.SirWriterVentasApp)
+	err = sir_models.VentasAppEvent.Consume(ctx, natsManager.EventListener, ventasApp, func(event messaging_nats.Envelope[sir_models.WrapperVentasApp]) error {
+		return handleWrapper(provider, ventasApp.Policy, event.Msg, event.Data, func() (*service.WriteResult, error) {
+			return provider.SaveVentasAppTransactions(event.Data, event.Msg)
+		})
+	})
+	if err != nil {
+		utils.Error.Panicf("Error al inicializar Listener conciliador-tarjetas - sir.writer.ventasapp: %v", err)
+		return
+	}
+	rollback := topology.Consumer(topology.SirWriterRollback)
+	err = sir_models.RollbackEvent.Consume(ctx, natsManager.EventListener, rollback, func(event messaging_nats.Envelope[sir_models.RollbackRequest]) error {
+		return handleRollback(provider, rollback.Policy, event.Msg, event.Data)
+	})
+	if err != nil {
+		utils.Error.Panicf("Error al inicializar Listener conciliador-tarjetas - sir.writer.rollback: %v", err)
+		return
+	}
+	<-ctx.Done()
+	utils.Warning.Println("[shutdown] señal recibida, se deja de consumir y se espera a los wrappers en proceso")
+	if err := natsManager.Shutdown(shutdownTimeout); err != nil {
+		utils.Error.Printf("[shutdown] %v\n", err)
+		if errors.Is(err, messaging_nats.ErrHandlersRunning) {
+			// cerrar SIR o Mongo cortaría a la mitad las transacciones de los wrappers que siguen en proceso
+			utils.Warning.Println("[shutdown] hay wrappers en proceso, no se cierran las conexiones a SIR y MongoDB")
+			return
+		}
+	}
+	if err := sirRepository.Close(); err != nil {
+		utils.Error.Printf("[shutdown] error al cerrar la conexión a SIR: %v\n", err)
+	}
+	mongoDataRepository.Close()
+	utils.Info.Println("[shutdown] sir-writer detenido")
+}
+
+// handleWrapper aplica el wrapper y devuelve el error para que el listener haga NAK con espera o lo mande al
+// dead-letter. Solo el resultado definitivo (escrito, o la última entrega fallida) se refleja en Mongo y en
+// report-system, con las filas en cuarentena.
+func handleWrapper(provider *service.ApiProviderDatafast, policy messaging_nats.RetryPolicy, msg jetstream.Msg, wrapper sir_models.Wrapper, save func() (*service.WriteResult, error)) error {
+	result, err := save()
+	if err != nil {
+		utils.Error.Printf("[sql-sir] error al aplicar el wrapper %s: %v\n", wrapper.GetId(), err)
+		if !policy.Exhausted(msg) {
+			return err
+		}
+		utils.Error.Printf("[sql-sir] el wrapper %s agotó sus entregas, se descarta\n", wrapper.GetId())
+	}
+	provider.UpdateSyncState(wrapper, result, err)
+	provider.SaveQuarantine(wrapper, result)
+	if publishErr := provider.PublishWriteResult(wrapper, result, err); publishErr != nil && err == nil {
+		// el wrapper ya está en SIR, la redelivery lo reconoce en el ledger y vuelve a publicar el resultado
+		return fmt.Errorf("error al publicar el resultado del wrapper %s: %w", wrapper.GetId(), publishErr)
+	}
+	return err
+}
+
+// handleRollback aplica el rollback con la misma política de reintentos que los wrappers, el resultado
+// definitivo se informa a report-system.
+func handleRollback(provider *service.ApiProviderDatafast, policy messaging_nats.RetryPolicy, msg jetstream.Msg, request sir_models.RollbackRequest) error {
+	result, err := provider.RollbackConciliator(request, msg)
+	if err != nil {
+		utils.Error.Printf("[rollback-sir] error al revertir la conciliación %s: %v\n", request.ConciliatorId, err)
+		if !policy.Exhausted(msg) {
+			return err
+		}
+		utils.Error.Printf("[rollback-sir] el rollback %s agotó sus entregas, se descarta\n", request.Id)
+		if publishErr := provider.PublishRollbackResult(request, result, err); publishErr != nil {
+			utils.Error.Printf("[rollback-sir] error al publicar el resultado del rollback %s: %v\n", request.Id, publishErr)
+		}
+		return err
+	}
+	// una redelivery del rollback se omite en el ledger sin los totales, por eso un fallo al publicar solo se registra
+	if !result.Skipped {
+		if err := provider.PublishRollbackResult(request, result, nil); err != nil {
+			utils.Error.Printf("[rollback-sir] error al publicar el resultado del rollback %s: %v\n", request.Id, err)
+		}
+	}
+	return nil
+}
+
+// RunRetry reenvía a sir-writer los pagos sin sincronizar de los proveedores indicados y termina.
+func RunRetry(cfg config.Config, providers []string, olderThan time.Duration) {
+	mongoClient, err := db.NewMongoClient(cfg.Mongo.URI)
+	if err != nil {
+		utils.Error.Panicf("Error creando el cliente de MongoDB: %v", err)
+	}
+	mongoDataRepository := repository.NewMongoDataRepository(mongoClient, cfg)
+	defer mongoDataRepository.Close()
+	natsManager, err := messaging_nats.NewStartNats(cfg.Nats, &messaging_nats.OptsNats{Topology: &topology.Conciliador})
+	if err != nil {
+		utils.Error.Fatalf("Error conectando a NATS: %v", err)
+	}
+	defer natsManager.Close()
+	provider := service.NewApiProvider(mongoDataRepository, nil, natsManager, cfg, nil)
+	total := 0
+	for _, providerName := range providers {
+		retried, err := provider.RetryUnsynced(providerName, olderThan)
+		if err != nil {
+			utils.Error.Printf("[sync-retry][%s] %v\n", providerName, err)
+		}
+		total += retried
+	}
+	utils.Info.Printf("[sync-retry] total de pagos reenviados %d\n", total)
 }
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"lib-shared/sir_models"
+	"lib-shared/sir_repository"
+	"sir-writer/utils"
+)
+
+// journaled indica si los cambios del wrapper se guardan en ST_Conciliador_Cambios, solo los wrappers
+// con conciliación se pueden revertir.
+func journaled(wrapper sir_models.Wrapper) bool {
+	return !utils.IsEmptyString(wrapper.GetConciliatorId())
+}
+
+// recordChange guarda en el journal la fila escrita y las filas que había antes bajo su clave (nil en INSERT).
+func recordChange(tx sir_repository.WriteTx, wrapper sir_models.Wrapper, ref sir_models.TransactionRef, table string, data any, before any) error {
+	dataAsBytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error al serializar la fila para el journal: %w", err)
+	}
+	change := sir_repository.Change{
+		ConciliatorId: wrapper.GetConciliatorId(),
+		WrapperId:     wrapper.GetId(),
+		Provider:      wrapper.GetProvider(),
+		UniqueId:      ref.UniqueId,
+		Table:         table,
+		Operation:     ref.OperationType,
+		Data:          string(dataAsBytes),
+	}
+	if before != nil {
+		beforeAsBytes, err := json.Marshal(before)
+		if err != nil {
+			return fmt.Errorf("error al serializar la imagen anterior para el journal: %w", err)
+		}
+		change.Before = string(beforeAsBytes)
+	}
+	return tx.RecordChange(change)
+}
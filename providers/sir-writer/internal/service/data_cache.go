@@ -1,8 +1,7 @@
 package service
 
 import (
-	db "sir-writer/internal/app/databases"
-	"sir-writer/internal/config"
+	"lib-shared/sir_repository"
 	"sir-writer/utils"
 	"strconv"
 )
@@ -27,124 +26,48 @@ type GrupoTarjeta struct {
 type DataCacheRestaurant struct {
 	RestaurantCache   map[string]Restaurante
 	GrupoTarjetaCache map[string]GrupoTarjeta
-	Cfg               config.Config
+	Catalog           sir_repository.CatalogRepository
 }
 
-func NewDataCacheRestaurant(cfg config.Config) *DataCacheRestaurant {
+func NewDataCacheRestaurant(catalog sir_repository.CatalogRepository) *DataCacheRestaurant {
 	return &DataCacheRestaurant{
 		RestaurantCache:   make(map[string]Restaurante),
 		GrupoTarjetaCache: make(map[string]GrupoTarjeta),
-		Cfg:               cfg,
+		Catalog:           catalog,
 	}
 }
 
 func (cache *DataCacheRestaurant) LoadRestaurantAndGrupo() {
-
-	// Crear una nueva conexión a la base de datos
-	conn, err := db.NewSQLServerConnection(cache.Cfg.SqlServerSir.JDBC)
-	if err != nil {
-		utils.Error.Panic("[cache-restaurant-datafast] error conectando a la base de datos: ", err)
-		return
-	}
-	defer conn.Close()
-	// Ejecutar la consulta y obtener múltiples registros como un slice de mapas
-	query := `SELECT 
-				r.Cod_Tienda, 
-				r.SwitchT, 
-				mids.MID, 
-				ts.Id_tipo_switch AS tipo_switch, 
-				ot.id_origen AS origen, 
-				'DATBALANCE' AS sistema, 
-				r.Cod_Cadena
-			FROM dbo.MIDs_Restaurante AS mids WITH(NOLOCK)
-			INNER JOIN dbo.Restaurante AS r WITH(NOLOCK) 
-				ON r.Cod_Restaurante = mids.Cod_Restaurante 
-			INNER JOIN dbo.Red_Pagos AS medio WITH(NOLOCK) 
-				ON medio.Cod_Red_Pagos = mids.Cod_Red_Pagos 
-			CROSS JOIN (SELECT Id_tipo_switch FROM ST_Tipo_Switch WITH(NOLOCK) WHERE Descripcion = 'Alignet/Externo') ts
-			CROSS JOIN (SELECT id_origen FROM ST_Origen_Transaccion WITH(NOLOCK) WHERE Descripcion = 'DataFast') ot
-			WHERE medio.Descripcion = 'DATAFAST' 
-			AND mids.Estado = 1;`
-	rows, err := conn.Query(query)
+	mids, err := cache.Catalog.FindRestaurantMids("DATAFAST", "DataFast")
 	if err != nil {
 		utils.Error.Panic("[cache-restaurant-datafast] error ejecutando la consulta: ", err)
 		return
 	}
-	for rows.Next() {
-		var (
-			codTienda  string
-			switchT    string
-			mid        string
-			tipoSwitch string
-			origen     string
-			sistema    string
-			codCadena  string
-		)
-		err := rows.Scan(&codTienda, &switchT, &mid, &tipoSwitch, &origen, &sistema, &codCadena)
-		if err != nil {
-			utils.Error.Panic("[cache-restaurant-datafast] error al retornar los datos (Scan)", err)
-			return
-		}
-		cache.RestaurantCache[codTienda] = Restaurante{
-			CodTienda:  codTienda,
-			SwitchT:    switchT,
-			MID:        mid,
-			TipoSwitch: tipoSwitch,
-			Origen:     origen,
-			Sistema:    sistema,
-			CodCadena:  codCadena,
+	for _, mid := range mids {
+		cache.RestaurantCache[mid.CodTienda] = Restaurante{
+			CodTienda:  mid.CodTienda,
+			SwitchT:    mid.SwitchT,
+			MID:        mid.MID,
+			TipoSwitch: mid.TipoSwitch,
+			Origen:     mid.Origen,
+			Sistema:    mid.Sistema,
+			CodCadena:  mid.CodCadena,
 		}
 	}
-	rows.Close()
 	// Cargar Grupo Tarjetas
-
-	query = `SELECT 
-				id_grupo_tarjeta, 
-				FPN.Cod_Cadena, 
-				FPN.Minimo, 
-				FPN.Maximo 
-			FROM ST_Grupo_Tarjeta WITH(NOLOCK) 
-			INNER JOIN (
-				SELECT DISTINCT 
-					RTRIM(LTRIM(fp.Nombre)) AS Nombre, 
-					fpb.Cod_Cadena, 
-					fpb.Minimo, 
-					fpb.Maximo 
-				FROM FormadePago_Bines AS fpb WITH(NOLOCK) 
-				INNER JOIN FormasPago AS fp WITH(NOLOCK) 
-					ON fp.Cod_FormaPago = fpb.Cod_FormaPago
-			) AS FPN 
-			ON LTRIM(RTRIM(Descripcion)) LIKE '%' + 
-				(CASE 
-					WHEN Nombre = 'ALIA' THEN 'COUTA FACIL' 
-					ELSE Nombre 
-				END) + '%';`
-
-	rows, err = conn.Query(query)
+	groups, err := cache.Catalog.FindCardGroupRanges()
 	if err != nil {
 		utils.Error.Panic("[cache-grupostarjetas-datafast] error ejecutando la consulta: ", err)
 		return
 	}
-	for rows.Next() {
-		var (
-			idGrupoTarjeta string
-			codCadena      int
-			minimo         int
-			maximo         int
-		)
-		err := rows.Scan(&idGrupoTarjeta, &codCadena, &minimo, &maximo)
-		if err != nil {
-			utils.Error.Panic("[cache-restaurant-datafast] error al retornar los datos (Scan)", err)
-			return
-		}
-		cache.GrupoTarjetaCache[idGrupoTarjeta] = GrupoTarjeta{
-			IdGrupoTarjeta: idGrupoTarjeta,
-			CodCadena:      codCadena,
-			Minimo:         minimo,
-			Maximo:         maximo,
+	for _, group := range groups {
+		cache.GrupoTarjetaCache[group.IdGrupoTarjeta] = GrupoTarjeta{
+			IdGrupoTarjeta: group.IdGrupoTarjeta,
+			CodCadena:      group.CodCadena,
+			Minimo:         group.Minimo,
+			Maximo:         group.Maximo,
 		}
 	}
-	rows.Close()
 }
 func (cache *DataCacheRestaurant) getMerchantId(mid string) string {
 	for _, restaurante := range cache.RestaurantCache {
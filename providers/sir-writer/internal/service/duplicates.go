@@ -0,0 +1,59 @@
+package service
+
+import (
+	"fmt"
+	lib_mapper "lib-shared/mapper"
+	"lib-shared/sir_models"
+	"lib-shared/sir_validation"
+	"sir-writer/utils"
+)
+
+// crossProviderDuplicates devuelve, por posición en el wrapper, el pago de otro proveedor ya escrito en SIR que
+// coincide con un INSERT del wrapper. Solo se busca con cfg.Duplicates.Prevent, dos INSERT del mismo pago que
+// llegan a la vez por distintos proveedores no se detectan aquí y los informa report-system.
+func (provider *ApiProviderDatafast) crossProviderDuplicates(wrapper sir_models.WrapperTransactions) (map[int]lib_mapper.Payment, error) {
+	duplicates := make(map[int]lib_mapper.Payment)
+	if !provider.cfg.Duplicates.Prevent || utils.IsEmptyString(wrapper.Provider) {
+		return duplicates, nil
+	}
+	inserts := make([]sir_models.StTransactions, 0)
+	for _, transaction := range wrapper.Transactions {
+		if transaction.OperationType == "INSERT" {
+			inserts = append(inserts, transaction.Data)
+		}
+	}
+	if len(inserts) == 0 {
+		return duplicates, nil
+	}
+	written, err := provider.mongoRepository.FindWrittenDuplicates(wrapper.Provider, inserts)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]lib_mapper.Payment)
+	for _, payment := range written {
+		if key := payment.Data.Output.DuplicateKey(); key != "" {
+			byKey[key] = payment
+		}
+	}
+	for i, transaction := range wrapper.Transactions {
+		if transaction.OperationType != "INSERT" {
+			continue
+		}
+		if payment, found := byKey[transaction.Data.DuplicateKey()]; found {
+			duplicates[i] = payment
+		}
+	}
+	if len(duplicates) > 0 {
+		utils.Warning.Printf("[duplicates] wrapper %s con %d pagos ya escritos por otro proveedor\n", wrapper.Id, len(duplicates))
+	}
+	return duplicates, nil
+}
+
+// duplicateViolation deja en cuarentena el pago con el proveedor y el uniqueId del que ya está en SIR.
+func duplicateViolation(payment lib_mapper.Payment) sir_validation.Violation {
+	return sir_validation.Violation{
+		Field:   "NumeroAutorizacion",
+		Value:   payment.Data.Output.NumeroAutorizacion,
+		Message: fmt.Sprintf("el pago ya está escrito en SIR por %s (uniqueId %s)", payment.Provider, payment.UniqueId),
+	}
+}
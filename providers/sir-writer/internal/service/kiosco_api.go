@@ -2,7 +2,6 @@ package service
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"github.com/nats-io/nats.go/jetstream"
@@ -10,22 +9,24 @@ import (
 	"lib-shared/infrastructure/messaging_nats"
 	lib_mapper "lib-shared/mapper"
 	"lib-shared/sir_models"
+	"lib-shared/sir_repository"
+	"lib-shared/sir_validation"
 	"net/http"
-	db "sir-writer/internal/app/databases"
 	"sir-writer/internal/app/repository"
 	"sir-writer/internal/config"
 	"sir-writer/utils"
 	"strings"
-	"sync"
 	"time"
 )
 
 type ApiProviderDatafast struct {
 	mongoRepository *repository.MongoDataRepository
+	sirRepository   sir_repository.SirRepository
 	country         string
 	cfg             config.Config
 	natsManager     *messaging_nats.NatsStarter
 	cache           *DataCacheRestaurant
+	catalog         *sir_validation.Catalog
 }
 
 type IpAddressRestaurant struct {
@@ -36,215 +37,69 @@ type IpAddressRestaurant struct {
 	Clave       string
 }
 
-func NewApiProvider(mongoRepository *repository.MongoDataRepository, natsManager *messaging_nats.NatsStarter, cfg config.Config, cache *DataCacheRestaurant) *ApiProviderDatafast {
-	return &ApiProviderDatafast{
+func NewApiProvider(mongoRepository *repository.MongoDataRepository, sirRepository sir_repository.SirRepository, natsManager *messaging_nats.NatsStarter, cfg config.Config, cache *DataCacheRestaurant) *ApiProviderDatafast {
+	provider := &ApiProviderDatafast{
 		mongoRepository: mongoRepository,
+		sirRepository:   sirRepository,
 		natsManager:     natsManager,
 		cfg:             cfg,
 		cache:           cache,
 	}
+	if sirRepository != nil {
+		provider.catalog = sir_validation.NewCatalog(sirRepository, catalogMaxAge)
+	}
+	return provider
 }
 
-func (provider *ApiProviderDatafast) SavePaymentsTransactions(incomingMessage sir_models.WrapperTransactions, msg jetstream.Msg) {
-	wrapper := incomingMessage.Transactions
-	utils.Info.Printf("[sql-sir][StTransactions] starting batch %s with payments %d\n", incomingMessage.Id, len(wrapper))
-	const batchSize = 25
-	numWorkers := 10
-	// Canal para repartir el trabajo
-	batchChan := make(chan []sir_models.Transaction, numWorkers)
-	var wg sync.WaitGroup
-	// Lanza los workers para procesar las transacciones
-	inserted := 0
-	updated := 0
-	deleted := 0
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer func() {
-				msg.InProgress()
-				wg.Done()
-			}()
-			for batch := range batchChan {
-				insertedResult, updatedResult, deletedResult := provider.processBatch(batch)
-				inserted += insertedResult
-				updated += updatedResult
-				deleted += deletedResult
-				msg.InProgress()
-				utils.Info.Printf("[sql-sir][StTransactions] end batch insert:%d, updated:%d, deleted:%d\n", insertedResult, updatedResult, deletedResult)
+// SavePaymentsTransactions valida y aplica un WrapperTransactions en ST_Transaccional.
+// Con cfg.Duplicates.Prevent los INSERT de pagos que otro proveedor ya escribió quedan en cuarentena.
+func (provider *ApiProviderDatafast) SavePaymentsTransactions(incomingMessage sir_models.WrapperTransactions, msg jetstream.Msg) (*WriteResult, error) {
+	duplicates, err := provider.crossProviderDuplicates(incomingMessage)
+	if err != nil {
+		return &WriteResult{WrapperId: incomingMessage.Id, FailedIndex: -1}, err
+	}
+	validate := func(index int) *sir_validation.QuarantinedRow {
+		transaction := incomingMessage.Transactions[index]
+		ref := sir_models.TransactionRef{OperationType: transaction.OperationType, UniqueId: transaction.UniqueId, Hash: transaction.Hash}
+		return quarantineRow(incomingMessage, ref, sir_repository.TransactionsTableName, transaction.Data, func() []sir_validation.Violation {
+			violations := sir_validation.ValidateTransaction(transaction.Data, provider.catalog)
+			if duplicate, found := duplicates[index]; found {
+				violations = append(violations, duplicateViolation(duplicate))
 			}
-		}()
-	}
-
-	// Dividir las transacciones en lotes
-	for i := 0; i < len(wrapper); i += batchSize {
-		end := i + batchSize
-		if end > len(wrapper) {
-			end = len(wrapper)
+			return violations
+		})
+	}
+	return provider.applyWrapper(incomingMessage, msg, validate, func(tx sir_repository.WriteTx, index int) error {
+		transaction := incomingMessage.Transactions[index]
+		journal := journaled(incomingMessage)
+		var before any
+		if journal && transaction.OperationType != "INSERT" {
+			rows, err := tx.FindTransactions(transaction.Data)
+			if err != nil {
+				return err
+			}
+			before = rows
 		}
-		batchChan <- wrapper[i:end]
-	}
-	close(batchChan)
-	wg.Wait()
-	utils.Info.Printf("[sql-sir][StTransactions] all batched finished inserted %d, updated %d, deleted %d\n", inserted, updated, deleted)
-}
-func (provider *ApiProviderDatafast) processBatch(batch []sir_models.Transaction) (int, int, int) {
-	conn, err := db.NewSQLServerConnection(provider.cfg.SqlServerSir.JDBC)
-	if err != nil {
-		utils.Error.Printf("Error conectando a la base de datos: %v\n", err)
-		return 0, 0, 0
-	}
-	defer conn.Close()
-
-	// Iterar sobre cada transacción en el batch
-	inserted := 0
-	updated := 0
-	deleted := 0
-	for _, wrapper := range batch {
-		switch wrapper.OperationType {
+		var err error
+		switch transaction.OperationType {
 		case "INSERT":
-			provider.insertTransaction(conn, wrapper.Data)
-			inserted++
-			continue
+			// un reintento puede traer un INSERT que ya se aplicó con otro wrapper
+			exists, existsErr := tx.TransactionExists(transaction.Data)
+			if existsErr != nil || exists {
+				return existsErr
+			}
+			err = tx.InsertTransaction(transaction.Data)
 		case "UPDATE":
-			provider.updateTransaction(conn, wrapper.Data)
-			updated++
-			continue
-		case "DELETE":
-			provider.deleteTransaction(conn, wrapper.Data)
-			deleted++
-			continue
+			err = tx.UpdateTransaction(transaction.Data)
 		default:
-			utils.Error.Printf("Operación desconocida: %s\n", wrapper.OperationType)
+			err = tx.DeleteTransaction(transaction.Data)
 		}
-	}
-	return inserted, updated, deleted
-}
-func (provider *ApiProviderDatafast) insertTransaction(conn *db.SQLServerConnection, data sir_models.StTransactions) {
-	ex, err := conn.Exec(`
-		INSERT INTO ST_Transaccional (
-			Merchantid, Fecha_Transaccion, Hora_Transaccion, Estado,
-			Numero_Lote, Face_Value, Id_Grupo_Tarjeta, Id_Adquirente,
-			numero_tarjeta_mask, Numero_Autorizacion, Numero_Referencia,
-			Tipo_Transaccion, Resultado_Externo, Tipo_Switch, origen_Transaccion,
-			Sistema, Voucher, CuentaNombre, Subtotal, Descuento, Iva,
-			IvaAplicado, FidelizacionOpera, FidelizacionMerca, FidelizacionTotal,
-			FidelizacionValor
-		) VALUES (
-			@merchantId, @fechaTransaccion, @horaTransaccion, @estado,
-			@numeroLote, @faceValue, @idGrupoTarjeta, @idAdquirente,
-			@numeroTarjetaMask, @numeroAutorizacion, @numeroReferencia,
-			@tipoTransaccion, @resultadoExterno, @tipoSwitch, @origenTransaccion,
-			@sistema, @voucher, @cuentaNombre, @subtotal, @descuento, @iva,
-			@ivaAplicado, @fidelizacionOpera, @fidelizacionMerca, @fidelizacionTotal,
-			@fidelizacionValor
-		)`,
-		sql.Named("merchantId", data.MerchantId),
-		sql.Named("fechaTransaccion", data.FechaTransaccion),
-		sql.Named("horaTransaccion", data.HoraTransaccion),
-		sql.Named("estado", data.Estado),
-		sql.Named("numeroLote", data.NumeroLote),
-		sql.Named("faceValue", data.FaceValue),
-		sql.Named("idGrupoTarjeta", data.IdGrupoTarjeta),
-		sql.Named("idAdquirente", data.IdAdquirente),
-		sql.Named("numeroTarjetaMask", data.NumeroTarjetaMask),
-		sql.Named("numeroAutorizacion", data.NumeroAutorizacion),
-		sql.Named("numeroReferencia", data.NumeroReferencia),
-		sql.Named("tipoTransaccion", data.TipoTransaccion),
-		sql.Named("resultadoExterno", data.ResultadoExterno),
-		sql.Named("tipoSwitch", data.TipoSwitch),
-		sql.Named("origenTransaccion", data.OrigenTransaccion),
-		sql.Named("sistema", data.Sistema),
-		sql.Named("voucher", data.Voucher),
-		sql.Named("cuentaNombre", data.CuentaNombre),
-		sql.Named("subtotal", data.Subtotal),
-		sql.Named("descuento", data.Descuento),
-		sql.Named("iva", data.Iva),
-		sql.Named("ivaAplicado", data.IvaAplicado),
-		sql.Named("fidelizacionOpera", data.FidelizacionOpera),
-		sql.Named("fidelizacionMerca", data.FidelizacionMerca),
-		sql.Named("fidelizacionTotal", data.FidelizacionTotal),
-		sql.Named("fidelizacionValor", data.FidelizacionValor),
-	)
-	if err != nil {
-		utils.Error.Printf("Error al insertar: %v\n", err)
-	}
-	_, err = ex.RowsAffected()
-	if err != nil {
-		utils.Error.Printf("Error al retornar RowsAffected: %v\n", err)
-	}
-	//utils.Info.Printf("[sql-sir][Insert] merchant id: %s\n", data.MerchantId)
-	//utils.Info.Printf("[sql-sir][Insert] filas afectadas en el insert: %d\n", affected)
-}
-func (provider *ApiProviderDatafast) updateTransaction(conn *db.SQLServerConnection, data sir_models.StTransactions) {
-	_, err := conn.Exec(`
-		UPDATE ST_Transaccional SET
-			Hora_Transaccion = @horaTransaccion,
-			Estado = @estado,
-			Numero_Lote = @numeroLote,
-			Face_Value = @faceValue,
-			Id_Grupo_Tarjeta = @idGrupoTarjeta,
-			Id_Adquirente = @idAdquirente,
-			numero_tarjeta_mask = @numeroTarjetaMask,
-			Numero_Autorizacion = @numeroAutorizacion,
-			Numero_Referencia = @numeroReferencia,
-			Tipo_Transaccion = @tipoTransaccion,
-			Resultado_Externo = @resultadoExterno,
-			Tipo_Switch = @tipoSwitch,
-			origen_Transaccion = @origenTransaccion,
-			Sistema = @sistema,
-			Voucher = @voucher,
-			CuentaNombre = @cuentaNombre,
-			Subtotal = @subtotal,
-			Descuento = @descuento,
-			Iva = @iva,
-			IvaAplicado = @ivaAplicado,
-			FidelizacionOpera = @fidelizacionOpera,
-			FidelizacionMerca = @fidelizacionMerca,
-			FidelizacionTotal = @fidelizacionTotal,
-			FidelizacionValor = @fidelizacionValor
-		WHERE
-			Merchantid = @merchantId AND Fecha_Transaccion = @fechaTransaccion`,
-		sql.Named("merchantId", data.MerchantId),
-		sql.Named("fechaTransaccion", data.FechaTransaccion),
-		sql.Named("horaTransaccion", data.HoraTransaccion),
-		sql.Named("estado", data.Estado),
-		sql.Named("numeroLote", data.NumeroLote),
-		sql.Named("faceValue", data.FaceValue),
-		sql.Named("idGrupoTarjeta", data.IdGrupoTarjeta),
-		sql.Named("idAdquirente", data.IdAdquirente),
-		sql.Named("numeroTarjetaMask", data.NumeroTarjetaMask),
-		sql.Named("numeroAutorizacion", data.NumeroAutorizacion),
-		sql.Named("numeroReferencia", data.NumeroReferencia),
-		sql.Named("tipoTransaccion", data.TipoTransaccion),
-		sql.Named("resultadoExterno", data.ResultadoExterno),
-		sql.Named("tipoSwitch", data.TipoSwitch),
-		sql.Named("origenTransaccion", data.OrigenTransaccion),
-		sql.Named("sistema", data.Sistema),
-		sql.Named("voucher", data.Voucher),
-		sql.Named("cuentaNombre", data.CuentaNombre),
-		sql.Named("subtotal", data.Subtotal),
-		sql.Named("descuento", data.Descuento),
-		sql.Named("iva", data.Iva),
-		sql.Named("ivaAplicado", data.IvaAplicado),
-		sql.Named("fidelizacionOpera", data.FidelizacionOpera),
-		sql.Named("fidelizacionMerca", data.FidelizacionMerca),
-		sql.Named("fidelizacionTotal", data.FidelizacionTotal),
-		sql.Named("fidelizacionValor", data.FidelizacionValor),
-	)
-	if err != nil {
-		utils.Error.Printf("Error al actualizar: %v\n", err)
-	}
-}
-func (provider *ApiProviderDatafast) deleteTransaction(conn *db.SQLServerConnection, data sir_models.StTransactions) {
-	_, err := conn.Exec(`
-		DELETE FROM ST_Transaccional WHERE
-			Merchantid = @merchantId AND Fecha_Transaccion = @fechaTransaccion`,
-		sql.Named("merchantId", data.MerchantId),
-		sql.Named("fechaTransaccion", data.FechaTransaccion),
-	)
-	if err != nil {
-		utils.Error.Printf("Error al eliminar: %v\n", err)
-	}
+		if err != nil || !journal {
+			return err
+		}
+		ref := sir_models.TransactionRef{OperationType: transaction.OperationType, UniqueId: transaction.UniqueId, Hash: transaction.Hash}
+		return recordChange(tx, incomingMessage, ref, sir_repository.TransactionsTableName, transaction.Data, before)
+	})
 }
 
 type ApiResponse struct {
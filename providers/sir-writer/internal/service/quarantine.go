@@ -0,0 +1,52 @@
+package service
+
+import (
+	"lib-shared/sir_models"
+	"lib-shared/sir_validation"
+	"sir-writer/utils"
+	"time"
+)
+
+// cada cuánto se vuelven a leer Restaurante y ST_Grupo_Tarjeta para validar las filas
+const catalogMaxAge = 10 * time.Minute
+
+// quarantineRow arma la fila en cuarentena cuando la transacción tiene violaciones, nil si se puede escribir.
+// Los DELETE no se validan, la fila ya estaba en SIR y solo se usa su clave.
+func quarantineRow(wrapper sir_models.Wrapper, ref sir_models.TransactionRef, table string, data any, validate func() []sir_validation.Violation) *sir_validation.QuarantinedRow {
+	if ref.OperationType == "DELETE" {
+		return nil
+	}
+	violations := validate()
+	if len(violations) == 0 {
+		return nil
+	}
+	return &sir_validation.QuarantinedRow{
+		ConciliatorId: wrapper.GetConciliatorId(),
+		WrapperId:     wrapper.GetId(),
+		Provider:      wrapper.GetProvider(),
+		UniqueId:      ref.UniqueId,
+		Operation:     ref.OperationType,
+		Hash:          ref.Hash,
+		Table:         table,
+		Data:          data,
+		Violations:    violations,
+		CreatedAt:     time.Now(),
+	}
+}
+
+// SaveQuarantine guarda las filas en cuarentena del wrapper y deja sus pagos en QUARANTINED.
+// Se llama solo con el resultado definitivo del wrapper, igual que UpdateSyncState.
+func (provider *ApiProviderDatafast) SaveQuarantine(wrapper sir_models.Wrapper, result *WriteResult) {
+	if result == nil || len(result.Quarantined) == 0 {
+		return
+	}
+	if err := provider.mongoRepository.SaveQuarantine(result.Quarantined); err != nil {
+		utils.Error.Printf("[quarantine] error al guardar las filas en cuarentena del wrapper %s: %v\n", wrapper.GetId(), err)
+	}
+	if utils.IsEmptyString(wrapper.GetProvider()) {
+		return
+	}
+	if err := provider.mongoRepository.MarkQuarantined(wrapper.GetProvider(), result.Quarantined); err != nil {
+		utils.Error.Printf("[quarantine] error al actualizar el estado de los pagos en cuarentena del wrapper %s: %v\n", wrapper.GetId(), err)
+	}
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nats-io/nats.go/jetstream"
+	"lib-shared/reports_models"
+	"lib-shared/sir_models"
+	"lib-shared/sir_repository"
+	"sir-writer/utils"
+	"time"
+)
+
+// RollbackResult resume lo revertido en SIR para una conciliación.
+type RollbackResult struct {
+	RollbackId string
+	Skipped    bool
+	Reverted   int
+	Deleted    int
+	Restored   int
+}
+
+// RollbackConciliator revierte en una sola transacción todos los cambios del journal de la conciliación,
+// del más reciente al más antiguo: elimina las filas insertadas y devuelve las actualizadas o eliminadas a su
+// imagen anterior. Después deja los pagos de Mongo en ROLLED_BACK con el hash que SIR tiene ahora.
+func (provider *ApiProviderDatafast) RollbackConciliator(request sir_models.RollbackRequest, msg jetstream.Msg) (*RollbackResult, error) {
+	result := &RollbackResult{RollbackId: request.Id}
+	if utils.IsEmptyString(request.Id) || utils.IsEmptyString(request.ConciliatorId) {
+		return result, fmt.Errorf("la solicitud de rollback no tiene Id o ConciliatorId")
+	}
+	utils.Info.Printf("[rollback-sir] revirtiendo la conciliación %s (rollback %s)\n", request.ConciliatorId, request.Id)
+	tx, err := provider.sirRepository.Begin()
+	if err != nil {
+		return result, fmt.Errorf("error al iniciar la transacción del rollback %s: %w", request.Id, err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+	processed, err := tx.IsMessageProcessed(request.Id)
+	if err != nil {
+		return result, err
+	}
+	if processed {
+		utils.Warning.Printf("[rollback-sir] el rollback %s ya fue aplicado, se omite la redelivery\n", request.Id)
+		result.Skipped = true
+		return result, nil
+	}
+	changes, err := tx.FindChanges(request.ConciliatorId)
+	if err != nil {
+		return result, err
+	}
+	// proveedor -> uniqueId -> hash que queda en SIR, los cambios vienen del más reciente al más antiguo
+	// así que el último valor asignado es el estado previo a la conciliación
+	sirHashes := make(map[string]map[string]string)
+	for i, change := range changes {
+		sirHash, err := revertChange(tx, change, result)
+		if err != nil {
+			return result, fmt.Errorf("error al revertir el cambio %d (%s en %s): %w", change.Id, change.Operation, change.Table, err)
+		}
+		result.Reverted++
+		if !utils.IsEmptyString(change.Provider) && !utils.IsEmptyString(change.UniqueId) {
+			if _, exists := sirHashes[change.Provider]; !exists {
+				sirHashes[change.Provider] = make(map[string]string)
+			}
+			sirHashes[change.Provider][change.UniqueId] = sirHash
+		}
+		if (i+1)%25 == 0 {
+			msg.InProgress()
+		}
+	}
+	if err := tx.MarkChangesReverted(request.ConciliatorId, request.Id); err != nil {
+		return result, err
+	}
+	if err := tx.MarkMessageProcessed(request.Id, len(changes)); err != nil {
+		return result, err
+	}
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("error al confirmar el rollback %s: %w", request.Id, err)
+	}
+	committed = true
+	for providerName, hashes := range sirHashes {
+		if err := provider.mongoRepository.MarkRolledBack(providerName, hashes); err != nil {
+			utils.Error.Printf("[rollback-sir][%s] error al actualizar el estado de los pagos revertidos: %v\n", providerName, err)
+		}
+	}
+	utils.Info.Printf("[rollback-sir] conciliación %s revertida: %d cambios, %d filas eliminadas, %d filas restauradas\n", request.ConciliatorId, result.Reverted, result.Deleted, result.Restored)
+	return result, nil
+}
+
+// revertChange aplica la compensación de un cambio del journal y devuelve el hash de la fila del pago
+// que queda en SIR, vacío si la fila ya no existe.
+func revertChange(tx sir_repository.WriteTx, change sir_repository.Change, result *RollbackResult) (string, error) {
+	switch change.Table {
+	case sir_repository.TransactionsTableName:
+		var data sir_models.StTransactions
+		var before []sir_models.StTransactions
+		if err := unmarshalChange(change, &data, &before); err != nil {
+			return "", err
+		}
+		switch change.Operation {
+		case "INSERT":
+			if err := tx.DeleteInsertedTransaction(data); err != nil {
+				return "", err
+			}
+			result.Deleted++
+			return "", nil
+		case "UPDATE":
+			// solo se borra la fila del pago por su clave, las demás de Merchantid + Fecha_Transaccion pueden ser
+			// de escrituras posteriores u otras conciliaciones
+			if err := tx.DeleteInsertedTransaction(data); err != nil {
+				return "", err
+			}
+		}
+		// de la imagen anterior se restauran las filas que ya no están en SIR, una fila que volvió a escribirse
+		// después se deja como está en lugar de volver a su versión vieja o duplicarla
+		current, err := tx.FindTransactions(data)
+		if err != nil {
+			return "", err
+		}
+		sirHash := ""
+		existing := make(map[string]bool, len(current))
+		for _, row := range current {
+			existing[row.GetUniqueId()] = true
+			if row.GetUniqueId() == data.GetUniqueId() {
+				sirHash = row.GetTransactionHash()
+			}
+		}
+		for _, row := range before {
+			if existing[row.GetUniqueId()] {
+				continue
+			}
+			existing[row.GetUniqueId()] = true
+			if err := tx.InsertTransaction(row); err != nil {
+				return "", err
+			}
+			result.Restored++
+			if row.GetUniqueId() == data.GetUniqueId() {
+				sirHash = row.GetTransactionHash()
+			}
+		}
+		return sirHash, nil
+	case sir_repository.VentasAppTableName:
+		var data sir_models.VentasApp
+		var before []sir_models.VentasApp
+		if err := unmarshalChange(change, &data, &before); err != nil {
+			return "", err
+		}
+		if change.Operation != "DELETE" {
+			if err := tx.DeleteVentaApp(data); err != nil {
+				return "", err
+			}
+			if change.Operation == "INSERT" {
+				result.Deleted++
+				return "", nil
+			}
+		}
+		sirHash := ""
+		for _, row := range before {
+			if err := tx.InsertVentaApp(row); err != nil {
+				return "", err
+			}
+			result.Restored++
+			sirHash = row.GetTransactionHash()
+		}
+		return sirHash, nil
+	default:
+		return "", fmt.Errorf("tabla desconocida en el journal: %s", change.Table)
+	}
+}
+
+func unmarshalChange(change sir_repository.Change, data any, before any) error {
+	if err := json.Unmarshal([]byte(change.Data), data); err != nil {
+		return fmt.Errorf("error al deserializar la fila del journal: %w", err)
+	}
+	if utils.IsEmptyString(change.Before) {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(change.Before), before); err != nil {
+		return fmt.Errorf("error al deserializar la imagen anterior del journal: %w", err)
+	}
+	return nil
+}
+
+// PublishRollbackResult informa a report-system el resultado definitivo del rollback.
+func (provider *ApiProviderDatafast) PublishRollbackResult(request sir_models.RollbackRequest, result *RollbackResult, rollbackErr error) error {
+	report := reports_models.SirRollbackReport{
+		ConciliatorId: request.ConciliatorId,
+		RollbackId:    request.Id,
+		Status:        reports_models.SirWriteApplied,
+		Reason:        request.Reason,
+		CreatedAt:     time.Now(),
+	}
+	if rollbackErr != nil {
+		// el rollback es una sola transacción, si falla SIR queda como estaba
+		report.Status = reports_models.SirWriteFailed
+		report.Error = rollbackErr.Error()
+	} else if result != nil {
+		report.Reverted = uint32(result.Reverted)
+		report.Deleted = uint32(result.Deleted)
+		report.Restored = uint32(result.Restored)
+	}
+	return reports_models.SirRollbackReportEvent.Publish(provider.natsManager.EventSender, report.ConciliatorId, report)
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"lib-shared/sir_models"
+	"sort"
+	"testing"
+)
+
+// revertAll revierte el journal de la conciliación igual que RollbackConciliator, sin actualizar Mongo.
+func revertAll(t *testing.T, provider *ApiProviderDatafast, conciliatorId string) (*RollbackResult, map[string]string) {
+	t.Helper()
+	tx, err := provider.sirRepository.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	changes, err := tx.FindChanges(conciliatorId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &RollbackResult{RollbackId: "rollback-1"}
+	sirHashes := make(map[string]string)
+	for _, change := range changes {
+		sirHash, err := revertChange(tx, change, result)
+		if err != nil {
+			t.Fatalf("error al revertir el cambio %d (%s): %v", change.Id, change.Operation, err)
+		}
+		result.Reverted++
+		sirHashes[change.UniqueId] = sirHash
+	}
+	if err := tx.MarkChangesReverted(conciliatorId, result.RollbackId); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return result, sirHashes
+}
+
+func seedTransactions(t *testing.T, provider *ApiProviderDatafast, rows ...sir_models.StTransactions) {
+	t.Helper()
+	tx, err := provider.sirRepository.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for _, row := range rows {
+		if err := tx.InsertTransaction(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func transactionHashes(rows []sir_models.StTransactions) []string {
+	hashes := make([]string, 0, len(rows))
+	for _, row := range rows {
+		hashes = append(hashes, row.GetTransactionHash())
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+func TestRollbackRestoresBeforeImages(t *testing.T) {
+	provider := newTestProvider(t)
+	original := testTransaction("0001", "10.50")
+	sibling := testTransaction("0002", "20.00")
+	seedTransactions(t, provider, original, sibling)
+	expected := transactionHashes([]sir_models.StTransactions{original, sibling})
+
+	updated := original
+	updated.FaceValue = "99.00"
+	inserted := testTransaction("0003", "30.00")
+	_, err := provider.SavePaymentsTransactions(testWrapper("wrapper-1", "conciliacion-1",
+		operation("UPDATE", updated), operation("INSERT", inserted)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, sirHashes := revertAll(t, provider, "conciliacion-1")
+	if result.Reverted != 2 || result.Deleted != 1 {
+		t.Fatalf("se esperaban 2 cambios revertidos y 1 fila eliminada: %+v", result)
+	}
+	// el UPDATE de ST_Transaccional pisa todas las filas del comercio en la fecha, se restauran las dos
+	if result.Restored != 2 {
+		t.Fatalf("se esperaban 2 filas restauradas de la imagen anterior: %+v", result)
+	}
+	if got := transactionHashes(findRows(t, provider, original)); len(got) != len(expected) || got[0] != expected[0] || got[1] != expected[1] {
+		t.Fatalf("SIR no volvió a las filas previas a la conciliación:\n%v\n%v", got, expected)
+	}
+	if sirHashes[updated.GetUniqueId()] != original.GetTransactionHash() {
+		t.Fatal("el pago actualizado debe quedar con el hash de su imagen anterior")
+	}
+	if sirHashes[inserted.GetUniqueId()] != "" {
+		t.Fatal("el pago insertado ya no está en SIR y no debe tener hash")
+	}
+	if changes := findChanges(t, provider, "conciliacion-1"); len(changes) != 0 {
+		t.Fatalf("los cambios revertidos no deben volver a revertirse: %+v", changes)
+	}
+}
+
+func TestRollbackKeepsRowsWrittenLater(t *testing.T) {
+	provider := newTestProvider(t)
+	original := testTransaction("0001", "10.50")
+	seedTransactions(t, provider, original)
+
+	updated := original
+	updated.FaceValue = "99.00"
+	if _, err := provider.SavePaymentsTransactions(testWrapper("wrapper-1", "conciliacion-1", operation("UPDATE", updated)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// otra conciliación escribe después un pago del mismo comercio y fecha
+	later := testTransaction("0002", "40.00")
+	if _, err := provider.SavePaymentsTransactions(testWrapper("wrapper-2", "conciliacion-2", operation("INSERT", later)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	result, _ := revertAll(t, provider, "conciliacion-1")
+	if result.Restored != 1 {
+		t.Fatalf("solo se restaura la fila del pago revertido: %+v", result)
+	}
+	expected := transactionHashes([]sir_models.StTransactions{original, later})
+	if got := transactionHashes(findRows(t, provider, original)); len(got) != len(expected) || got[0] != expected[0] || got[1] != expected[1] {
+		t.Fatalf("el rollback no debe tocar las filas de otra conciliación:\n%v\n%v", got, expected)
+	}
+}
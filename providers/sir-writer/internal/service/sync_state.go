@@ -0,0 +1,105 @@
+package service
+
+import (
+	"fmt"
+	uuid2 "github.com/google/uuid"
+	lib_mapper "lib-shared/mapper"
+	"lib-shared/sir_models"
+	"lib-shared/topology"
+	"sir-writer/utils"
+	"time"
+)
+
+// tamaño de los wrappers que se reenvían con el comando retry, igual que los proveedores
+const retryBatchSize = 250
+
+// UpdateSyncState refleja en la colección fetch-* del proveedor el resultado definitivo del wrapper,
+// las filas en cuarentena se marcan aparte en SaveQuarantine.
+func (provider *ApiProviderDatafast) UpdateSyncState(wrapper sir_models.Wrapper, result *WriteResult, writeErr error) {
+	if utils.IsEmptyString(wrapper.GetProvider()) {
+		return
+	}
+	refs := result.Applied(wrapper.Refs())
+	var err error
+	if writeErr == nil {
+		err = provider.mongoRepository.MarkWritten(wrapper.GetProvider(), refs)
+	} else {
+		err = provider.mongoRepository.MarkFailed(wrapper.GetProvider(), refs, writeErr.Error())
+	}
+	if err != nil {
+		utils.Error.Printf("[sync-state] error al actualizar el estado de los pagos del wrapper %s: %v\n", wrapper.GetId(), err)
+	}
+}
+
+// RetryUnsynced reenvía a sir-writer los pagos del proveedor que siguen FAILED desde hace más de olderThan,
+// agrupados por conciliación. Un PENDING solo se reenvía cuando su wrapper ya no puede estar en el stream
+// (topology.SirWriterMaxAge), antes el original y el reintento escribirían el mismo pago.
+// Devuelve la cantidad de pagos reenviados.
+func (provider *ApiProviderDatafast) RetryUnsynced(providerName string, olderThan time.Duration) (int, error) {
+	now := time.Now()
+	payments, err := provider.mongoRepository.FindUnsynced(providerName, now.Add(-olderThan), now.Add(-max(olderThan, topology.SirWriterMaxAge)))
+	if err != nil {
+		return 0, fmt.Errorf("error al buscar pagos sin sincronizar de %s: %w", providerName, err)
+	}
+	utils.Info.Printf("[sync-retry][%s] %d pagos pendientes o fallidos\n", providerName, len(payments))
+	byConciliator := make(map[string][]sir_models.Transaction)
+	order := make([]string, 0)
+	alreadyWritten := make([]sir_models.TransactionRef, 0)
+	for _, payment := range payments {
+		transaction := sir_models.Transaction{
+			OperationType: lib_mapper.ResolveOperation(payment.Hash, lib_mapper.ConfirmedHash(payment.Hash, payment.SirHash, payment.SyncStatus)),
+			UniqueId:      payment.UniqueId,
+			Hash:          payment.Hash,
+			Data:          payment.Data.Output,
+		}
+		// SIR ya tiene este hash, solo falta reflejarlo en Mongo
+		if transaction.OperationType == "IGNORE" {
+			alreadyWritten = append(alreadyWritten, sir_models.TransactionRef{
+				OperationType: transaction.OperationType,
+				UniqueId:      transaction.UniqueId,
+				Hash:          transaction.Hash,
+			})
+			continue
+		}
+		if _, exists := byConciliator[payment.ConciliatorId]; !exists {
+			order = append(order, payment.ConciliatorId)
+		}
+		byConciliator[payment.ConciliatorId] = append(byConciliator[payment.ConciliatorId], transaction)
+	}
+	if len(alreadyWritten) > 0 {
+		if err := provider.mongoRepository.MarkWritten(providerName, alreadyWritten); err != nil {
+			utils.Error.Printf("[sync-retry][%s] error al marcar pagos ya escritos: %v\n", providerName, err)
+		}
+	}
+	retried := 0
+	for _, conciliatorId := range order {
+		transactions := byConciliator[conciliatorId]
+		for i := 0; i < len(transactions); i += retryBatchSize {
+			end := i + retryBatchSize
+			if end > len(transactions) {
+				end = len(transactions)
+			}
+			batch := transactions[i:end]
+			uniqueIds := make([]string, 0, len(batch))
+			for _, transaction := range batch {
+				uniqueIds = append(uniqueIds, transaction.UniqueId)
+			}
+			if err := provider.mongoRepository.MarkPending(providerName, uniqueIds); err != nil {
+				return retried, fmt.Errorf("error al marcar pagos como pendientes: %w", err)
+			}
+			uuid, _ := uuid2.NewV7()
+			transactionsWrapper := sir_models.WrapperTransactions{
+				Id:            uuid.String(),
+				ConciliatorId: conciliatorId,
+				Provider:      providerName,
+				Transactions:  batch,
+			}
+			if err := sir_models.TransactionsEvent.PublishWithId(provider.natsManager.EventSender, transactionsWrapper.Id, transactionsWrapper.ConciliatorId, transactionsWrapper); err != nil {
+				return retried, fmt.Errorf("error al reenviar el wrapper %s: %w", uuid.String(), err)
+			}
+			retried += len(batch)
+		}
+	}
+	utils.Info.Printf("[sync-retry][%s] %d pagos reenviados a sir-writer\n", providerName, retried)
+	return retried, nil
+}
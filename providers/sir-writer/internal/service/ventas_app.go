@@ -0,0 +1,46 @@
+package service
+
+import (
+	"github.com/nats-io/nats.go/jetstream"
+	"lib-shared/sir_models"
+	"lib-shared/sir_repository"
+	"lib-shared/sir_validation"
+)
+
+// SaveVentasAppTransactions aplica un WrapperVentasApp en ST_VentasApp con la misma validación, transacción,
+// ledger, journal y reporte que el flujo de ST_Transaccional.
+func (provider *ApiProviderDatafast) SaveVentasAppTransactions(incomingMessage sir_models.WrapperVentasApp, msg jetstream.Msg) (*WriteResult, error) {
+	validate := func(index int) *sir_validation.QuarantinedRow {
+		transaction := incomingMessage.Transactions[index]
+		ref := sir_models.TransactionRef{OperationType: transaction.OperationType, UniqueId: transaction.UniqueId, Hash: transaction.Hash}
+		return quarantineRow(incomingMessage, ref, sir_repository.VentasAppTableName, transaction.Data, func() []sir_validation.Violation {
+			return sir_validation.ValidateVentaApp(transaction.Data, provider.catalog)
+		})
+	}
+	return provider.applyWrapper(incomingMessage, msg, validate, func(tx sir_repository.WriteTx, index int) error {
+		transaction := incomingMessage.Transactions[index]
+		journal := journaled(incomingMessage)
+		var before any
+		if journal && transaction.OperationType != "INSERT" {
+			rows, err := tx.FindVentasApp(transaction.Data)
+			if err != nil {
+				return err
+			}
+			before = rows
+		}
+		var err error
+		switch transaction.OperationType {
+		case "INSERT":
+			err = tx.InsertVentaApp(transaction.Data)
+		case "UPDATE":
+			err = tx.UpdateVentaApp(transaction.Data)
+		default:
+			err = tx.DeleteVentaApp(transaction.Data)
+		}
+		if err != nil || !journal {
+			return err
+		}
+		ref := sir_models.TransactionRef{OperationType: transaction.OperationType, UniqueId: transaction.UniqueId, Hash: transaction.Hash}
+		return recordChange(tx, incomingMessage, ref, sir_repository.VentasAppTableName, transaction.Data, before)
+	})
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"fmt"
+	"github.com/nats-io/nats.go/jetstream"
+	"lib-shared/sir_models"
+	"lib-shared/sir_repository"
+	"lib-shared/sir_validation"
+	"sir-writer/utils"
+)
+
+// WriteResult resume lo aplicado en SIR para un wrapper de sir.writer.*.
+type WriteResult struct {
+	WrapperId string
+	Skipped   bool
+	Inserted  int
+	Updated   int
+	Deleted   int
+	// posición de la transacción que provocó el rollback del wrapper, -1 si no hubo error en una fila
+	FailedIndex int
+	// filas que no pasaron la validación y no se enviaron a SIR
+	Quarantined      []sir_validation.QuarantinedRow
+	quarantinedIndex map[int]bool
+}
+
+// applyWrapper aplica todas las transacciones del wrapper dentro de una única transacción SQL.
+// Si el wrapper ya fue aplicado (ledger de mensajes procesados) se omite, y ante cualquier error se hace
+// rollback completo para que la redelivery de JetStream lo vuelva a intentar sin duplicar filas.
+// validate devuelve la fila en cuarentena si la transacción i no se puede escribir (nil si es válida), y
+// apply escribe la transacción i del wrapper sobre la transacción abierta.
+func (provider *ApiProviderDatafast) applyWrapper(wrapper sir_models.Wrapper, msg jetstream.Msg, validate func(index int) *sir_validation.QuarantinedRow, apply func(tx sir_repository.WriteTx, index int) error) (*WriteResult, error) {
+	refs := wrapper.Refs()
+	result := &WriteResult{WrapperId: wrapper.GetId(), FailedIndex: -1, quarantinedIndex: make(map[int]bool)}
+	if utils.IsEmptyString(wrapper.GetId()) {
+		return result, fmt.Errorf("el wrapper no tiene Id, no se puede garantizar la idempotencia")
+	}
+	// la validación se repite en cada redelivery, es determinista salvo por la recarga del catálogo
+	if err := provider.catalog.Refresh(); err != nil {
+		return result, err
+	}
+	for i := range refs {
+		if row := validate(i); row != nil {
+			result.quarantinedIndex[i] = true
+			result.Quarantined = append(result.Quarantined, *row)
+		}
+	}
+	if len(result.Quarantined) > 0 {
+		utils.Warning.Printf("[sql-sir] wrapper %s con %d filas en cuarentena\n", wrapper.GetId(), len(result.Quarantined))
+	}
+	utils.Info.Printf("[sql-sir] starting wrapper %s with payments %d\n", wrapper.GetId(), len(refs))
+	tx, err := provider.sirRepository.Begin()
+	if err != nil {
+		return result, fmt.Errorf("error al iniciar la transacción del wrapper %s: %w", wrapper.GetId(), err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+	processed, err := tx.IsMessageProcessed(wrapper.GetId())
+	if err != nil {
+		return result, err
+	}
+	if processed {
+		utils.Warning.Printf("[sql-sir] el wrapper %s ya fue aplicado, se omite la redelivery\n", wrapper.GetId())
+		result.Skipped = true
+		result.countOperations(result.Applied(refs))
+		return result, nil
+	}
+	for i, ref := range refs {
+		if result.quarantinedIndex[i] {
+			continue
+		}
+		switch ref.OperationType {
+		case "INSERT":
+			result.Inserted++
+		case "UPDATE":
+			result.Updated++
+		case "DELETE":
+			result.Deleted++
+		default:
+			result.FailedIndex = i
+			return result, fmt.Errorf("operación desconocida: %s", ref.OperationType)
+		}
+		if err := apply(tx, i); err != nil {
+			result.FailedIndex = i
+			return result, fmt.Errorf("error en la transacción #%d (%s) del wrapper %s: %w", i+1, ref.OperationType, wrapper.GetId(), err)
+		}
+		if (i+1)%25 == 0 {
+			msg.InProgress()
+		}
+	}
+	if err := tx.MarkMessageProcessed(wrapper.GetId(), len(refs)-len(result.Quarantined)); err != nil {
+		return result, err
+	}
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("error al confirmar la transacción del wrapper %s: %w", wrapper.GetId(), err)
+	}
+	committed = true
+	utils.Info.Printf("[sql-sir] wrapper %s finished inserted %d, updated %d, deleted %d, quarantined %d\n", wrapper.GetId(), result.Inserted, result.Updated, result.Deleted, len(result.Quarantined))
+	return result, nil
+}
+
+// countOperations cuenta las operaciones del wrapper sin aplicarlas, se usa cuando el wrapper ya estaba en el ledger.
+func (result *WriteResult) countOperations(refs []sir_models.TransactionRef) {
+	for _, ref := range refs {
+		switch ref.OperationType {
+		case "INSERT":
+			result.Inserted++
+		case "UPDATE":
+			result.Updated++
+		case "DELETE":
+			result.Deleted++
+		}
+	}
+}
+
+// Applied devuelve las referencias del wrapper que se enviaron a SIR, sin las filas en cuarentena.
+func (result *WriteResult) Applied(refs []sir_models.TransactionRef) []sir_models.TransactionRef {
+	if result == nil || len(result.quarantinedIndex) == 0 {
+		return refs
+	}
+	applied := make([]sir_models.TransactionRef, 0, len(refs))
+	for i, ref := range refs {
+		if !result.quarantinedIndex[i] {
+			applied = append(applied, ref)
+		}
+	}
+	return applied
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"lib-shared/sir_models"
+	"lib-shared/sir_repository"
+	"lib-shared/sir_validation"
+	"testing"
+	"time"
+)
+
+// newTestProvider levanta sir-writer sobre SIR en SQLite con los fixtures embebidos, sin Mongo ni NATS.
+func newTestProvider(t *testing.T) *ApiProviderDatafast {
+	t.Helper()
+	repository, err := sir_repository.NewSirRepository(sir_repository.Options{Driver: sir_repository.DriverSqlite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatalf("no se pudo abrir SIR en SQLite: %v", err)
+	}
+	t.Cleanup(func() { repository.Close() })
+	return &ApiProviderDatafast{
+		sirRepository: repository,
+		catalog:       sir_validation.NewCatalog(repository, time.Minute),
+	}
+}
+
+func testTransaction(referencia string, faceValue string) sir_models.StTransactions {
+	return sir_models.StTransactions{
+		MerchantId:         "100000001",
+		FechaTransaccion:   "2024-05-10",
+		HoraTransaccion:    "101500",
+		Estado:             "APROBADA",
+		FaceValue:          faceValue,
+		IdGrupoTarjeta:     "VISA",
+		NumeroTarjetaMask:  "411111XXXXXX1111",
+		NumeroAutorizacion: "A" + referencia,
+		NumeroReferencia:   referencia,
+		TipoSwitch:         1,
+		OrigenTransaccion:  1,
+		Sistema:            "DATBALANCE",
+	}
+}
+
+func testWrapper(id string, conciliatorId string, transactions ...sir_models.Transaction) sir_models.WrapperTransactions {
+	return sir_models.WrapperTransactions{Id: id, ConciliatorId: conciliatorId, Provider: "KIOSKO", Transactions: transactions}
+}
+
+func operation(operationType string, data sir_models.StTransactions) sir_models.Transaction {
+	return sir_models.Transaction{OperationType: operationType, UniqueId: data.GetUniqueId(), Hash: data.GetTransactionHash(), Data: data}
+}
+
+// findRows devuelve las filas de ST_Transaccional del comercio y la fecha de data.
+func findRows(t *testing.T, provider *ApiProviderDatafast, data sir_models.StTransactions) []sir_models.StTransactions {
+	t.Helper()
+	tx, err := provider.sirRepository.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	rows, err := tx.FindTransactions(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func findChanges(t *testing.T, provider *ApiProviderDatafast, conciliatorId string) []sir_repository.Change {
+	t.Helper()
+	tx, err := provider.sirRepository.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	changes, err := tx.FindChanges(conciliatorId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changes
+}
+
+func TestSavePaymentsTransactionsSkipsRedelivery(t *testing.T) {
+	provider := newTestProvider(t)
+	row := testTransaction("0001", "10.50")
+	wrapper := testWrapper("wrapper-1", "conciliacion-1", operation("INSERT", row))
+
+	result, err := provider.SavePaymentsTransactions(wrapper, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Skipped || result.Inserted != 1 {
+		t.Fatalf("la primera entrega debe aplicar el INSERT: %+v", result)
+	}
+	result, err = provider.SavePaymentsTransactions(wrapper, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// la redelivery se omite pero informa las mismas operaciones para el reporte
+	if !result.Skipped || result.Inserted != 1 {
+		t.Fatalf("la redelivery debe omitirse por el ledger: %+v", result)
+	}
+	if rows := findRows(t, provider, row); len(rows) != 1 {
+		t.Fatalf("la redelivery no debe duplicar la fila, hay %d", len(rows))
+	}
+	if changes := findChanges(t, provider, "conciliacion-1"); len(changes) != 1 {
+		t.Fatalf("la redelivery no debe duplicar el journal, hay %d cambios", len(changes))
+	}
+}
+
+func TestSavePaymentsTransactionsSkipsInsertAlreadyWritten(t *testing.T) {
+	provider := newTestProvider(t)
+	row := testTransaction("0001", "10.50")
+
+	if _, err := provider.SavePaymentsTransactions(testWrapper("wrapper-1", "conciliacion-1", operation("INSERT", row)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// el reintento de un pago PENDING publica el INSERT con otro wrapper
+	if _, err := provider.SavePaymentsTransactions(testWrapper("wrapper-2", "conciliacion-1", operation("INSERT", row)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if rows := findRows(t, provider, row); len(rows) != 1 {
+		t.Fatalf("el reintento no debe duplicar la fila, hay %d", len(rows))
+	}
+	// sin entrada en el journal, el rollback borraría la fila una sola vez
+	if changes := findChanges(t, provider, "conciliacion-1"); len(changes) != 1 {
+		t.Fatalf("el INSERT omitido no debe ir al journal, hay %d cambios", len(changes))
+	}
+}
+
+func TestSavePaymentsTransactionsQuarantinesInvalidRows(t *testing.T) {
+	provider := newTestProvider(t)
+	valid := testTransaction("0001", "10.50")
+	unknownMerchant := testTransaction("0002", "20.00")
+	unknownMerchant.MerchantId = "999999999"
+	badAmount := testTransaction("0003", "veinte")
+
+	wrapper := testWrapper("wrapper-1", "conciliacion-1",
+		operation("INSERT", valid), operation("INSERT", unknownMerchant), operation("INSERT", badAmount))
+	result, err := provider.SavePaymentsTransactions(wrapper, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Inserted != 1 || len(result.Quarantined) != 2 {
+		t.Fatalf("se esperaba 1 fila aplicada y 2 en cuarentena: %+v", result)
+	}
+	quarantined := map[string]string{}
+	for _, row := range result.Quarantined {
+		if len(row.Violations) == 0 {
+			t.Fatalf("la fila %s está en cuarentena sin violaciones", row.UniqueId)
+		}
+		if row.ConciliatorId != "conciliacion-1" || row.WrapperId != "wrapper-1" || row.Provider != "KIOSKO" {
+			t.Fatalf("la fila en cuarentena no guarda su wrapper: %+v", row)
+		}
+		quarantined[row.UniqueId] = row.Violations[0].Field
+	}
+	if quarantined[unknownMerchant.GetUniqueId()] != "MerchantId" || quarantined[badAmount.GetUniqueId()] != "FaceValue" {
+		t.Fatalf("las violaciones no corresponden a las filas: %v", quarantined)
+	}
+	applied := result.Applied(wrapper.Refs())
+	if len(applied) != 1 || applied[0].UniqueId != valid.GetUniqueId() {
+		t.Fatalf("solo la fila válida cuenta como enviada a SIR: %+v", applied)
+	}
+	rows := findRows(t, provider, valid)
+	if len(rows) != 1 || rows[0].GetUniqueId() != valid.GetUniqueId() {
+		t.Fatalf("solo la fila válida debe estar en SIR: %+v", rows)
+	}
+}
+
+func TestSavePaymentsTransactionsDoesNotQuarantineDeletes(t *testing.T) {
+	provider := newTestProvider(t)
+	row := testTransaction("0001", "10.50")
+	row.MerchantId = "999999999"
+
+	result, err := provider.SavePaymentsTransactions(testWrapper("wrapper-1", "", operation("DELETE", row)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Quarantined) != 0 || result.Deleted != 1 {
+		t.Fatalf("un DELETE solo usa la clave de la fila y no se valida: %+v", result)
+	}
+}
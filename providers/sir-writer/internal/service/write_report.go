@@ -0,0 +1,51 @@
+package service
+
+import (
+	"lib-shared/reports_models"
+	"lib-shared/sir_models"
+	"lib-shared/sir_validation"
+	"sir-writer/utils"
+	"time"
+)
+
+// PublishWriteResult informa a report-system el resultado real de aplicar el wrapper en SIR.
+// Solo se publica el resultado definitivo: aplicado, o fallido cuando ya no habrá más redeliveries. El id del
+// mensaje es el del wrapper, report-system además ignora un resultado repetido.
+func (provider *ApiProviderDatafast) PublishWriteResult(wrapper sir_models.Wrapper, result *WriteResult, writeErr error) error {
+	if utils.IsEmptyString(wrapper.GetConciliatorId()) {
+		return nil
+	}
+	report := reports_models.SirWriteReport{
+		ConciliatorId: wrapper.GetConciliatorId(),
+		WrapperId:     wrapper.GetId(),
+		Status:        reports_models.SirWriteApplied,
+		CreatedAt:     time.Now(),
+	}
+	if result != nil {
+		report.Quarantined = uint32(len(result.Quarantined))
+		for _, row := range result.Quarantined {
+			report.Quarantine = append(report.Quarantine, reports_models.SirWriteError{
+				UniqueId:  row.UniqueId,
+				Operation: row.Operation,
+				Message:   sir_validation.Summary(row.Violations),
+			})
+		}
+	}
+	if writeErr == nil {
+		report.Inserted = uint32(result.Inserted)
+		report.Updated = uint32(result.Updated)
+		report.Deleted = uint32(result.Deleted)
+	} else {
+		// el wrapper se aplica en una sola transacción, si falla se revierten todas sus filas
+		refs := wrapper.Refs()
+		report.Status = reports_models.SirWriteFailed
+		report.Failed = uint32(len(result.Applied(refs)))
+		sirError := reports_models.SirWriteError{Message: writeErr.Error()}
+		if result != nil && result.FailedIndex >= 0 && result.FailedIndex < len(refs) {
+			sirError.UniqueId = refs[result.FailedIndex].UniqueId
+			sirError.Operation = refs[result.FailedIndex].OperationType
+		}
+		report.Errors = []reports_models.SirWriteError{sirError}
+	}
+	return reports_models.SirWriteReportEvent.PublishWithId(provider.natsManager.EventSender, "sir-report-"+wrapper.GetId(), report.ConciliatorId, report)
+}